@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+)
+
+// askOptions holds the flags specific to shell mode
+type askOptions struct {
+	format        string
+	files         []string
+	contextLength int
+	tags          []string
+
+	compare string
+	columns bool
+
+	chunk    bool
+	chunking chat.ChunkOptions
+}
+
+// newAskCmd creates the single-shot shell mode subcommand
+func newAskCmd(opts *globalOptions) *cobra.Command {
+	askOpts := &askOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "ask [prompt...]",
+		Short: "Send a single prompt, optionally with piped input, and print the reply",
+		Example: `  cat main.go | llm-chat ask "explain this code"
+  git diff | llm-chat ask -p groq "write a concise commit message"
+  llm-chat ask --file main.go --file 'internal/**/*.go' "how is config loaded?"
+  llm-chat ask --compare groq:llama-70b,gemini:flash "explain CRDTs in one paragraph"`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAsk(cmd, opts, askOpts, args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&askOpts.format, "format", "f", "text", "Output format: text, json, jsonl, markdown, raw")
+	cmd.Flags().StringArrayVar(&askOpts.files, "file", nil, "File, directory or glob to send with the prompt (repeatable; ** matches directories)")
+	cmd.Flags().StringArrayVar(&askOpts.tags, "tag", nil, "Tag the request for the router's rules (repeatable)")
+	cmd.Flags().IntVar(&askOpts.contextLength, "context-length", 0, "Context window size in tokens (default: the model's own)")
+	cmd.Flags().StringVar(&askOpts.compare, "compare", "", "Send the prompt to several providers at once and compare the replies (provider:model,...)")
+	cmd.Flags().BoolVar(&askOpts.columns, "columns", false, "With --compare, show the replies side by side once all have arrived")
+	cmd.Flags().BoolVar(&askOpts.chunk, "chunk", false, "Split large inputs into chunks, answer each and merge the answers")
+	cmd.Flags().IntVar(&askOpts.chunking.Size, "chunk-size", 0, "Tokens per chunk (default: three quarters of the prompt budget)")
+	cmd.Flags().IntVar(&askOpts.chunking.Lines, "chunk-lines", 0, "Split into chunks of this many lines instead of by tokens")
+	cmd.Flags().IntVar(&askOpts.chunking.Overlap, "chunk-overlap", -1, "Tokens (or lines with --chunk-lines) repeated between chunks (default: a tenth of a chunk)")
+	cmd.Flags().IntVar(&askOpts.chunking.Concurrency, "concurrency", 4, "Chunks processed at once")
+	cmd.MarkFlagsMutuallyExclusive("compare", "chunk")
+	return cmd
+}
+
+// runAsk executes a single shell mode query. With a structured output
+// format, failures are also written to stdout in that format.
+func runAsk(cmd *cobra.Command, opts *globalOptions, askOpts *askOptions, args []string) error {
+	format := askOpts.format
+	err := ask(cmd, opts, askOpts, args, &format)
+	if err != nil && chat.IsStructured(format) && !errors.Is(err, chat.ErrInterrupted) && !errors.Is(err, chat.ErrCompareFailed) {
+		chat.WriteError(os.Stdout, format, err)
+	}
+	return err
+}
+
+// ask runs the query, setting format to the output format once known
+func ask(cmd *cobra.Command, opts *globalOptions, askOpts *askOptions, args []string, format *string) error {
+	cfg, err := newConfig(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	cfg.ShellMode = true
+
+	if cmd.Flags().Changed("format") {
+		cfg.OutputFormat = askOpts.format
+	}
+	if cmd.Flags().Changed("context-length") {
+		cfg.ContextLength = askOpts.contextLength
+	}
+
+	*format = cfg.OutputFormat
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	var targets []providers.Route
+	if askOpts.compare != "" {
+		if targets, err = chat.ParseTargets(askOpts.compare); err != nil {
+			return err
+		}
+	}
+	if askOpts.columns && (targets == nil || cfg.OutputFormat != chat.FormatText) {
+		return fmt.Errorf("--columns needs --compare and the text format")
+	}
+
+	stdinContent, err := chat.ReadStdin()
+	if err != nil {
+		return err
+	}
+
+	var inputs []attach.File
+	if stdinContent != "" {
+		inputs = append(inputs, chat.StdinInput(stdinContent))
+	}
+
+	if len(askOpts.files) > 0 {
+		result, err := attach.Collect(askOpts.files, attach.Limits{MaxFileSize: cfg.AttachMaxFileSize})
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, result.Files...)
+
+		// Report on stderr to keep piped output clean
+		if cfg.Verbose || len(result.Skipped) > 0 || slices.ContainsFunc(result.Files, func(f attach.File) bool { return f.Truncated }) {
+			chat.PrintAttachments(os.Stderr, result)
+		}
+	}
+
+	reg, err := newRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Ctrl+C stops the reply but keeps what was already printed
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	prompt := strings.Join(args, " ")
+
+	if targets != nil {
+		comparison, err := chat.NewComparison(reg, cfg, targets)
+		if err != nil {
+			return err
+		}
+		comparison.SetTags(askOpts.tags)
+		comparison.Columns = askOpts.columns
+		return comparison.Execute(ctx, prompt, inputs)
+	}
+
+	shell, err := chat.NewShellMode(reg, cfg, cfg.DefaultProvider)
+	if err != nil {
+		return err
+	}
+
+	shell.SetTags(askOpts.tags)
+	if askOpts.chunk {
+		return shell.ExecuteChunked(ctx, prompt, inputs, askOpts.chunking)
+	}
+	return shell.Execute(ctx, prompt, inputs)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/assessment"
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// newAssessCmd creates the prompt assessment subcommand
+func newAssessCmd(opts *globalOptions) *cobra.Command {
+	var improve bool
+
+	cmd := &cobra.Command{
+		Use:   "assess [prompt...]",
+		Short: "Score a prompt against prompt engineering criteria",
+		Long: `Analyze a prompt on clarity, specificity, context, structure, constraints,
+output format, role and examples. The prompt is read from the arguments, or
+from stdin when no arguments are given. With --improve the current provider
+rewrites the prompt to address its weaknesses.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := newConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			prompt := strings.Join(args, " ")
+			if prompt == "" {
+				stdinContent, err := chat.ReadStdin()
+				if err != nil {
+					return err
+				}
+				prompt = strings.TrimSpace(stdinContent)
+			}
+
+			if prompt == "" {
+				return fmt.Errorf("no prompt provided")
+			}
+
+			result := assessment.NewAnalyzer().Analyze(prompt)
+			chat.PrintAssessment(result)
+
+			if !improve {
+				return nil
+			}
+
+			reg, err := newRegistry(cfg)
+			if err != nil {
+				return err
+			}
+
+			provider, err := initProvider(reg, cfg)
+			if err != nil {
+				return err
+			}
+
+			ui.PrintInfo("Generating improved version...")
+			improved, err := assessment.NewImprover(provider).Improve(prompt, result)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println()
+			fmt.Println(improved)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&improve, "improve", false, "Ask the provider for an improved version of the prompt")
+	return cmd
+}
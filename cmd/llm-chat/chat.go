@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+)
+
+// chatOptions holds the flags specific to interactive mode
+type chatOptions struct {
+	assess       bool
+	autoImprove  bool
+	resume       string
+	continueLast bool
+
+	contextStrategy string
+	contextLength   int
+}
+
+// newChatCmd creates the interactive chat subcommand
+func newChatCmd(opts *globalOptions) *cobra.Command {
+	chatOpts := &chatOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "chat",
+		Short: "Start an interactive chat session",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd, opts, chatOpts)
+		},
+	}
+
+	addChatFlags(cmd, chatOpts)
+	return cmd
+}
+
+// addChatFlags registers the interactive mode flags on a command
+func addChatFlags(cmd *cobra.Command, chatOpts *chatOptions) {
+	flags := cmd.Flags()
+	flags.BoolVarP(&chatOpts.assess, "assess", "a", false, "Enable prompt assessment")
+	flags.BoolVar(&chatOpts.autoImprove, "auto-improve", false, "Offer prompt improvements automatically")
+	flags.StringVar(&chatOpts.resume, "resume", "", "Resume a saved conversation by ID (or unique ID prefix)")
+	flags.BoolVarP(&chatOpts.continueLast, "continue-last", "c", false, "Resume the most recently saved conversation")
+	cmd.MarkFlagsMutuallyExclusive("resume", "continue-last")
+	flags.StringVar(&chatOpts.contextStrategy, "context-strategy", "", "What to do with messages that no longer fit: sliding, summarize or none")
+	flags.IntVar(&chatOpts.contextLength, "context-length", 0, "Context window size in tokens (default: the model's own)")
+}
+
+// runChat starts an interactive session with the configured provider
+func runChat(cmd *cobra.Command, opts *globalOptions, chatOpts *chatOptions) error {
+	cfg, err := newConfig(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flags().Changed("assess") {
+		cfg.EnableAssessment = chatOpts.assess
+	}
+	if cmd.Flags().Changed("auto-improve") {
+		cfg.AutoImprove = chatOpts.autoImprove
+	}
+	if cmd.Flags().Changed("context-strategy") {
+		cfg.ContextStrategy = chatOpts.contextStrategy
+	}
+	if cmd.Flags().Changed("context-length") {
+		cfg.ContextLength = chatOpts.contextLength
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	resuming := chatOpts.resume != "" || chatOpts.continueLast
+	if resuming && cfg.NoHistory {
+		return fmt.Errorf("cannot resume a conversation with history disabled")
+	}
+
+	reg, err := newRegistry(cfg)
+	if err != nil {
+		return err
+	}
+
+	providerName := cfg.DefaultProvider
+	resumeID := ""
+	if resuming {
+		conv, err := findResumable(cfg, chatOpts.resume)
+		if err != nil {
+			return fmt.Errorf("failed to resume conversation: %w", err)
+		}
+
+		// Start on the conversation's own provider and model
+		providerName = conv.Provider
+		cfg.Model = conv.Model
+		resumeID = conv.ID
+	}
+
+	session, err := chat.NewSession(reg, cfg, providerName)
+	if err != nil {
+		return err
+	}
+
+	if resuming {
+		if err := session.Resume(resumeID); err != nil {
+			return fmt.Errorf("failed to resume conversation: %w", err)
+		}
+	}
+
+	return session.Start()
+}
+
+// findResumable looks up the conversation to resume: the one matching id,
+// or the most recent one if id is empty
+func findResumable(cfg *config.Config, id string) (*history.Conversation, error) {
+	mgr, err := chat.OpenHistory(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer mgr.Close()
+
+	if id == "" {
+		return mgr.Latest()
+	}
+	return mgr.Find(id)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/eval"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+)
+
+// evalOptions holds the flags of the eval subcommand
+type evalOptions struct {
+	targets     string
+	judge       string
+	concurrency int
+	format      string
+	junit       string
+	record      string
+	replay      string
+}
+
+// newEvalCmd creates the prompt regression suite subcommand
+func newEvalCmd(opts *globalOptions) *cobra.Command {
+	evalOpts := &evalOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "eval <suite>",
+		Short: "Run a suite of prompts with expected outputs against providers and models",
+		Long: `Send every case of a suite, a YAML file or a JSONL file of cases, to every
+target and check the replies with contains, regex, equals, json_schema or
+rubric assertions. Rubric assertions are graded by a judge model. Prints
+the failures and a pass rate per target, and exits with status 1 if any
+case failed.
+
+With --record the replies are saved to a file; with --replay they are read
+from it instead of calling the providers, so a suite can run in CI
+without keys or network access.`,
+		Example: `  llm-chat eval prompts.yaml --targets groq:llama-70b,gemini:flash
+  llm-chat eval prompts.yaml --record prompts.recording.jsonl
+  llm-chat eval prompts.yaml --replay prompts.recording.jsonl --junit report.xml`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runEval(cmd, opts, evalOpts, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&evalOpts.targets, "targets", "", "Providers and models to evaluate (provider:model,...; default: the suite's, or the current provider)")
+	cmd.Flags().StringVar(&evalOpts.judge, "judge", "", "Provider and model grading rubric assertions (provider:model; default: the suite's)")
+	cmd.Flags().IntVar(&evalOpts.concurrency, "concurrency", 4, "Requests sent at once")
+	cmd.Flags().StringVarP(&evalOpts.format, "format", "f", "table", "Output format: table, json, junit")
+	cmd.Flags().StringVar(&evalOpts.junit, "junit", "", "Also write a JUnit XML report to this file")
+	cmd.Flags().StringVar(&evalOpts.record, "record", "", "Save the replies to this file for --replay")
+	cmd.Flags().StringVar(&evalOpts.replay, "replay", "", "Answer from replies saved with --record instead of calling the providers")
+	cmd.MarkFlagsMutuallyExclusive("record", "replay")
+	return cmd
+}
+
+// runEval runs a suite and reports on it. It fails if any case failed.
+func runEval(cmd *cobra.Command, opts *globalOptions, evalOpts *evalOptions, path string) error {
+	cfg, err := newConfig(cmd, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	switch evalOpts.format {
+	case "table", "json", "junit":
+	default:
+		return fmt.Errorf("invalid format %q: must be table, json or junit", evalOpts.format)
+	}
+
+	suite, err := eval.Load(path)
+	if err != nil {
+		return err
+	}
+
+	targets := suite.Targets
+	if evalOpts.targets != "" {
+		targets = nil
+		for _, target := range strings.Split(evalOpts.targets, ",") {
+			if target = strings.TrimSpace(target); target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		targets = []string{providers.Route{Provider: cfg.DefaultProvider, Model: cfg.Model}.String()}
+	}
+
+	runner := &eval.Runner{
+		Targets:     providers.ParseRoutes(targets),
+		Concurrency: evalOpts.concurrency,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+	}
+
+	judge := suite.Judge
+	if evalOpts.judge != "" {
+		judge = evalOpts.judge
+	}
+	if judge != "" {
+		route := providers.ParseRoute(judge)
+		runner.Judge = &route
+	}
+
+	var recording *eval.Recording
+	switch {
+	case evalOpts.replay != "":
+		if recording, err = eval.LoadRecording(evalOpts.replay); err != nil {
+			return err
+		}
+		runner.Lookup = recording.Replay
+		runner.Cost = chat.CostPricer(cfg)
+
+	default:
+		reg, err := newRegistry(cfg)
+		if err != nil {
+			return err
+		}
+		runner.Lookup = reg.Get
+		runner.Cost = chat.CostRecorder(cfg)
+
+		if evalOpts.record != "" {
+			recording = eval.NewRecording()
+			runner.Lookup = func(name string) (providers.Provider, error) {
+				provider, err := reg.Get(name)
+				if err != nil {
+					return nil, err
+				}
+				return recording.Record(provider), nil
+			}
+		}
+	}
+
+	if cfg.Verbose {
+		runner.OnResult = func(result eval.CaseResult) {
+			status := "PASS"
+			if !result.Passed {
+				status = "FAIL"
+			}
+			fmt.Fprintf(os.Stderr, "%s %s on %s (%dms)\n", status, result.Case, result.Target, result.LatencyMS)
+		}
+	}
+
+	// Ctrl+C stops the run but reports the cases that finished
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
+
+	report, runErr := runner.Run(ctx, suite)
+	if report == nil {
+		return runErr
+	}
+
+	if evalOpts.record != "" {
+		if err := recording.Save(evalOpts.record); err != nil {
+			return err
+		}
+	}
+
+	if err := writeEvalReport(report, evalOpts); err != nil {
+		return err
+	}
+
+	if runErr != nil {
+		return chat.ErrInterrupted
+	}
+	if failed := report.Failed(); failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(report.Results))
+	}
+	return nil
+}
+
+// writeEvalReport writes the report to stdout in the chosen format, and to
+// the JUnit file if one was asked for
+func writeEvalReport(report *eval.Report, evalOpts *evalOptions) error {
+	var err error
+	switch evalOpts.format {
+	case "json":
+		err = report.WriteJSON(os.Stdout)
+	case "junit":
+		err = report.WriteJUnit(os.Stdout)
+	default:
+		err = report.WriteTable(os.Stdout)
+	}
+	if err != nil || evalOpts.junit == "" {
+		return err
+	}
+
+	file, err := os.Create(evalOpts.junit)
+	if err != nil {
+		return fmt.Errorf("failed to write JUnit report: %w", err)
+	}
+	if err := report.WriteJUnit(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+)
+
+// Exit codes, documented in the README. Provider failures exit with the
+// code of their class so that scripts can tell them apart.
+const (
+	exitError       = 1
+	exitInterrupted = 130
+)
+
+var exitCodes = map[providers.ErrorClass]int{
+	providers.ClassAuth:            2,
+	providers.ClassRateLimited:     3,
+	providers.ClassQuota:           4,
+	providers.ClassContextLength:   5,
+	providers.ClassContentFiltered: 6,
+	providers.ClassUnavailable:     7,
+	providers.ClassTimeout:         8,
+	providers.ClassBadRequest:      9,
+}
+
+// exitCode returns the process exit code for err
+func exitCode(err error) int {
+	if errors.Is(err, chat.ErrInterrupted) {
+		return exitInterrupted
+	}
+	if code, ok := exitCodes[providers.ClassOf(err)]; ok {
+		return code
+	}
+	return exitError
+}
+
+// printError writes err for people, then, for provider failures, a line
+// for programs giving its class, whether it is retryable and the exit code
+func printError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error: %v\n", err)
+
+	class := providers.ClassOf(err)
+	if class != providers.ClassUnknown {
+		fmt.Fprintf(w, "error_class=%s retryable=%t exit_code=%d\n", class, class.Retryable(), exitCode(err))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// newHistoryCmd creates the history subcommand and its children
+func newHistoryCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List, search and export saved conversations",
+	}
+
+	cmd.AddCommand(
+		newHistoryListCmd(opts),
+		newHistoryShowCmd(opts),
+		newHistorySearchCmd(opts),
+		newHistoryTagCmd(opts),
+		newHistoryExportCmd(opts),
+		newHistoryPruneCmd(opts),
+		newHistoryClearCmd(opts),
+	)
+
+	return cmd
+}
+
+// openHistory validates the configuration and opens the history store
+func openHistory(cmd *cobra.Command, opts *globalOptions) (*history.Manager, error) {
+	cfg, err := newConfig(cmd, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return chat.OpenHistory(cfg)
+}
+
+func newHistoryListCmd(opts *globalOptions) *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Show recent saved conversations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			chat.PrintSavedConversations(mgr.GetRecent(limit))
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 10, "Number of conversations to show (0 for all)")
+	return cmd
+}
+
+func newHistoryShowCmd(opts *globalOptions) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Print a saved conversation",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			conv, err := mgr.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			content, _, err := mgr.Render(conv, format)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(content)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "txt", "Output format: markdown, json, txt")
+	return cmd
+}
+
+func newHistorySearchCmd(opts *globalOptions) *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "search <query>",
+		Short: "Search through saved conversations",
+		Long: `Search through saved conversations. Results are ranked by relevance.
+
+Query syntax:
+  error handling         conversations containing both words
+  "error handling"       the exact phrase
+  retry OR backoff       either word (AND binds tighter than OR)
+  -python, NOT python    exclude conversations containing a word
+
+Filters:
+  provider:<name>  model:<name>  role:<user|assistant|system>  tag:<name>
+  after:<YYYY-MM-DD>  before:<YYYY-MM-DD>`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			query := strings.Join(args, " ")
+			results, err := mgr.Search(query)
+			if err != nil {
+				return err
+			}
+
+			chat.PrintSearchResults(results, query, limit)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Maximum number of results to show (0 for all)")
+	return cmd
+}
+
+func newHistoryTagCmd(opts *globalOptions) *cobra.Command {
+	var remove []string
+
+	cmd := &cobra.Command{
+		Use:   "tag <id> [tags...]",
+		Short: "Show or change the tags of a saved conversation",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			conv, err := mgr.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			tags := append([]string{}, conv.Tags...)
+			for _, tag := range remove {
+				tag = strings.ToLower(tag)
+				tags = slices.DeleteFunc(tags, func(t string) bool { return t == tag })
+			}
+			for _, tag := range args[1:] {
+				tag = strings.ToLower(tag)
+				if !slices.Contains(tags, tag) {
+					tags = append(tags, tag)
+				}
+			}
+
+			if len(args) > 1 || len(remove) > 0 {
+				if err := mgr.SetTags(conv.ID, tags); err != nil {
+					return err
+				}
+			}
+
+			if len(tags) == 0 {
+				fmt.Println("(no tags)")
+			} else {
+				fmt.Println(strings.Join(tags, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&remove, "remove", "r", nil, "Tags to remove (repeatable)")
+	return cmd
+}
+
+func newHistoryExportCmd(opts *globalOptions) *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "export <id>",
+		Short: "Export a saved conversation to a file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			filePath, err := mgr.Export(args[0], format)
+			if err != nil {
+				return err
+			}
+
+			ui.PrintSuccess(fmt.Sprintf("Conversation exported to: %s", filePath))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "markdown", "Export format: markdown, json, txt")
+	return cmd
+}
+
+func newHistoryPruneCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "prune",
+		Short: "Apply the retention policy to saved conversations now",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			pruned, err := mgr.Prune()
+			if err != nil {
+				return err
+			}
+
+			ui.PrintSuccess(fmt.Sprintf("Pruned %d conversation(s) from %s", pruned, mgr.Path()))
+			return nil
+		},
+	}
+}
+
+func newHistoryClearCmd(opts *globalOptions) *cobra.Command {
+	var yes bool
+
+	cmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Delete all saved conversations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !yes {
+				return fmt.Errorf("refusing to clear history without --yes")
+			}
+
+			mgr, err := openHistory(cmd, opts)
+			if err != nil {
+				return err
+			}
+			defer mgr.Close()
+
+			if err := mgr.Clear(); err != nil {
+				return err
+			}
+
+			ui.PrintSuccess("History cleared")
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&yes, "yes", false, "Confirm deleting all history")
+	return cmd
+}
@@ -0,0 +1,144 @@
+// Command llm-chat is a terminal client for chatting with multiple LLM providers.
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/registry"
+)
+
+// Build information, set via -ldflags by the Makefile
+var (
+	version   = "0.1.0"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		printError(os.Stderr, err)
+		os.Exit(exitCode(err))
+	}
+}
+
+// newRegistry creates a registry with every built-in provider and the
+// endpoints defined in the config file registered
+func newRegistry(cfg *config.Config) (*registry.Registry, error) {
+	reg := registry.New()
+
+	builtins := []struct {
+		provider providers.Provider
+		metadata providers.Metadata
+	}{
+		{providers.NewOllamaProvider(), providers.GetOllamaMetadata()},
+		{providers.NewGroqProvider(), providers.GetGroqMetadata()},
+		{providers.NewTogetherProvider(), providers.GetTogetherMetadata()},
+		{providers.NewSambaProvider(), providers.GetSambaMetadata()},
+		{providers.NewGeminiProvider(), providers.GetGeminiMetadata()},
+		{providers.NewOpenAIProvider(), providers.GetOpenAIMetadata()},
+		{providers.NewAnthropicProvider(), providers.GetAnthropicMetadata()},
+	}
+
+	policy := retryPolicy(cfg)
+
+	for _, b := range builtins {
+		if err := reg.Register(providers.WithRetry(b.provider, policy), b.metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Endpoints))
+	for name := range cfg.Endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		spec := endpointSpec(name, cfg.Endpoints[name])
+		provider := providers.WithRetry(providers.NewOpenAICompatProvider(spec), policy)
+		if err := reg.Register(provider, spec.Metadata()); err != nil {
+			return nil, fmt.Errorf("endpoint %s: %w", name, err)
+		}
+	}
+
+	if cfg.Router != nil {
+		router := newRouter(cfg.Router, reg)
+		if err := reg.Register(router, providers.RouterMetadata()); err != nil {
+			return nil, err
+		}
+	}
+
+	return reg, nil
+}
+
+// newRouter creates the router over the providers of reg, reporting each
+// fallback on stderr
+func newRouter(r *config.Router, reg *registry.Registry) *providers.Router {
+	rules := make([]providers.RouterRule, len(r.Rules))
+	for i, rule := range r.Rules {
+		rules[i] = providers.RouterRule{
+			Mode:      rule.Mode,
+			Tag:       rule.Tag,
+			MinTokens: rule.MinTokens,
+			MaxTokens: rule.MaxTokens,
+			Chain:     providers.ParseRoutes(rule.Chain),
+		}
+	}
+
+	router := providers.NewRouter(providers.ParseRoutes(r.Chain), rules, reg.Get)
+	router.OnFallback = func(failed providers.Route, err error, next providers.Route) {
+		fmt.Fprintf(os.Stderr, "Warning: %s failed (%s); falling back to %s\n", failed, providers.ClassOf(err), next)
+	}
+	return router
+}
+
+// retryPolicy returns the configured retry limits, reporting each retry
+// on stderr
+func retryPolicy(cfg *config.Config) providers.RetryPolicy {
+	return providers.RetryPolicy{
+		MaxAttempts: cfg.RetryMaxAttempts,
+		BaseDelay:   cfg.RetryBaseDelay,
+		MaxDelay:    cfg.RetryMaxDelay,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			fmt.Fprintf(os.Stderr, "Warning: %s (%s); retrying in %s (attempt %d of %d)\n",
+				providers.ClassOf(err), err, delay.Round(100*time.Millisecond), attempt, cfg.RetryMaxAttempts)
+		},
+	}
+}
+
+// endpointSpec converts a config file endpoint to a provider spec
+func endpointSpec(name string, e config.Endpoint) providers.OpenAICompatSpec {
+	headers := make(map[string]string, len(e.Headers))
+	for key, value := range e.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+
+	model := e.Model
+	if model == "" {
+		// Fall back to the first alias so the choice is stable
+		aliases := make([]string, 0, len(e.Models))
+		for alias := range e.Models {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		model = aliases[0]
+	}
+
+	return providers.OpenAICompatSpec{
+		Name:         name,
+		DisplayName:  e.DisplayName,
+		Description:  e.Description,
+		BaseURL:      e.BaseURL,
+		APIKey:       os.ExpandEnv(e.APIKey),
+		APIKeyEnv:    e.APIKeyEnv,
+		RequiresAPI:  e.APIKeyEnv != "" && e.APIKey == "",
+		DefaultModel: model,
+		Models:       e.Models,
+		Headers:      headers,
+	}
+}
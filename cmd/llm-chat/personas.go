@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/persona"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// newPersonasCmd creates the subcommand listing the persona library
+func newPersonasCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "personas",
+		Short: "List the personas in the persona library",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Load the config file directly: a missing persona must not
+			// prevent listing the ones that exist
+			cfg, err := config.Load(opts.configPath, opts.profile)
+			if err != nil {
+				return err
+			}
+
+			library := persona.NewLibrary(cfg.PersonaDir)
+			// A broken persona file is reported without hiding the others
+			personas, err := library.List()
+			if personas == nil {
+				return err
+			}
+			if err != nil {
+				ui.PrintWarning(err.Error())
+			}
+
+			chat.PrintPersonas(library.Dir(), personas, cfg.Persona)
+			return nil
+		},
+	}
+}
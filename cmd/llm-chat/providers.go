@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/registry"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// newProvidersCmd creates the subcommand listing every provider
+func newProvidersCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "providers",
+		Short: "List all providers and whether they are configured",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := newConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			reg, err := newRegistry(cfg)
+			if err != nil {
+				return err
+			}
+
+			chat.PrintProviders(reg)
+			return nil
+		},
+	}
+}
+
+// newModelsCmd creates the subcommand listing a provider's models
+func newModelsCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "models",
+		Short: "List the models offered by the selected provider",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := newConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			reg, err := newRegistry(cfg)
+			if err != nil {
+				return err
+			}
+
+			provider, err := reg.Get(cfg.DefaultProvider)
+			if err != nil {
+				return err
+			}
+
+			if !provider.IsAvailable() {
+				return fmt.Errorf("provider %s is not available", cfg.DefaultProvider)
+			}
+
+			fmt.Println(ui.FormatModelList(provider.Models(), provider.DefaultModel()))
+			return nil
+		},
+	}
+}
+
+// initProvider looks up the configured provider and initializes it
+func initProvider(reg *registry.Registry, cfg *config.Config) (providers.Provider, error) {
+	provider, err := reg.Get(cfg.DefaultProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get provider: %w", err)
+	}
+
+	if !provider.IsAvailable() {
+		return nil, fmt.Errorf("provider %s is not available", cfg.DefaultProvider)
+	}
+
+	model := cfg.Model
+	if model == "" {
+		model = provider.DefaultModel()
+	}
+
+	providerCfg := providers.Config{
+		Model:       model,
+		Temperature: cfg.Temperature,
+		MaxTokens:   cfg.MaxTokens,
+	}
+
+	if err := provider.Initialize(providerCfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize provider: %w", err)
+	}
+
+	return provider, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/persona"
+)
+
+// globalOptions holds the flags shared by every subcommand
+type globalOptions struct {
+	configPath  string
+	profile     string
+	provider    string
+	model       string
+	temperature float64
+	maxTokens   int
+	verbose     bool
+	noHistory   bool
+	historyPath string
+	system      string
+	systemFile  string
+	persona     string
+}
+
+// newRootCmd builds the llm-chat command tree
+func newRootCmd() *cobra.Command {
+	opts := &globalOptions{}
+	chatOpts := &chatOptions{}
+
+	root := &cobra.Command{
+		Use:   "llm-chat",
+		Short: "Chat with multiple LLM providers from the terminal",
+		Long: `llm-chat is a terminal client for Ollama, OpenAI, Anthropic, Groq,
+Together AI, SambaNova, Google Gemini and any OpenAI-compatible endpoint.
+Running it without a subcommand starts an interactive chat.`,
+		Version:       fmt.Sprintf("%s (commit %s, built %s)", version, commit, buildDate),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		Args:          cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runChat(cmd, opts, chatOpts)
+		},
+	}
+
+	addGlobalFlags(root, opts)
+
+	addChatFlags(root, chatOpts)
+
+	root.AddCommand(
+		newChatCmd(opts),
+		newAskCmd(opts),
+		newHistoryCmd(opts),
+		newAssessCmd(opts),
+		newProvidersCmd(opts),
+		newModelsCmd(opts),
+		newPersonasCmd(opts),
+		newStatsCmd(opts),
+		newEvalCmd(opts),
+	)
+
+	return root
+}
+
+// addGlobalFlags registers the flags shared by every subcommand
+func addGlobalFlags(cmd *cobra.Command, opts *globalOptions) {
+	defaults := config.Default()
+
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&opts.configPath, "config", "", "Config file (default ~/.llm-chat/config.yaml)")
+	flags.StringVar(&opts.profile, "profile", "", "Config file profile to use")
+	flags.StringVarP(&opts.provider, "provider", "p", defaults.DefaultProvider, "LLM provider to use")
+	flags.StringVar(&opts.model, "model", "", "Specific model to use (default: the provider's default)")
+	flags.Float64VarP(&opts.temperature, "temperature", "t", defaults.Temperature, "Temperature 0.0-2.0")
+	flags.IntVarP(&opts.maxTokens, "max-tokens", "m", defaults.MaxTokens, "Maximum tokens in the response")
+	flags.BoolVarP(&opts.verbose, "verbose", "v", defaults.Verbose, "Show detailed metrics")
+	flags.BoolVar(&opts.noHistory, "no-history", defaults.NoHistory, "Don't save the conversation")
+	flags.StringVar(&opts.historyPath, "history-path", "", "History file, or a directory for per-project histories")
+	flags.StringVar(&opts.system, "system", "", "System prompt for the conversation")
+	flags.StringVar(&opts.systemFile, "system-file", "", "Read the system prompt from a file")
+	flags.StringVar(&opts.persona, "persona", "", "Use a named persona from ~/.llm-chat/personas")
+	cmd.MarkFlagsMutuallyExclusive("system", "system-file", "persona")
+}
+
+// newConfig builds a configuration from the defaults, the selected config
+// file profile, the environment and any global flags the user set
+// explicitly, in increasing precedence. Callers apply their own flags and
+// then Validate.
+func newConfig(cmd *cobra.Command, opts *globalOptions) (*config.Config, error) {
+	cfg, err := config.Load(opts.configPath, opts.profile)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := cmd.Flags()
+
+	// A model from the environment or a profile belongs to its provider,
+	// so another provider on the command line uses its own default model
+	// unless --model is given too
+	if flags.Changed("provider") && opts.provider != cfg.DefaultProvider {
+		cfg.DefaultProvider = opts.provider
+		cfg.Model = ""
+	}
+	if flags.Changed("model") {
+		cfg.Model = opts.model
+	}
+	if flags.Changed("temperature") {
+		cfg.Temperature = opts.temperature
+	}
+	if flags.Changed("max-tokens") {
+		cfg.MaxTokens = opts.maxTokens
+	}
+	if flags.Changed("verbose") {
+		cfg.Verbose = opts.verbose
+	}
+	if flags.Changed("no-history") {
+		cfg.NoHistory = opts.noHistory
+	}
+	if flags.Changed("history-path") {
+		cfg.HistoryPath = config.ExpandHome(opts.historyPath)
+	}
+	if flags.Changed("system") {
+		cfg.SystemPrompt = opts.system
+		cfg.Persona = ""
+	}
+	if flags.Changed("system-file") {
+		data, err := os.ReadFile(config.ExpandHome(opts.systemFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read system prompt: %w", err)
+		}
+		cfg.SystemPrompt = strings.TrimSpace(string(data))
+		cfg.Persona = ""
+	}
+	if flags.Changed("persona") {
+		cfg.Persona = opts.persona
+	}
+
+	// A persona from any layer supplies the system prompt
+	if cfg.Persona != "" {
+		p, err := persona.NewLibrary(cfg.PersonaDir).Load(cfg.Persona)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SystemPrompt = p.Prompt
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestNewConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := "default_profile: work\nprofiles:\n  work: {provider: anthropic, model: claude-haiku-4-5, temperature: 0.2, system_prompt: From the profile}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reviewer.md"), []byte("Review the code"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		provider    string
+		model       string
+		temperature float64
+		system      string
+	}{
+		{"profile", nil, nil, "anthropic", "claude-haiku-4-5", 0.2, "From the profile"},
+		{"environment over profile", nil, map[string]string{"LLM_CHAT_TEMPERATURE": "1", "LLM_CHAT_SYSTEM_PROMPT": "From the environment"}, "anthropic", "claude-haiku-4-5", 1, "From the environment"},
+		{"flag over environment", []string{"-t", "0", "--system", "From a flag"}, map[string]string{"LLM_CHAT_TEMPERATURE": "1", "LLM_CHAT_SYSTEM_PROMPT": "From the environment"}, "anthropic", "claude-haiku-4-5", 0, "From a flag"},
+		{"flag model over environment model", []string{"--model", "claude-opus-4-1"}, map[string]string{"LLM_CHAT_MODEL": "claude-sonnet-4-5"}, "anthropic", "claude-opus-4-1", 0.2, "From the profile"},
+		{"flag provider drops the environment's model", []string{"-p", "openai"}, map[string]string{"LLM_CHAT_MODEL": "claude-sonnet-4-5"}, "openai", "", 0.2, "From the profile"},
+		{"flag provider and model", []string{"-p", "openai", "--model", "gpt-4o"}, nil, "openai", "gpt-4o", 0.2, "From the profile"},
+		{"flag provider matching the profile", []string{"-p", "anthropic"}, nil, "anthropic", "claude-haiku-4-5", 0.2, "From the profile"},
+		{"flag at its default still overrides", []string{"-t", "0.7"}, map[string]string{"LLM_CHAT_TEMPERATURE": "1"}, "anthropic", "claude-haiku-4-5", 0.7, "From the profile"},
+		{"persona flag over system prompt", []string{"--persona", "reviewer"}, map[string]string{"LLM_CHAT_SYSTEM_PROMPT": "From the environment"}, "anthropic", "claude-haiku-4-5", 0.2, "Review the code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LLM_CHAT_PERSONA_DIR", dir)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			opts := &globalOptions{}
+			cmd := &cobra.Command{}
+			addGlobalFlags(cmd, opts)
+			if err := cmd.ParseFlags(append([]string{"--config", path}, tt.args...)); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := newConfig(cmd, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.DefaultProvider != tt.provider || cfg.Model != tt.model {
+				t.Errorf("provider %s, model %q; want %s, %q", cfg.DefaultProvider, cfg.Model, tt.provider, tt.model)
+			}
+			if cfg.Temperature != tt.temperature || cfg.SystemPrompt != tt.system {
+				t.Errorf("temperature %v, system prompt %q; want %v, %q", cfg.Temperature, cfg.SystemPrompt, tt.temperature, tt.system)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/chat"
+	"github.com/soyomarvaldezg/llm-chat/internal/cost"
+)
+
+// newStatsCmd creates the subcommand reporting spend from the usage ledger
+func newStatsCmd(opts *globalOptions) *cobra.Command {
+	var days int
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show token usage and spend by day, provider and model",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := newConfig(cmd, opts)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			since := time.Time{}
+			title := "Spend (all time)"
+			if days > 0 {
+				since = time.Now().AddDate(0, 0, -days)
+				title = fmt.Sprintf("Spend (last %d days)", days)
+			}
+
+			ledger := cost.NewLedger(cfg.UsagePath)
+			entries, err := ledger.Entries(since)
+			if err != nil {
+				return err
+			}
+
+			chat.PrintSpend(cost.Summarize(entries), title, chat.NewBudget(cfg), ledger)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&days, "days", "d", 30, "Number of days to report (0 for all)")
+	return cmd
+}
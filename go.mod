@@ -3,17 +3,20 @@ module github.com/soyomarvaldezg/llm-chat
 go 1.25
 
 require (
+	cloud.google.com/go/ai v0.8.0
 	github.com/fatih/color v1.18.0
 	github.com/google/generative-ai-go v0.20.1
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/ollama/ollama v0.5.4
 	github.com/sashabaranov/go-openai v1.41.2
 	github.com/spf13/cobra v1.8.1
+	golang.org/x/sys v0.36.0
 	google.golang.org/api v0.251.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	cloud.google.com/go v0.115.0 // indirect
-	cloud.google.com/go/ai v0.8.0 // indirect
 	cloud.google.com/go/auth v0.16.5 // indirect
 	cloud.google.com/go/auth/oauth2adapt v0.2.8 // indirect
 	cloud.google.com/go/compute/metadata v0.9.0 // indirect
@@ -39,7 +42,6 @@ require (
 	golang.org/x/net v0.44.0 // indirect
 	golang.org/x/oauth2 v0.31.0 // indirect
 	golang.org/x/sync v0.17.0 // indirect
-	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.29.0 // indirect
 	golang.org/x/time v0.13.0 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20250707201910-8d1bb00bc6a7 // indirect
@@ -39,7 +39,7 @@ func (i *Improver) Improve(originalPrompt string, assessment *Assessment) (strin
 	// Create chat request
 	req := models.ChatRequest{
 		Messages:    []models.Message{message},
-		Temperature: 0.7,
+		Temperature: models.Temperature(0.7),
 		MaxTokens:   2000,
 		Stream:      false,
 	}
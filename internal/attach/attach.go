@@ -0,0 +1,401 @@
+// Package attach reads local files into prompts, each fenced with its path
+// and a language hint.
+package attach
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+)
+
+// DefaultMaxFileSize is the size beyond which a file is truncated
+const DefaultMaxFileSize = 256 << 10
+
+// minTokens is the smallest share of a file worth attaching once the token
+// limit forces it to be cut
+const minTokens = 64
+
+// sniffSize is how much of a file is checked for binary content
+const sniffSize = 8000
+
+// Limits bound how much is attached
+type Limits struct {
+	MaxFileSize int64 // bytes read from each file, 0 for DefaultMaxFileSize
+	MaxTokens   int   // estimated tokens of all files together, 0 for no limit
+}
+
+// File is an attached file
+type File struct {
+	Path      string
+	Language  string
+	Content   string
+	Size      int64 // size of the whole file in bytes
+	Tokens    int   // estimated tokens of Content
+	Truncated bool
+}
+
+// Skipped is a file that was not attached
+type Skipped struct {
+	Path   string
+	Reason string
+}
+
+// Result lists what a Collect call attached and skipped
+type Result struct {
+	Files   []File
+	Skipped []Skipped
+}
+
+// Tokens returns the estimated tokens of all attached files
+func (r *Result) Tokens() int {
+	total := 0
+	for _, f := range r.Files {
+		total += f.Tokens
+	}
+	return total
+}
+
+// Collect reads the files named by paths, which may be files, directories
+// or glob patterns with "**" for any number of directories. Directories
+// and globs skip files excluded by .gitignore; a file named explicitly is
+// always read. Binary files and globs matching nothing are skipped, and
+// files are truncated to stay within the limits.
+func Collect(paths []string, limits Limits) (*Result, error) {
+	if limits.MaxFileSize <= 0 {
+		limits.MaxFileSize = DefaultMaxFileSize
+	}
+
+	c := &collector{
+		limits: limits,
+		result: &Result{},
+		seen:   make(map[string]bool),
+	}
+
+	for _, p := range paths {
+		if err := c.add(config.ExpandHome(p)); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.result, nil
+}
+
+// collector accumulates files for Collect
+type collector struct {
+	limits Limits
+	result *Result
+	seen   map[string]bool
+	tokens int
+}
+
+// add attaches the files named by one path or pattern
+func (c *collector) add(p string) error {
+	if hasMeta(p) {
+		return c.addGlob(p)
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("cannot attach %s: %w", p, err)
+	}
+
+	if info.IsDir() {
+		_, err := c.walk(p, func(string) bool { return true }, newIgnorer(p))
+		return err
+	}
+
+	c.addFile(p, info.Size())
+	return nil
+}
+
+// addGlob attaches the files matching a pattern
+func (c *collector) addGlob(pattern string) error {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+
+	// Walk from the longest directory prefix without glob characters
+	segments := strings.Split(pattern, "/")
+	static := 0
+	for static < len(segments)-1 && !hasMeta(segments[static]) {
+		static++
+	}
+	base := strings.Join(segments[:static], "/")
+	rest := strings.Join(segments[static:], "/")
+	if base == "" {
+		base = "."
+		if strings.HasPrefix(pattern, "/") {
+			base = "/"
+		}
+	}
+
+	matched, err := c.walk(filepath.FromSlash(base), func(rel string) bool {
+		return matchPath(rest, rel)
+	}, newIgnorer(base))
+	if err != nil {
+		return err
+	}
+
+	// A pattern matching nothing is reported rather than failing the
+	// other paths
+	if matched == 0 {
+		c.result.Skipped = append(c.result.Skipped, Skipped{Path: pattern, Reason: "no files match"})
+	}
+	return nil
+}
+
+// walk attaches the files under dir whose slash-separated path relative to
+// dir satisfies match, skipping ignored files and directories. It returns
+// how many files matched.
+func (c *collector) walk(dir string, match func(rel string) bool, ig *ignorer) (int, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.result.Skipped = append(c.result.Skipped, Skipped{Path: p, Reason: err.Error()})
+			return nil
+		}
+		if p == dir {
+			return nil
+		}
+
+		if ig.ignored(p, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err == nil && match(filepath.ToSlash(rel)) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot read %s: %w", dir, err)
+	}
+
+	sort.Strings(files)
+	for _, p := range files {
+		info, err := os.Stat(p)
+		if err != nil {
+			c.result.Skipped = append(c.result.Skipped, Skipped{Path: p, Reason: err.Error()})
+			continue
+		}
+		c.addFile(p, info.Size())
+	}
+	return len(files), nil
+}
+
+// addFile reads one file, recording it as attached or skipped
+func (c *collector) addFile(p string, size int64) {
+	key, err := filepath.Abs(p)
+	if err != nil {
+		key = p
+	}
+	if c.seen[key] {
+		return
+	}
+	c.seen[key] = true
+
+	skip := func(reason string) {
+		c.result.Skipped = append(c.result.Skipped, Skipped{Path: p, Reason: reason})
+	}
+
+	remaining := c.limits.MaxTokens - c.tokens
+	if c.limits.MaxTokens > 0 && remaining < minTokens {
+		skip("token limit reached")
+		return
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		skip(err.Error())
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, c.limits.MaxFileSize))
+	file.Close()
+	if err != nil {
+		skip(err.Error())
+		return
+	}
+
+	truncated := size > int64(len(data))
+	if truncated {
+		// Cut at a line boundary, or for a file without one at the last
+		// whole character, so a split character is not taken for binary
+		if i := bytes.LastIndexByte(data, '\n'); i > 0 {
+			data = data[:i+1]
+		} else {
+			data = trimPartialRune(data)
+		}
+	}
+
+	if isBinary(data) {
+		skip("binary file")
+		return
+	}
+
+	content := string(data)
+	tokens := contextwindow.EstimateTokens(content)
+	if c.limits.MaxTokens > 0 && tokens > remaining {
+		content, tokens = truncateTokens(content, remaining)
+		truncated = true
+	}
+
+	c.tokens += tokens
+	c.result.Files = append(c.result.Files, File{
+		Path:      p,
+		Language:  Language(p),
+		Content:   content,
+		Size:      size,
+		Tokens:    tokens,
+		Truncated: truncated,
+	})
+}
+
+// trimPartialRune drops a character cut short at the end of data
+func trimPartialRune(data []byte) []byte {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	return data
+}
+
+// isBinary reports whether data looks like something other than text
+func isBinary(data []byte) bool {
+	sniff := data[:min(len(data), sniffSize)]
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return true
+	}
+	return !utf8.Valid(data)
+}
+
+// truncateTokens keeps the leading lines of text that fit in budget tokens
+func truncateTokens(text string, budget int) (string, int) {
+	var kept strings.Builder
+	tokens := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		n := contextwindow.EstimateTokens(line)
+		if tokens+n > budget {
+			break
+		}
+		kept.WriteString(line)
+		tokens += n
+	}
+	return kept.String(), tokens
+}
+
+// Fence returns the file as a fenced code block whose info string gives
+// the language and path, followed by a note if it was truncated
+func (f File) Fence() string {
+	// The fence must be longer than any run of backticks in the content
+	fence := "```"
+	for strings.Contains(f.Content, fence) {
+		fence += "`"
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s%s %s\n", fence, f.Language, filepath.ToSlash(f.Path))
+	sb.WriteString(f.Content)
+	if !strings.HasSuffix(f.Content, "\n") {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(fence)
+	if f.Truncated {
+		fmt.Fprintf(&sb, "\n(%s was truncated: %d of %d bytes included)", filepath.ToSlash(f.Path), len(f.Content), f.Size)
+	}
+	return sb.String()
+}
+
+// Format returns the fenced blocks of every attached file
+func (r *Result) Format() string {
+	blocks := make([]string, len(r.Files))
+	for i, f := range r.Files {
+		blocks[i] = f.Fence()
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// languages maps file extensions to the language hint of their fence
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".php":   "php",
+	".sh":    "bash",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".scss":  "scss",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".md":    "markdown",
+	".proto": "protobuf",
+	".tf":    "hcl",
+	".lua":   "lua",
+	".r":     "r",
+	".scala": "scala",
+	".ex":    "elixir",
+	".exs":   "elixir",
+	".erl":   "erlang",
+	".hs":    "haskell",
+	".vue":   "vue",
+	".txt":   "text",
+	".log":   "text",
+}
+
+// names maps well-known file names without a telling extension
+var names = map[string]string{
+	"Makefile":   "makefile",
+	"Dockerfile": "dockerfile",
+	"go.mod":     "go",
+	"Gemfile":    "ruby",
+}
+
+// Language returns the fence language hint for a file, or "text"
+func Language(p string) string {
+	if lang, ok := names[filepath.Base(p)]; ok {
+		return lang
+	}
+	if lang, ok := languages[strings.ToLower(filepath.Ext(p))]; ok {
+		return lang
+	}
+	return "text"
+}
@@ -0,0 +1,193 @@
+package attach
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// paths returns the paths of attached files relative to dir, joined by
+// commas
+func paths(t *testing.T, dir string, files []File) string {
+	t.Helper()
+	var out []string
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, filepath.ToSlash(rel))
+	}
+	return strings.Join(out, ",")
+}
+
+// skipped returns the reason each path was skipped, by base name
+func skipped(result *Result) map[string]string {
+	reasons := make(map[string]string)
+	for _, s := range result.Skipped {
+		reasons[filepath.Base(s.Path)] = s.Reason
+	}
+	return reasons
+}
+
+func TestCollectTruncation(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"lines.txt": strings.Repeat("0123456789\n", 20),
+		"accents":   strings.Repeat("é", 1000),
+		"emoji":     strings.Repeat("🙂", 1000),
+		"small.txt": "short\n",
+	})
+
+	tests := []struct {
+		name string
+		size int64
+		want string
+	}{
+		{"cut at the last whole line", 105, strings.Repeat("0123456789\n", 9)},
+		{"no newline cut mid-character", 1001, strings.Repeat("é", 500)},
+		{"four-byte characters", 1002, strings.Repeat("🙂", 250)},
+		{"under the limit", 1 << 10, "short\n"},
+	}
+	files := []string{"lines.txt", "accents", "emoji", "small.txt"}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := filepath.Join(dir, files[i])
+			result, err := Collect([]string{p}, Limits{MaxFileSize: tt.size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Files) != 1 {
+				t.Fatalf("attached %d files, skipped %+v", len(result.Files), result.Skipped)
+			}
+
+			f := result.Files[0]
+			if f.Content != tt.want || !utf8.ValidString(f.Content) {
+				t.Errorf("content = %q", f.Content)
+			}
+			info, _ := os.Stat(p)
+			if f.Truncated != (info.Size() > tt.size) || f.Size != info.Size() {
+				t.Errorf("truncated %v, size %d of %d", f.Truncated, f.Size, info.Size())
+			}
+		})
+	}
+}
+
+func TestCollectTokenLimit(t *testing.T) {
+	dir := t.TempDir()
+	line := strings.Repeat("x", 39) + "\n" // 10 tokens
+	writeFiles(t, dir, map[string]string{
+		"a.txt": strings.Repeat(line, 10),
+		"b.txt": strings.Repeat(line, 10),
+		"c.txt": strings.Repeat(line, 10),
+	})
+
+	// The second file is cut to what is left, and the third has no room
+	result, err := Collect([]string{filepath.Join(dir, "*.txt")}, Limits{MaxTokens: 170})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(t, dir, result.Files); got != "a.txt,b.txt" {
+		t.Fatalf("attached %s", got)
+	}
+	b := result.Files[1]
+	if !b.Truncated || b.Tokens != 70 || b.Content != strings.Repeat(line, 7) {
+		t.Errorf("b.txt truncated %v to %d tokens", b.Truncated, b.Tokens)
+	}
+	if result.Tokens() != 170 {
+		t.Errorf("total %d tokens, want 170", result.Tokens())
+	}
+	if reason := skipped(result)["c.txt"]; reason != "token limit reached" {
+		t.Errorf("c.txt skipped for %q", reason)
+	}
+}
+
+func TestCollectBinary(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"image.png":   "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"latin1.txt":  "caf\xe9\n",
+		"utf8.txt":    "café ☕\n",
+		"late-nul.go": strings.Repeat("a", sniffSize) + "\x00",
+	})
+
+	result, err := Collect([]string{dir}, Limits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(t, dir, result.Files); got != "late-nul.go,utf8.txt" {
+		t.Errorf("attached %s, want the text files", got)
+	}
+	reasons := skipped(result)
+	for _, name := range []string{"image.png", "latin1.txt"} {
+		if reasons[name] != "binary file" {
+			t.Errorf("%s skipped for %q", name, reasons[name])
+		}
+	}
+}
+
+func TestCollectGlobs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, map[string]string{
+		".gitignore":          "vendor/\n*_gen.go\n",
+		"main.go":             "package main\n",
+		"internal/a/a.go":     "package a\n",
+		"internal/a/a_gen.go": "package a\n",
+		"vendor/dep/dep.go":   "package dep\n",
+		"README.md":           "# readme\n",
+	})
+
+	tests := []struct {
+		name     string
+		paths    []string
+		want     string
+		skipped  string
+		hasError bool
+	}{
+		{"recursive glob", []string{"**/*.go"}, "internal/a/a.go,main.go", "", false},
+		{"static prefix", []string{"internal/**/*.go"}, "internal/a/a.go", "", false},
+		{"named explicitly despite .gitignore", []string{"vendor/dep/dep.go"}, "vendor/dep/dep.go", "", false},
+		{"duplicates attached once", []string{"main.go", "*.go"}, "main.go", "", false},
+		{"glob matching nothing", []string{"*.rs", "README.md"}, "README.md", "*.rs", false},
+		{"missing file", []string{"missing.go"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var full []string
+			for _, p := range tt.paths {
+				full = append(full, filepath.Join(dir, p))
+			}
+			result, err := Collect(full, Limits{})
+			if tt.hasError {
+				if err == nil {
+					t.Error("no error for a missing file")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := paths(t, dir, result.Files); got != tt.want {
+				t.Errorf("attached %s, want %s", got, tt.want)
+			}
+			if tt.skipped != "" && skipped(result)[tt.skipped] != "no files match" {
+				t.Errorf("skipped %+v, want %s reported", result.Skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestFence(t *testing.T) {
+	f := File{Path: "notes.md", Language: "markdown", Content: "```go\nx\n```", Size: 100, Truncated: true}
+	want := "````markdown notes.md\n```go\nx\n```\n````\n(notes.md was truncated: 11 of 100 bytes included)"
+	if got := f.Fence(); got != want {
+		t.Errorf("fence = %q, want %q", got, want)
+	}
+}
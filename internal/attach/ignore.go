@@ -0,0 +1,188 @@
+package attach
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path from the .gitignore's directory
+}
+
+// ignorer decides which paths .gitignore files exclude. It reads the
+// .gitignore of every directory from the repository root down, as git does.
+type ignorer struct {
+	root  string
+	rules map[string][]ignoreRule // by directory
+}
+
+// newIgnorer returns an ignorer for paths under dir. The repository root
+// is the nearest directory above dir containing .git, or dir itself.
+func newIgnorer(dir string) *ignorer {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+
+	root := abs
+	for d := abs; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			root = d
+			break
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	return &ignorer{root: root, rules: make(map[string][]ignoreRule)}
+}
+
+// ignored reports whether the file or directory at p is excluded
+func (ig *ignorer) ignored(p string, isDir bool) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	if filepath.Base(abs) == ".git" {
+		return true
+	}
+
+	rel, err := filepath.Rel(ig.root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	// Later, deeper rules override earlier ones
+	excluded := false
+	dirs := strings.Split(path.Dir(rel), "/")
+	for i := 0; i <= len(dirs); i++ {
+		base := ""
+		if i > 0 {
+			base = strings.Join(dirs[:i], "/")
+			if base == "." {
+				continue
+			}
+		}
+
+		target := rel
+		if base != "" {
+			target = strings.TrimPrefix(rel, base+"/")
+		}
+
+		for _, rule := range ig.load(filepath.Join(ig.root, filepath.FromSlash(base))) {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if rule.matches(target) {
+				excluded = !rule.negate
+			}
+		}
+	}
+
+	return excluded
+}
+
+// load returns the rules of the .gitignore in dir, reading it once
+func (ig *ignorer) load(dir string) []ignoreRule {
+	if rules, ok := ig.rules[dir]; ok {
+		return rules
+	}
+
+	var rules []ignoreRule
+	if file, err := os.Open(filepath.Join(dir, ".gitignore")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+				rules = append(rules, rule)
+			}
+		}
+		file.Close()
+	}
+
+	ig.rules[dir] = rules
+	return rules
+}
+
+// parseIgnoreRule parses a .gitignore line, reporting false for blank
+// lines and comments
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if negated, ok := strings.CutPrefix(line, "!"); ok {
+		rule.negate = true
+		line = negated
+	}
+	if trimmed, ok := strings.CutSuffix(line, "/"); ok {
+		rule.dirOnly = true
+		line = trimmed
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = line
+	return rule, true
+}
+
+// matches reports whether the rule matches a slash-separated path relative
+// to the rule's .gitignore
+func (r ignoreRule) matches(rel string) bool {
+	if r.anchored {
+		return matchPath(r.pattern, rel)
+	}
+	return matchPath(r.pattern, path.Base(rel))
+}
+
+// matchPath matches a slash-separated path against a glob pattern in which
+// "**" stands for any number of directories
+func matchPath(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// hasMeta reports whether a path contains glob characters
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
@@ -0,0 +1,118 @@
+package attach
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates files under dir from a map of slash-separated paths
+// to contents
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIgnorer(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, root, map[string]string{
+		".gitignore":     "# build output\n*.log\n!keep.log\nbuild/\n/secret.txt\ndocs/**/*.md\n\n",
+		"sub/.gitignore": "local.txt\n!important.log\n",
+	})
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"keep.log", false, false},
+		{"sub/deep/app.log", false, true},
+		{"sub/important.log", false, false},
+		{"important.log", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"sub/build", true, true},
+		{"secret.txt", false, true},
+		{"sub/secret.txt", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+		{"docs/guide.md", false, true},
+		{"docs/a/b/guide.md", false, true},
+		{"other/docs/guide.md", false, false},
+		{".git", true, true},
+		{"main.go", false, false},
+	}
+
+	// The rules apply the same from the repository root or below it
+	for _, dir := range []string{root, filepath.Join(root, "sub")} {
+		ig := newIgnorer(dir)
+		if ig.root != root {
+			t.Fatalf("root from %s = %s, want %s", dir, ig.root, root)
+		}
+		for _, tt := range tests {
+			if got := ig.ignored(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.want {
+				t.Errorf("ignored(%s, dir %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		line string
+		want ignoreRule
+		ok   bool
+	}{
+		{"", ignoreRule{}, false},
+		{"# comment", ignoreRule{}, false},
+		{"   ", ignoreRule{}, false},
+		{"/", ignoreRule{}, false},
+		{"*.log  ", ignoreRule{pattern: "*.log"}, true},
+		{"!keep.log", ignoreRule{pattern: "keep.log", negate: true}, true},
+		{"build/", ignoreRule{pattern: "build", dirOnly: true}, true},
+		{"/secret.txt", ignoreRule{pattern: "secret.txt", anchored: true}, true},
+		{"docs/*.md", ignoreRule{pattern: "docs/*.md", anchored: true}, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseIgnoreRule(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseIgnoreRule(%q) = %+v, %v; want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "internal/chat/shell.go", true},
+		{"internal/**", "internal/chat/shell.go", true},
+		{"internal/**/shell.go", "internal/shell.go", true},
+		{"internal/**/shell.go", "cmd/shell.go", false},
+		{"cmd/*/main.go", "cmd/llm-chat/main.go", true},
+		{"cmd/*/main.go", "cmd/a/b/main.go", false},
+		{"file?.txt", "file1.txt", true},
+		{"[ab].txt", "c.txt", false},
+	}
+	for _, tt := range tests {
+		if got := matchPath(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
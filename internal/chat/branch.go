@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// branchCommand forks the conversation at message n, as numbered by
+// /history, or at the last message, and checks out the new branch. Args
+// may also name the branch.
+func (s *Session) branchCommand(args []string) {
+	at := len(s.messages)
+	name := ""
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err == nil {
+			at = n
+			continue
+		}
+		name = arg
+	}
+
+	if at < 1 || at > len(s.messages) {
+		ui.PrintError("Usage: /branch [n] [name], where n numbers a message in /history")
+		return
+	}
+
+	s.tree.Commit(s.messages)
+	if name == "" {
+		name = s.tree.NextBranchName()
+	}
+
+	from := s.tree.Current()
+	if err := s.tree.Fork(name, s.messages[at-1].ID); err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	s.checkedOut(s.messages[:at:at])
+	ui.PrintSuccess(fmt.Sprintf("Created branch %s from message %d of %s; now on %s", name, at, from, name))
+}
+
+// checkoutCommand switches to another branch of the conversation
+func (s *Session) checkoutCommand(name string) {
+	if name == "" {
+		ui.PrintError("Usage: /checkout <branch> (see /branches)")
+		return
+	}
+
+	s.tree.Commit(s.messages)
+	messages, err := s.tree.Checkout(name)
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	s.checkedOut(messages)
+	ui.PrintSuccess(fmt.Sprintf("Switched to branch %s (%d messages)", name, len(messages)))
+	s.printLastExchange()
+}
+
+// checkedOut makes messages the conversation after a branch change
+func (s *Session) checkedOut(messages []models.Message) {
+	s.messages = messages
+	s.window.Reset()
+	s.dropped = 0
+}
+
+// showBranches lists the branches of the conversation with where each one
+// leaves the checked-out branch
+func (s *Session) showBranches() {
+	s.tree.Commit(s.messages)
+
+	ui.PrintSeparator()
+	ui.PrintInfo("Branches")
+	ui.PrintSeparator()
+
+	for _, b := range s.tree.Branches() {
+		path, _ := s.tree.Path(b.Name)
+
+		if b.Name == s.tree.Current() {
+			ui.SuccessColor.Printf("▶ %s (current)", b.Name)
+		} else {
+			fmt.Printf("  %s", b.Name)
+		}
+		ui.MutedColor.Printf(" %d messages", len(path))
+		if b.Name != s.tree.Current() {
+			ui.MutedColor.Printf(", shares %d with %s", history.Divergence(s.messages, path), s.tree.Current())
+		}
+		fmt.Println()
+
+		for i := len(path) - 1; i >= 0; i-- {
+			if path[i].Role == models.RoleUser {
+				preview := strings.ReplaceAll(path[i].Content, "\n", " ")
+				if len(preview) > 70 {
+					preview = preview[:70] + "..."
+				}
+				ui.MutedColor.Printf("    %s\n", preview)
+				break
+			}
+		}
+	}
+
+	ui.PrintSeparator()
+}
+
+// forkMarks returns, for each message of the checked-out branch that
+// another branch leaves from, the names of those branches
+func (s *Session) forkMarks() map[int][]string {
+	s.tree.Commit(s.messages)
+
+	marks := make(map[int][]string)
+	for _, b := range s.tree.Branches() {
+		if b.Name == s.tree.Current() {
+			continue
+		}
+		path, _ := s.tree.Path(b.Name)
+		if fork := history.Divergence(s.messages, path); fork > 0 {
+			marks[fork-1] = append(marks[fork-1], b.Name)
+		}
+	}
+	return marks
+}
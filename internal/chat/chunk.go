@@ -0,0 +1,353 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// mapPrompt frames one chunk of a large input in the map step
+const mapPrompt = `%s
+
+The input is too large to process at once, so it has been split into %d parts that are handled separately. This is part %d. Answer the request for this part only; your answer will be merged with the answers for the other parts. If this part has nothing relevant, say so briefly.`
+
+// reducePrompt asks for the partial answers of the map step to be merged
+const reducePrompt = `%s
+
+The input was too large to process at once, so it was split into parts and the request above was answered for each part separately. The partial answers follow. Merge them into one answer to the request, as if the whole input had been read at once: combine related points, remove repetition and keep every distinct finding.`
+
+// minChunk is the smallest chunk, in tokens, worth a request of its own
+const minChunk = 256
+
+// ChunkOptions controls how large inputs are split in chunked mode
+type ChunkOptions struct {
+	Size        int // tokens per chunk, 0 to derive it from the context window
+	Lines       int // lines per chunk, splitting by lines instead of tokens when set
+	Overlap     int // tokens, or lines with Lines, repeated from the previous chunk; negative for the default
+	Concurrency int // chunks processed at once
+}
+
+// ExecuteChunked runs a prompt over inputs too large for one request. The
+// inputs are split into overlapping chunks, the prompt is answered for
+// each chunk with bounded concurrency (the map step), and the partial
+// answers are merged into one streamed reply (the reduce step). Progress
+// is reported on stderr.
+func (sm *ShellMode) ExecuteChunked(ctx context.Context, prompt string, inputs []attach.File, opts ChunkOptions) error {
+	if len(inputs) == 0 {
+		return sm.Execute(ctx, prompt, inputs)
+	}
+
+	_, budget := sm.promptBudget()
+	overhead := contextwindow.EstimateTokens(prompt+mapPrompt+sm.config.SystemPrompt) + 64
+	room := budget - overhead
+
+	if room < minChunk {
+		return fmt.Errorf("the prompt and system prompt take about %d of the %d tokens available, leaving too little room for input; shorten them or use a model with a larger context", overhead, budget)
+	}
+	if opts.Size <= 0 {
+		opts.Size = max(room*3/4, minChunk)
+	}
+	if opts.Size < minChunk {
+		return fmt.Errorf("chunk size %d tokens is below the minimum of %d", opts.Size, minChunk)
+	}
+	if opts.Size > room {
+		return fmt.Errorf("chunk size %d tokens leaves no room for the prompt in a %d token budget; use at most %d", opts.Size, budget, room)
+	}
+	if opts.Overlap < 0 {
+		opts.Overlap = opts.Size / 10
+		if opts.Lines > 0 {
+			opts.Overlap = opts.Lines / 10
+		}
+	}
+	opts.Concurrency = max(opts.Concurrency, 1)
+
+	var chunks []attach.File
+	for _, input := range inputs {
+		var parts []string
+		if opts.Lines > 0 {
+			parts = SplitLines(input.Content, opts.Lines, opts.Overlap)
+		} else {
+			parts = SplitTokens(input.Content, opts.Size, opts.Overlap)
+		}
+		for i, part := range parts {
+			// Lines are never split, so a chunk of long lines can
+			// exceed the budget
+			if tokens := contextwindow.EstimateTokens(part); tokens > room {
+				return fmt.Errorf("%s: chunk %d is about %d tokens, more than the %d available; use a smaller --chunk-lines", input.Path, i+1, tokens, room)
+			}
+
+			chunk := input
+			chunk.Content = part
+			chunk.Size = int64(len(part))
+			if len(parts) > 1 {
+				chunk.Path = fmt.Sprintf("%s (part %d of %d)", input.Path, i+1, len(parts))
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	if len(chunks) == 1 {
+		return sm.Execute(ctx, prompt, chunks)
+	}
+
+	fmt.Fprintf(os.Stderr, "Split input into %d chunks; processing %d at a time\n", len(chunks), opts.Concurrency)
+
+	partials, err := sm.mapChunks(ctx, prompt, chunks, opts.Concurrency)
+	if err != nil {
+		return err
+	}
+
+	return sm.reduce(ctx, prompt, partials, budget, opts.Concurrency)
+}
+
+// mapChunks answers the prompt for every chunk, returning the answers in
+// chunk order
+func (sm *ShellMode) mapChunks(parent context.Context, prompt string, chunks []attach.File, concurrency int) ([]string, error) {
+	// The first failure stops the remaining chunks
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	answers := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	slots := make(chan struct{}, concurrency)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+
+			content := fmt.Sprintf(mapPrompt, prompt, len(chunks), i+1) + "\n\n" + chunk.Fence()
+			answers[i], errs[i] = sm.complete(ctx, sm.messages(content))
+			if errs[i] != nil {
+				cancel()
+				return
+			}
+
+			mu.Lock()
+			done++
+			fmt.Fprintf(os.Stderr, "Processed chunk %d/%d (%d done)\n", i+1, len(chunks), done)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if parent.Err() != nil {
+		return nil, sm.interrupted(sm.newResult())
+	}
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, fmt.Errorf("chunk %d: %w", i+1, err)
+		}
+	}
+
+	return answers, nil
+}
+
+// reduce merges partial answers into the final, streamed reply. Answers
+// that do not fit in one request are merged in groups first.
+func (sm *ShellMode) reduce(ctx context.Context, prompt string, partials []string, budget, concurrency int) error {
+	overhead := contextwindow.EstimateTokens(prompt+reducePrompt+sm.config.SystemPrompt) + 64
+
+	for round := 1; ; round++ {
+		groups := groupAnswers(partials, budget-overhead)
+		if len(groups) == 1 {
+			fmt.Fprintf(os.Stderr, "Merging %d partial answers\n", len(partials))
+			messages := sm.messages(reduceContent(prompt, groups[0]))
+			return sm.run(ctx, messages)
+		}
+		if len(groups) == len(partials) {
+			return fmt.Errorf("partial answers are too long to merge; use a smaller --chunk-size")
+		}
+
+		fmt.Fprintf(os.Stderr, "Merging %d partial answers in %d groups (round %d)\n", len(partials), len(groups), round)
+
+		merged := make([]string, len(groups))
+		errs := make([]error, len(groups))
+		slots := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, group := range groups {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				merged[i], errs[i] = sm.complete(ctx, sm.messages(reduceContent(prompt, group)))
+			}()
+		}
+		wg.Wait()
+
+		if ctx.Err() != nil {
+			return sm.interrupted(sm.newResult())
+		}
+		for i, err := range errs {
+			if err != nil {
+				return fmt.Errorf("merging group %d: %w", i+1, err)
+			}
+		}
+		partials = merged
+	}
+}
+
+// reduceContent returns the reduce request for a group of partial answers
+func reduceContent(prompt string, answers []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, reducePrompt, prompt)
+	for i, answer := range answers {
+		fmt.Fprintf(&sb, "\n\n--- Partial answer %d ---\n\n%s", i+1, strings.TrimSpace(answer))
+	}
+	return sb.String()
+}
+
+// groupAnswers packs answers, in order, into groups of at most budget
+// tokens. An answer larger than the budget gets a group of its own.
+func groupAnswers(answers []string, budget int) [][]string {
+	var (
+		groups  [][]string
+		current []string
+		tokens  int
+	)
+	for _, answer := range answers {
+		n := contextwindow.EstimateTokens(answer) + 16
+		if len(current) > 0 && tokens+n > budget {
+			groups = append(groups, current)
+			current, tokens = nil, 0
+		}
+		current = append(current, answer)
+		tokens += n
+	}
+	return append(groups, current)
+}
+
+// complete returns the whole reply to messages without streaming it,
+// recording its cost
+func (sm *ShellMode) complete(ctx context.Context, messages []models.Message) (string, error) {
+	resp, err := sm.provider.SendMessage(ctx, models.ChatRequest{
+		Messages:    messages,
+		Temperature: models.Temperature(sm.config.Temperature),
+		MaxTokens:   sm.config.MaxTokens,
+		Metadata:    sm.metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := sm.costs.record(resp.ProviderName, resp.ModelName, resp.Usage); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+
+	return resp.Content, nil
+}
+
+// SplitTokens splits text at line boundaries into chunks of about size
+// tokens, each starting with about overlap tokens from the end of the
+// previous one. Lines longer than a chunk are split on their own.
+func SplitTokens(text string, size, overlap int) []string {
+	var lines []string
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		lines = append(lines, splitLongLine(line, size)...)
+	}
+
+	tokens := make([]int, len(lines))
+	for i, line := range lines {
+		tokens[i] = contextwindow.EstimateTokens(line)
+	}
+
+	var chunks []string
+	for start := 0; start < len(lines); {
+		end, total := start, 0
+		for end < len(lines) && (end == start || total+tokens[end] <= size) {
+			total += tokens[end]
+			end++
+		}
+		chunks = append(chunks, strings.Join(lines[start:end], ""))
+		if end == len(lines) {
+			break
+		}
+
+		// Step back over the lines repeated in the next chunk, always
+		// moving forward by at least one line
+		next, repeated := end, 0
+		for next-1 > start && repeated+tokens[next-1] <= overlap {
+			next--
+			repeated += tokens[next]
+		}
+		start = next
+	}
+
+	return chunks
+}
+
+// splitLongLine cuts a line of more than size tokens into pieces that fit,
+// keeping multibyte characters whole
+func splitLongLine(line string, size int) []string {
+	if contextwindow.EstimateTokens(line) <= size {
+		return []string{line}
+	}
+
+	// Track the estimate as the piece grows rather than assuming a
+	// number of characters per token, which lines of short words exceed
+	var pieces []string
+	start, runes, words, inWord := 0, 0, 0, false
+	for i, r := range line {
+		space := r == ' ' || r == '\t' || r == '\n' || r == '\r'
+		n, w := runes+1, words
+		if !space && !inWord {
+			w++
+		}
+		if runes > 0 && max((n+3)/4, w) > size {
+			pieces = append(pieces, line[start:i])
+			start, n, w = i, 1, 0
+			if !space {
+				w = 1
+			}
+		}
+		runes, words, inWord = n, w, !space
+	}
+	return append(pieces, line[start:])
+}
+
+// SplitLines splits text into chunks of size lines, each starting with the
+// last overlap lines of the previous one
+func SplitLines(text string, size, overlap int) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	size = max(size, 1)
+	overlap = min(max(overlap, 0), size-1)
+
+	var chunks []string
+	for start := 0; start < len(lines); start += size - overlap {
+		end := min(start+size, len(lines))
+		chunks = append(chunks, strings.Join(lines[start:end], ""))
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,165 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+)
+
+// numberedLines returns n lines of five estimated tokens each, starting
+// with their number
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := range n {
+		fmt.Fprintf(&sb, "l%d %s\n", i, strings.Repeat("x", 16-len(fmt.Sprint(i))))
+	}
+	return sb.String()
+}
+
+// firstNumbers returns the number of the first and last line of each chunk
+func firstNumbers(chunks []string) string {
+	var out []string
+	for _, chunk := range chunks {
+		lines := strings.Split(strings.TrimSuffix(chunk, "\n"), "\n")
+		first := strings.Fields(lines[0])[0]
+		last := strings.Fields(lines[len(lines)-1])[0]
+		out = append(out, first+"-"+last)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestSplitTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		size, overlap int
+		want          string
+	}{
+		{"no overlap", 20, 0, "l0-l3 l4-l7 l8-l9"},
+		{"one line overlap", 20, 5, "l0-l3 l3-l6 l6-l9"},
+		{"overlap below a line", 20, 4, "l0-l3 l4-l7 l8-l9"},
+		{"overlap of a whole chunk still advances", 20, 100, "l0-l3 l1-l4 l2-l5 l3-l6 l4-l7 l5-l8 l6-l9"},
+		{"everything fits", 100, 10, "l0-l9"},
+	}
+
+	text := numberedLines(10)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitTokens(text, tt.size, tt.overlap)
+			if got := firstNumbers(chunks); got != tt.want {
+				t.Errorf("chunks %s, want %s", got, tt.want)
+			}
+			for i, chunk := range chunks {
+				if tokens := contextwindow.EstimateTokens(chunk); tokens > tt.size {
+					t.Errorf("chunk %d is %d tokens, over %d", i+1, tokens, tt.size)
+				}
+			}
+		})
+	}
+
+	if chunks := SplitTokens("", 20, 0); len(chunks) != 0 {
+		t.Errorf("empty text split into %q", chunks)
+	}
+}
+
+func TestSplitTokensLongLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no newline", strings.Repeat("abcdefgh", 500)},
+		{"multibyte", strings.Repeat("日本語のテキスト", 300)},
+		{"short words", strings.Repeat("a ", 1000)},
+		{"between short lines", "first\n" + strings.Repeat("é", 2000) + "\nlast\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := SplitTokens(tt.text, 50, 0)
+			if len(chunks) < 2 {
+				t.Fatalf("split into %d chunks", len(chunks))
+			}
+			for i, chunk := range chunks {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %d cuts a character", i+1)
+				}
+				if tokens := contextwindow.EstimateTokens(chunk); tokens > 50 {
+					t.Errorf("chunk %d is %d tokens, over 50", i+1, tokens)
+				}
+			}
+			if joined := strings.Join(chunks, ""); joined != tt.text {
+				t.Errorf("chunks without overlap do not rebuild the text")
+			}
+		})
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		size, overlap int
+		want          string
+	}{
+		{"no overlap", numberedLines(10), 4, 0, "l0-l3 l4-l7 l8-l9"},
+		{"overlap", numberedLines(10), 4, 1, "l0-l3 l3-l6 l6-l9"},
+		{"overlap clamped below size", numberedLines(5), 2, 5, "l0-l1 l1-l2 l2-l3 l3-l4"},
+		{"negative overlap", numberedLines(5), 3, -1, "l0-l2 l3-l4"},
+		{"no trailing newline", strings.TrimSuffix(numberedLines(5), "\n"), 3, 0, "l0-l2 l3-l4"},
+		{"zero size", numberedLines(2), 0, 0, "l0-l0 l1-l1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := firstNumbers(SplitLines(tt.text, tt.size, tt.overlap)); got != tt.want {
+				t.Errorf("chunks %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Long lines are kept whole, however large
+	long := strings.Repeat("ü", 10000)
+	if chunks := SplitLines(long+"\nshort\n", 1, 0); len(chunks) != 2 || chunks[0] != long+"\n" {
+		t.Errorf("long line split into %d chunks", len(chunks))
+	}
+	if chunks := SplitLines("", 10, 0); len(chunks) != 0 {
+		t.Errorf("empty text split into %q", chunks)
+	}
+}
+
+func TestExecuteChunkedBudget(t *testing.T) {
+	input := StdinInput(numberedLines(300))
+
+	tests := []struct {
+		name          string
+		contextLength int
+		opts          ChunkOptions
+		want          string
+	}{
+		{"prompt leaves no room", 300, ChunkOptions{}, "leaving too little room"},
+		{"chunk size below the minimum", 8192, ChunkOptions{Size: 10}, "below the minimum"},
+		{"chunk size over the budget", 8192, ChunkOptions{Size: 8000}, "leaves no room"},
+		{"chunk lines over the budget", 1200, ChunkOptions{Lines: 200}, "use a smaller --chunk-lines"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			sm := newTestShell(t, "groq", &out)
+			sm.config.ContextLength = tt.contextLength
+
+			err := sm.ExecuteChunked(context.Background(), "summarize", []attach.File{input}, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+			if out.Len() != 0 {
+				t.Errorf("sent %q before failing", out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,709 @@
+package chat
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/registry"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// ErrCompareFailed is returned when every target of a comparison failed.
+// The failures have already been shown with the results.
+var ErrCompareFailed = errors.New("every target of the comparison failed")
+
+// CompareResult is the reply of one target of a comparison, as written by
+// the json format and the done events of the jsonl format
+type CompareResult struct {
+	Target string `json:"target"`
+	Result
+	Error *ErrorInfo `json:"error,omitempty"`
+}
+
+// comparisonReport is a comparison as written by the json format
+type comparisonReport struct {
+	Results        []CompareResult `json:"results"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+}
+
+// Comparison sends the same request to several providers and models at
+// once. The replies are shown one after another in target order, each
+// streamed as it arrives, or side by side once all have arrived, followed
+// by the latency, tokens and cost of each.
+type Comparison struct {
+	registry *registry.Registry
+	config   *config.Config
+	costs    *costTracker
+	targets  []providers.Route
+
+	// Columns shows the replies side by side in the text format
+	Columns bool
+
+	// mode and tags are sent with every request, for the router's rules
+	mode string
+	tags []string
+}
+
+// ParseTargets parses the targets of a comparison, a comma-separated list
+// of providers written as "provider" or "provider:model"
+func ParseTargets(list string) ([]providers.Route, error) {
+	var targets []providers.Route
+	seen := make(map[string]bool)
+	for _, s := range strings.Split(list, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+
+		target := providers.ParseRoute(s)
+		if seen[target.String()] {
+			return nil, fmt.Errorf("%s is listed twice", target)
+		}
+		seen[target.String()] = true
+		targets = append(targets, target)
+	}
+
+	if len(targets) < 2 {
+		return nil, fmt.Errorf("a comparison needs at least two targets, such as groq:llama-70b,gemini:flash")
+	}
+	return targets, nil
+}
+
+// NewComparison creates a comparison of the targets, which must name
+// registered providers
+func NewComparison(reg *registry.Registry, cfg *config.Config, targets []providers.Route) (*Comparison, error) {
+	return newComparison(reg, cfg, newCostTracker(cfg), targets, "shell")
+}
+
+// newComparison creates a comparison recording costs with costs and
+// sending requests in the given mode
+func newComparison(reg *registry.Registry, cfg *config.Config, costs *costTracker, targets []providers.Route, mode string) (*Comparison, error) {
+	for _, target := range targets {
+		if _, err := reg.Get(target.Provider); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Comparison{
+		registry: reg,
+		config:   cfg,
+		costs:    costs,
+		targets:  targets,
+		mode:     mode,
+	}, nil
+}
+
+// SetTags tags the requests, for the router's rules, and the saved
+// comparison
+func (c *Comparison) SetTags(tags []string) {
+	c.tags = tags
+}
+
+// Execute compares the replies to a single prompt with the given inputs,
+// such as files and piped stdin, writing them to stdout in the configured
+// output format, and saves the comparison in history. Cancelling ctx stops
+// the replies; what arrived so far is shown and saved, and ErrInterrupted
+// is returned.
+func (c *Comparison) Execute(ctx context.Context, prompt string, inputs []attach.File) error {
+	fullPrompt := strings.TrimSpace(prompt + "\n\n" + FrameInputs(inputs))
+	if fullPrompt == "" {
+		return fmt.Errorf("no input provided")
+	}
+
+	format := c.config.OutputFormat
+	messages := promptMessages(c.config.SystemPrompt, fullPrompt)
+
+	results, err := c.run(ctx, os.Stdout, format, messages)
+	if results == nil {
+		return err
+	}
+
+	id := ""
+	if !c.config.NoHistory {
+		id = c.saveTo(messages, results)
+	}
+
+	c.summarize(os.Stdout, format, results, id)
+	if id != "" && !IsStructured(format) {
+		fmt.Fprintf(os.Stderr, "Saved comparison %s; continue from one of its replies with: llm-chat chat --resume %s\n", id, id)
+	}
+	return err
+}
+
+// saveTo saves the comparison in the configured history, returning its ID
+// or "" if nothing was saved. Failures are reported on stderr.
+func (c *Comparison) saveTo(messages []models.Message, results []CompareResult) string {
+	mgr, err := OpenHistory(c.config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save comparison: %v\n", err)
+		return ""
+	}
+	defer mgr.Close()
+
+	id, err := c.save(mgr, messages, results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save comparison: %v\n", err)
+		return ""
+	}
+	return id
+}
+
+// compareCommand sends the conversation with a new prompt to several
+// providers and models and saves their replies as a comparison, which
+// can be resumed to continue from one of them. The conversation itself is
+// left as it was. Args are the targets and the prompt, optionally after
+// --columns.
+func (s *Session) compareCommand(args string) {
+	columns := false
+	if rest, ok := strings.CutPrefix(args, "--columns"); ok {
+		columns = true
+		args = strings.TrimSpace(rest)
+	}
+
+	list, prompt, _ := strings.Cut(args, " ")
+	prompt = strings.TrimSpace(prompt)
+	if list == "" || prompt == "" {
+		ui.PrintError("Usage: /compare [--columns] <provider:model,provider:model,...> <prompt>")
+		return
+	}
+
+	targets, err := ParseTargets(list)
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	comparison, err := newComparison(s.registry, s.config, s.costs, targets, "interactive")
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+	comparison.SetTags(s.tags)
+	comparison.Columns = columns
+
+	content, err := s.withAttachments(prompt)
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	messages := append(s.messages[:len(s.messages):len(s.messages)], models.Message{
+		Role:      models.RoleUser,
+		Content:   content,
+		Timestamp: time.Now(),
+	})
+
+	ctx, done := s.interrupts.generating()
+	defer done()
+
+	results, err := comparison.run(ctx, os.Stdout, FormatText, messages)
+	if results == nil {
+		ui.PrintError(err.Error())
+		return
+	}
+	s.attached = nil
+
+	id := ""
+	if !s.config.NoHistory {
+		id, err = comparison.save(s.historyManager, messages, results)
+		if err != nil {
+			ui.PrintWarning(fmt.Sprintf("Failed to save comparison: %v", err))
+		}
+	}
+
+	comparison.summarize(os.Stdout, FormatText, results, id)
+	if id != "" {
+		ui.MutedColor.Printf("\nSaved as %s; /resume it and /checkout a target to continue from its reply\n", id)
+	}
+}
+
+// run sends messages to every target at once and writes the replies to w
+// in format, returning the results in target order. It returns
+// ErrInterrupted if ctx was cancelled, and ErrCompareFailed if no target
+// answered.
+func (c *Comparison) run(ctx context.Context, w io.Writer, format string, messages []models.Message) ([]CompareResult, error) {
+	// Warnings go to stderr to keep piped output clean
+	warning, err := c.costs.checkBudget()
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	runs := c.start(ctx, messages)
+
+	var results []CompareResult
+	if c.Columns && format == FormatText {
+		results = c.showColumns(w, runs)
+	} else {
+		results = c.show(w, format, runs)
+	}
+
+	if ctx.Err() != nil {
+		return results, ErrInterrupted
+	}
+
+	var errs []error
+	for _, run := range runs {
+		if run.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", run.target, run.err))
+		}
+	}
+	if len(errs) == len(runs) {
+		return results, fmt.Errorf("%w: %w", ErrCompareFailed, errors.Join(errs...))
+	}
+	return results, nil
+}
+
+// start sends the request to every target, each streaming its reply in
+// the background
+func (c *Comparison) start(ctx context.Context, messages []models.Message) []*compareRun {
+	metadata := map[string]string{
+		providers.MetadataMode: c.mode,
+		providers.MetadataTags: strings.Join(c.tags, ","),
+	}
+
+	runs := make([]*compareRun, len(c.targets))
+	for i, target := range c.targets {
+		// Registered, as newComparison checked
+		provider, _ := c.registry.Get(target.Provider)
+
+		req := models.ChatRequest{
+			Messages:    messages,
+			Model:       target.Model,
+			Temperature: models.Temperature(c.config.Temperature),
+			MaxTokens:   c.config.MaxTokens,
+			Stream:      true,
+			Metadata:    metadata,
+		}
+
+		run := &compareRun{
+			target:   target,
+			provider: provider.Name(),
+			model:    cmp.Or(target.Model, provider.DefaultModel()),
+			updated:  make(chan struct{}, 1),
+		}
+		run.result.Provider, run.result.Model = run.provider, run.model
+
+		runs[i] = run
+		go run.stream(ctx, provider, req)
+	}
+	return runs
+}
+
+// show writes the replies one after another in target order, each
+// streamed as it arrives, and returns their results. Later replies are
+// received in the meantime and catch up when their turn comes.
+func (c *Comparison) show(w io.Writer, format string, runs []*compareRun) []CompareResult {
+	enc := json.NewEncoder(w)
+	results := make([]CompareResult, len(runs))
+
+	for i, run := range runs {
+		target := run.target.String()
+
+		switch format {
+		case FormatJSONL:
+			enc.Encode(event{Type: "start", Target: target, Provider: run.provider, Model: run.model})
+		case FormatMarkdown:
+			fmt.Fprintf(w, "## %s\n\n", target)
+		case FormatText:
+			ui.AssistantColor.Fprintf(w, "\n%s %s\n", ui.AssistantEmoji, target)
+		case FormatRaw:
+			fmt.Fprintf(w, "=== %s ===\n", target)
+		}
+
+		for offset := 0; ; {
+			content, done := run.next(offset)
+			offset += len(content)
+
+			if content != "" {
+				switch format {
+				case FormatJSON:
+					// Written whole by summarize
+				case FormatJSONL:
+					enc.Encode(event{Type: "delta", Target: target, Content: content})
+				default:
+					fmt.Fprint(w, content)
+				}
+			}
+			if done {
+				break
+			}
+		}
+
+		results[i] = c.result(run)
+		result := &results[i]
+
+		switch format {
+		case FormatJSON:
+			// Written whole by summarize
+		case FormatJSONL:
+			if result.Error != nil {
+				enc.Encode(event{Type: "error", Target: target, Error: result.Error})
+			} else {
+				enc.Encode(event{Type: "done", Target: target, Result: &result.Result})
+			}
+		case FormatMarkdown:
+			fmt.Fprintf(w, "\n\n*%s*\n\n", resultStatus(*result))
+		case FormatText:
+			fmt.Fprintln(w)
+			ui.MutedColor.Fprintf(w, "(%s)\n", resultStatus(*result))
+		default:
+			fmt.Fprintf(w, "\n(%s)\n\n", resultStatus(*result))
+		}
+	}
+
+	return results
+}
+
+// showColumns waits for every reply and writes them side by side, each
+// wrapped to the width of its column, and returns their results
+func (c *Comparison) showColumns(w io.Writer, runs []*compareRun) []CompareResult {
+	results := make([]CompareResult, len(runs))
+	for i, run := range runs {
+		run.wait()
+		results[i] = c.result(run)
+	}
+
+	const gap = " │ "
+	width := max((terminalWidth()-utf8.RuneCountInString(gap)*(len(runs)-1))/len(runs), 10)
+
+	columns := make([][]string, len(results))
+	rows := 0
+	for i, result := range results {
+		text := result.Response
+		if result.Error != nil {
+			text = "Error: " + result.Error.Message
+		} else if result.Interrupted {
+			text += "\n[interrupted]"
+		}
+
+		header := wrapText(result.Target, width)[0]
+		columns[i] = append([]string{header, strings.Repeat("─", width)}, wrapText(text, width)...)
+		rows = max(rows, len(columns[i]))
+	}
+
+	fmt.Fprintln(w)
+	for row := range rows {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cell := ""
+			if row < len(column) {
+				cell = column[row]
+			}
+			cells[i] = cell + strings.Repeat(" ", width-utf8.RuneCountInString(cell))
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, gap), " "))
+	}
+
+	return results
+}
+
+// summarize writes the results compared side by side: a table of latency,
+// tokens and cost in the text and markdown formats, and the whole
+// comparison in the json format. id is that of the saved comparison.
+func (c *Comparison) summarize(w io.Writer, format string, results []CompareResult, id string) {
+	header := []string{"Target", "Status", "Latency", "First token", "Tokens in", "Tokens out", "Cost"}
+
+	switch format {
+	case FormatJSON:
+		json.NewEncoder(w).Encode(comparisonReport{Results: results, ConversationID: id})
+
+	case FormatMarkdown:
+		fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+		fmt.Fprintf(w, "|---|---|%s\n", strings.Repeat("---:|", len(header)-2))
+		for _, result := range results {
+			fmt.Fprintf(w, "| %s |\n", strings.Join(summaryRow(result), " | "))
+		}
+
+	case FormatText:
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, result := range results {
+			fmt.Fprintln(tw, strings.Join(summaryRow(result), "\t"))
+		}
+		tw.Flush()
+	}
+}
+
+// summaryRow returns the cells of a result in the summary table
+func summaryRow(result CompareResult) []string {
+	if result.Error != nil {
+		return []string{result.Target, "failed: " + result.Error.Class, "-", "-", "-", "-", "-"}
+	}
+
+	status := "ok"
+	if result.Interrupted {
+		status = "interrupted"
+	}
+
+	firstToken := "-"
+	if result.FirstTokenMS > 0 {
+		firstToken = formatMS(result.FirstTokenMS)
+	}
+
+	tokensIn, tokensOut, cost := "-", "-", "-"
+	if result.Usage != nil {
+		tokensIn = strconv.Itoa(result.Usage.PromptTokens)
+		tokensOut = strconv.Itoa(result.Usage.CompletionTokens)
+		cost = ui.FormatCost(result.Cost)
+	}
+
+	return []string{result.Target, status, formatMS(result.DurationMS), firstToken, tokensIn, tokensOut, cost}
+}
+
+// resultStatus describes how a reply ended, with its latency, tokens and
+// cost
+func resultStatus(result CompareResult) string {
+	if result.Error != nil {
+		return fmt.Sprintf("failed: %s", result.Error.Message)
+	}
+
+	parts := []string{result.Provider + "/" + result.Model, formatMS(result.DurationMS)}
+	if result.Usage != nil {
+		parts = append(parts,
+			fmt.Sprintf("%d in, %d out tokens", result.Usage.PromptTokens, result.Usage.CompletionTokens),
+			ui.FormatCost(result.Cost))
+	}
+	if result.Interrupted {
+		parts = append(parts, "interrupted")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatMS formats a duration given in milliseconds as seconds
+func formatMS(ms int64) string {
+	return fmt.Sprintf("%.2fs", float64(ms)/1000)
+}
+
+// result returns the result of a completed run, recording its cost
+func (c *Comparison) result(run *compareRun) CompareResult {
+	result := CompareResult{Target: run.target.String(), Result: run.result}
+	if run.err != nil {
+		result.Error = newErrorInfo(run.err)
+		return result
+	}
+
+	amount, err := c.costs.record(result.Provider, result.Model, result.Usage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	result.Cost = amount
+	return result
+}
+
+// save records the replies that arrived as one comparison in history and
+// returns its ID, or "" if no target answered
+func (c *Comparison) save(mgr *history.Manager, messages []models.Message, results []CompareResult) (string, error) {
+	var (
+		names   []string
+		replies []models.Message
+	)
+	for _, result := range results {
+		if result.Error != nil || result.Response == "" {
+			continue
+		}
+
+		names = append(names, result.Target)
+		replies = append(replies, models.Message{
+			Role:         models.RoleAssistant,
+			Content:      result.Response,
+			Timestamp:    time.Now(),
+			Model:        result.Model,
+			Provider:     result.Provider,
+			Interrupted:  result.Interrupted,
+			Usage:        result.Usage,
+			FinishReason: result.FinishReason,
+			Cost:         result.Cost,
+			DurationMS:   result.DurationMS,
+		})
+	}
+	if len(replies) == 0 {
+		return "", nil
+	}
+
+	conv := history.NewComparison(history.NewID(), messages, names, replies)
+	conv.Tags = c.tags
+	conv.Persona = c.config.Persona
+
+	return conv.ID, mgr.AddConversation(conv)
+}
+
+// compareRun is the reply of one target of a comparison as it arrives
+type compareRun struct {
+	target   providers.Route
+	provider string // the provider and model asked, before any reply names them
+	model    string
+	updated  chan struct{} // signalled when content arrives or the reply ends
+
+	mu      sync.Mutex
+	content strings.Builder
+	result  Result
+	err     error
+	done    bool
+}
+
+// stream receives the reply from provider
+func (r *compareRun) stream(ctx context.Context, provider providers.Provider, req models.ChatRequest) {
+	start := time.Now()
+	defer func() {
+		r.mu.Lock()
+		r.result.Response = r.content.String()
+		r.result.DurationMS = time.Since(start).Milliseconds()
+		r.done = true
+		r.mu.Unlock()
+		r.signal()
+	}()
+
+	if !provider.IsAvailable() {
+		r.fail(ctx, &providers.Error{
+			Provider: provider.Name(),
+			Class:    providers.ClassUnavailable,
+			Err:      fmt.Errorf("provider %s is not available", provider.Name()),
+		})
+		return
+	}
+
+	streamChan, err := provider.StreamMessage(ctx, req)
+	if err != nil {
+		r.fail(ctx, err)
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.fail(ctx, ctx.Err())
+			return
+		case chunk, ok := <-streamChan:
+			if !ok {
+				return
+			}
+			if chunk.Error != nil {
+				r.fail(ctx, chunk.Error)
+				return
+			}
+
+			r.mu.Lock()
+			if chunk.Usage != nil {
+				r.result.Usage = chunk.Usage
+			}
+			if chunk.FinishReason != "" {
+				r.result.FinishReason = chunk.FinishReason
+			}
+			if chunk.ProviderName != "" {
+				r.result.Provider, r.result.Model = chunk.ProviderName, chunk.ModelName
+			}
+			if chunk.Content != "" && r.result.FirstTokenMS == 0 {
+				r.result.FirstTokenMS = time.Since(start).Milliseconds()
+			}
+			r.content.WriteString(chunk.Content)
+			r.mu.Unlock()
+			r.signal()
+		}
+	}
+}
+
+// fail ends the reply with err, or as interrupted if ctx was cancelled
+func (r *compareRun) fail(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if ctx.Err() != nil {
+		r.result.Interrupted = true
+		return
+	}
+	r.err = err
+}
+
+// signal wakes a reader waiting in next
+func (r *compareRun) signal() {
+	select {
+	case r.updated <- struct{}{}:
+	default:
+	}
+}
+
+// next waits until the reply has content past offset or has ended, and
+// returns that content and whether the reply has ended
+func (r *compareRun) next(offset int) (string, bool) {
+	for {
+		r.mu.Lock()
+		content, done := r.content.String()[offset:], r.done
+		r.mu.Unlock()
+
+		if content != "" || done {
+			return content, done
+		}
+		<-r.updated
+	}
+}
+
+// wait waits for the reply to end
+func (r *compareRun) wait() {
+	for offset := 0; ; {
+		content, done := r.next(offset)
+		if done {
+			return
+		}
+		offset += len(content)
+	}
+}
+
+// terminalWidth returns the width of the terminal as given by $COLUMNS,
+// or 120 columns
+func terminalWidth() int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return 120
+}
+
+// wrapText breaks text into lines of at most width characters at spaces,
+// cutting words longer than a line. It always returns at least one line.
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,203 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/registry"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// echoProvider streams its name and the requested model after delay, or
+// fails with err
+type echoProvider struct {
+	providers.Provider
+	name  string
+	delay time.Duration
+	err   error
+}
+
+func (e *echoProvider) Name() string                      { return e.name }
+func (e *echoProvider) IsAvailable() bool                 { return true }
+func (e *echoProvider) DefaultModel() string              { return e.name + "-default" }
+func (e *echoProvider) Initialize(providers.Config) error { return nil }
+
+func (e *echoProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	model := req.Model
+	if model == "" {
+		model = e.DefaultModel()
+	}
+
+	ch := make(chan models.StreamChunk, 3)
+	go func() {
+		defer close(ch)
+		time.Sleep(e.delay)
+		if e.err != nil {
+			ch <- models.StreamChunk{Error: e.err, Done: true}
+			return
+		}
+		ch <- models.StreamChunk{Content: "from " + e.name + "/" + model}
+		ch <- models.StreamChunk{
+			Done:         true,
+			Usage:        &models.Usage{PromptTokens: 3, CompletionTokens: 2},
+			FinishReason: "stop",
+			ProviderName: e.name,
+			ModelName:    model,
+		}
+	}()
+	return ch, nil
+}
+
+// newTestComparison returns a comparison of targets over echo providers,
+// the named ones failing
+func newTestComparison(t *testing.T, targets string, failing ...string) *Comparison {
+	t.Helper()
+
+	reg := registry.New()
+	for _, name := range []string{"slow", "fast", "broken"} {
+		p := &echoProvider{name: name}
+		if name == "slow" {
+			p.delay = 20 * time.Millisecond
+		}
+		for _, f := range failing {
+			if f == name {
+				p.err = &providers.Error{Provider: name, Class: providers.ClassRateLimited, Err: fmt.Errorf("%s is rate limited", name)}
+			}
+		}
+		if err := reg.Register(p, providers.Metadata{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	routes, err := ParseTargets(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.UsagePath = filepath.Join(t.TempDir(), "usage.jsonl")
+
+	comparison, err := NewComparison(reg, cfg, routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comparison
+}
+
+var comparePrompt = []models.Message{{Role: models.RoleUser, Content: "Hi", Timestamp: time.Now()}}
+
+func TestComparisonRun(t *testing.T) {
+	comparison := newTestComparison(t, "slow:big,fast,broken", "broken")
+
+	var out bytes.Buffer
+	results, err := comparison.run(context.Background(), &out, FormatJSONL, comparePrompt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct{ target, response string }{
+		{"slow:big", "from slow/big"},
+		{"fast", "from fast/fast-default"},
+		{"broken", ""},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].Target != w.target || results[i].Response != w.response {
+			t.Errorf("result %d = %s %q, want %s %q", i, results[i].Target, results[i].Response, w.target, w.response)
+		}
+	}
+	if results[0].Usage == nil || results[0].Usage.CompletionTokens != 2 {
+		t.Errorf("usage of slow:big = %+v", results[0].Usage)
+	}
+	if results[2].Error == nil || results[2].Error.Class != "rate_limited" {
+		t.Errorf("error of broken = %+v, want rate_limited", results[2].Error)
+	}
+
+	// Each target's events come together, in target order, though the
+	// slow one answered last
+	var targets []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("bad event %q: %v", line, err)
+		}
+		if len(targets) == 0 || targets[len(targets)-1] != e.Target {
+			targets = append(targets, e.Target)
+		}
+	}
+	if strings.Join(targets, ",") != "slow:big,fast,broken" {
+		t.Errorf("event targets in order %v", targets)
+	}
+}
+
+func TestComparisonAllFail(t *testing.T) {
+	comparison := newTestComparison(t, "broken,broken:other", "broken")
+
+	var out bytes.Buffer
+	_, err := comparison.run(context.Background(), &out, FormatJSON, comparePrompt)
+	if !errors.Is(err, ErrCompareFailed) {
+		t.Fatalf("error = %v, want ErrCompareFailed", err)
+	}
+	if providers.ClassOf(err) != providers.ClassRateLimited {
+		t.Errorf("class = %s, want rate_limited", providers.ClassOf(err))
+	}
+}
+
+func TestComparisonSave(t *testing.T) {
+	comparison := newTestComparison(t, "slow:big,fast,broken", "broken")
+
+	results, err := comparison.run(context.Background(), &bytes.Buffer{}, FormatJSON, comparePrompt)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mgr, err := history.NewManager(history.Config{Path: filepath.Join(t.TempDir(), "history.jsonl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+
+	id, err := comparison.save(mgr, comparePrompt, results)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	conv, err := mgr.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conv.Kind != history.KindComparison {
+		t.Errorf("kind = %q, want %q", conv.Kind, history.KindComparison)
+	}
+
+	// One branch per target that answered, sharing the prompt
+	tree := conv.Tree()
+	branches := tree.Branches()
+	if len(branches) != 2 || branches[0].Name != "slow:big" || branches[1].Name != "fast" {
+		t.Fatalf("branches = %+v, want slow:big and fast", branches)
+	}
+	for _, b := range branches {
+		path, _ := tree.Path(b.Name)
+		if len(path) != 2 || path[0].Content != "Hi" {
+			t.Fatalf("branch %s = %+v", b.Name, path)
+		}
+		if path[1].Provider == "" || path[1].Usage == nil {
+			t.Errorf("reply on %s lacks provider or usage: %+v", b.Name, path[1])
+		}
+	}
+	if len(conv.Messages) != 3 {
+		t.Errorf("saved %d messages, want the prompt and two replies", len(conv.Messages))
+	}
+}
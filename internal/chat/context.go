@@ -0,0 +1,167 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// summaryPrompt instructs the model that condenses older messages
+const summaryPrompt = `You condense chat transcripts. Summarize the conversation you are given so that it can replace the original messages as context for continuing it. Keep facts, decisions, names, numbers, code identifiers and open questions; drop pleasantries. If a previous summary is included, merge it with the new messages. Reply with the summary only.`
+
+// contextLength returns the context length of the current model
+func (s *Session) contextLength() int {
+	if s.config.ContextLength > 0 {
+		return s.config.ContextLength
+	}
+	return contextwindow.Length(s.provider.Name(), s.provider.DefaultModel(), s.config.ContextLengths)
+}
+
+// newContextWindow creates the context manager for the current model
+func (s *Session) newContextWindow() *contextwindow.Manager {
+	strategy := contextwindow.Strategy(s.config.ContextStrategy)
+	limit := contextwindow.PromptBudget(s.contextLength(), s.config.MaxTokens)
+	return contextwindow.NewManager(strategy, limit, s.summarize)
+}
+
+// updateContextLimit applies the context length of a newly selected model
+func (s *Session) updateContextLimit() {
+	s.window.SetLimit(contextwindow.PromptBudget(s.contextLength(), s.config.MaxTokens))
+}
+
+// summarize condenses earlier messages with the current provider
+func (s *Session) summarize(ctx context.Context, previous string, messages []models.Message) (string, error) {
+	ui.MutedColor.Printf("\nSummarizing %d earlier messages to fit the context window...\n", len(messages))
+
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Previous summary:\n\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\nNew messages:\n\n")
+	}
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, msg.Content)
+	}
+
+	req := models.ChatRequest{
+		Messages: []models.Message{
+			{Role: models.RoleSystem, Content: summaryPrompt},
+			{Role: models.RoleUser, Content: transcript.String()},
+		},
+		Temperature: models.Temperature(0.3),
+		MaxTokens:   1024,
+		Metadata:    s.requestMetadata(),
+	}
+
+	resp, err := s.provider.SendMessage(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := s.costs.record(resp.ProviderName, resp.ModelName, resp.Usage); err != nil {
+		ui.PrintWarning(err.Error())
+	}
+
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// pinCommand pins or unpins the message numbered as in /history, or the
+// last message if no number is given
+func (s *Session) pinCommand(args string, pinned bool) {
+	if len(s.messages) == 0 {
+		ui.PrintError("No messages yet")
+		return
+	}
+
+	index := len(s.messages) - 1
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(s.messages) {
+			ui.PrintError(fmt.Sprintf("Message number must be between 1 and %d (see /history)", len(s.messages)))
+			return
+		}
+		index = n - 1
+	}
+
+	s.messages[index].Pinned = pinned
+
+	if pinned {
+		ui.PrintSuccess(fmt.Sprintf("Pinned message %d; it is always sent", index+1))
+	} else {
+		ui.PrintSuccess(fmt.Sprintf("Unpinned message %d", index+1))
+	}
+}
+
+// showContext displays what the next request will send and its token use
+func (s *Session) showContext() {
+	w := s.window.Preview(s.messages)
+
+	ui.PrintSeparator()
+	ui.PrintInfo("Context Window")
+	ui.PrintSeparator()
+
+	fmt.Printf("Model: %s/%s (context %d tokens, %d for the prompt)\n",
+		s.provider.Name(), s.provider.DefaultModel(), s.contextLength(), w.Limit)
+	fmt.Printf("Strategy: %s\n", s.window.Strategy())
+
+	fmt.Println()
+	for i, msg := range w.Messages {
+		label := fmt.Sprintf("[%d] %s", w.Included[i]+1, msg.Role)
+		if w.Included[i] < 0 {
+			label = "[-] summary"
+		}
+		if msg.Pinned {
+			label += " 📌"
+		}
+		fmt.Printf("  %-18s %6d tokens  %s\n", label, contextwindow.MessageTokens(msg), preview(msg.Content, 50))
+	}
+
+	sent := 0
+	for _, index := range w.Included {
+		if index >= 0 {
+			sent++
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("Sending %d of %d messages, about %d tokens (%d%% of the prompt budget)\n",
+		sent, len(s.messages), w.Tokens, percent(w.Tokens, w.Limit))
+	if w.Summarized > 0 {
+		fmt.Printf("%d earlier messages are replaced by the summary\n", w.Summarized)
+	}
+	if w.Dropped > 0 {
+		verb := "are left out"
+		if s.window.Strategy() == contextwindow.StrategySummarize {
+			verb = "will be summarized"
+		}
+		fmt.Printf("%d older messages %s\n", w.Dropped, verb)
+	}
+	if w.Tokens > w.Limit {
+		ui.PrintWarning("the system, pinned and latest messages alone exceed the prompt budget")
+	}
+
+	ui.PrintSeparator()
+}
+
+// preview returns the first line of text, shortened to at most n runes
+func preview(text string, n int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	runes := []rune(line)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return line
+}
+
+// percent returns part as a whole percentage of total
+func percent(part, total int) int {
+	if total <= 0 {
+		return 0
+	}
+	return part * 100 / total
+}
@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/cost"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// costTracker prices replies, records them in the usage ledger and applies
+// the configured budget
+type costTracker struct {
+	table  *cost.Table
+	ledger *cost.Ledger
+	budget cost.Budget
+}
+
+// newCostTracker creates a tracker from the cost settings of cfg
+func newCostTracker(cfg *config.Config) *costTracker {
+	return &costTracker{
+		table:  newPriceTable(cfg),
+		ledger: cost.NewLedger(cfg.UsagePath),
+		budget: NewBudget(cfg),
+	}
+}
+
+// newPriceTable returns the built-in prices with the config file's
+// overrides applied
+func newPriceTable(cfg *config.Config) *cost.Table {
+	overrides := make(map[string]map[string]cost.Price, len(cfg.Prices))
+	for provider, prices := range cfg.Prices {
+		overrides[provider] = make(map[string]cost.Price, len(prices))
+		for model, price := range prices {
+			overrides[provider][model] = cost.Price{Input: price.Input, Output: price.Output}
+		}
+	}
+	return cost.NewTable(overrides)
+}
+
+// NewBudget returns the budget set in cfg
+func NewBudget(cfg *config.Config) cost.Budget {
+	return cost.Budget{
+		Daily:   cfg.BudgetDaily,
+		Monthly: cfg.BudgetMonthly,
+		Refuse:  cfg.BudgetAction == "refuse",
+	}
+}
+
+// CostRecorder returns a function that prices replies and records them
+// in the usage ledger of cfg, for commands that send requests outside a
+// session
+func CostRecorder(cfg *config.Config) func(provider, model string, usage *models.Usage) (float64, error) {
+	return newCostTracker(cfg).record
+}
+
+// CostPricer returns a function that prices replies without recording
+// them, for replies that cost nothing this time
+func CostPricer(cfg *config.Config) func(provider, model string, usage *models.Usage) (float64, error) {
+	table := newPriceTable(cfg)
+	return func(provider, model string, usage *models.Usage) (float64, error) {
+		if usage == nil {
+			return 0, nil
+		}
+		amount, _ := table.Cost(provider, model, *usage)
+		return amount, nil
+	}
+}
+
+// checkBudget returns a warning once a budget is reached, or an error if
+// the budget refuses further requests
+func (t *costTracker) checkBudget() (string, error) {
+	return t.budget.Check(t.ledger, time.Now())
+}
+
+// record prices a reply and adds it to the ledger. The cost is zero when
+// the model has no known price or the provider reported no usage.
+func (t *costTracker) record(provider, model string, usage *models.Usage) (float64, error) {
+	if usage == nil {
+		return 0, nil
+	}
+
+	amount, ok := t.table.Cost(provider, model, *usage)
+	entry := cost.Entry{
+		Time:             time.Now(),
+		Provider:         provider,
+		Model:            model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             amount,
+		Unpriced:         !ok,
+	}
+
+	return amount, t.ledger.Record(entry)
+}
+
+// PrintSpend displays a spend report and the state of the budget
+func PrintSpend(report cost.Report, title string, budget cost.Budget, ledger *cost.Ledger) {
+	ui.PrintSeparator()
+	ui.PrintInfo(title)
+	ui.PrintSeparator()
+
+	if report.Total.Requests == 0 {
+		fmt.Println("No usage recorded")
+		ui.PrintSeparator()
+		return
+	}
+
+	fmt.Printf("Total: %s over %d replies (%d tokens in, %d out)\n",
+		ui.FormatCost(report.Total.Cost), report.Total.Requests,
+		report.Total.PromptTokens, report.Total.CompletionTokens)
+	if report.Total.Unpriced > 0 {
+		ui.MutedColor.Printf("%d replies used models without a known price and count as free\n", report.Total.Unpriced)
+	}
+
+	sections := []struct {
+		name  string
+		lines []cost.Line
+	}{
+		{"By Day", report.ByDay},
+		{"By Provider", report.ByProvider},
+		{"By Model", report.ByModel},
+	}
+
+	for _, section := range sections {
+		fmt.Printf("\n%s:\n", section.name)
+		for _, line := range section.lines {
+			fmt.Printf("  %-40s %9s  %4d replies  %8d tokens\n",
+				line.Key, ui.FormatCost(line.Cost), line.Requests, line.PromptTokens+line.CompletionTokens)
+		}
+	}
+
+	if budget.Enabled() {
+		fmt.Println()
+		printBudget(budget, ledger)
+	}
+
+	ui.PrintSeparator()
+}
+
+// printBudget displays spend against the budget limits
+func printBudget(budget cost.Budget, ledger *cost.Ledger) {
+	now := time.Now()
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+
+	action := "warn"
+	if budget.Refuse {
+		action = "refuse"
+	}
+
+	limits := []struct {
+		name  string
+		limit float64
+		since time.Time
+	}{
+		{"Today", budget.Daily, dayStart},
+		{"This month", budget.Monthly, monthStart},
+	}
+
+	fmt.Printf("Budget (%s when reached):\n", action)
+	for _, l := range limits {
+		if l.limit <= 0 {
+			continue
+		}
+		spent, err := ledger.Spend(l.since)
+		if err != nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		fmt.Printf("  %-12s %s of %s\n", l.name+":", ui.FormatCost(spent), ui.FormatCost(l.limit))
+	}
+}
@@ -0,0 +1,241 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// retryCommand regenerates the last reply. Args may give a temperature, a
+// model of the current provider, or both, for this reply only. The
+// replaced reply is kept on a branch of its own.
+func (s *Session) retryCommand(args string) {
+	last := len(s.messages) - 1
+	if last < 0 || s.messages[last].Role != models.RoleAssistant {
+		ui.PrintError("No reply to retry")
+		return
+	}
+
+	temperature := s.config.Temperature
+	model := ""
+	for _, arg := range strings.Fields(args) {
+		if t, err := strconv.ParseFloat(arg, 64); err == nil {
+			if t < 0 || t > 2 {
+				ui.PrintError("Temperature must be between 0 and 2")
+				return
+			}
+			temperature = t
+			continue
+		}
+		model = arg
+	}
+
+	if model != "" && model != s.currentModel {
+		restore, err := s.useModel(model)
+		if err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to switch model: %v", err))
+			return
+		}
+		defer restore()
+	}
+
+	s.tree.Commit(s.messages)
+	old := s.messages[last]
+	s.messages = s.messages[:last]
+
+	reply, err := s.generate(temperature)
+	if err != nil || reply == nil {
+		s.messages = append(s.messages, old)
+		if err != nil {
+			ui.PrintError(err.Error())
+		}
+		return
+	}
+
+	s.messages = append(s.messages, *reply)
+	s.keepVersion(old.ID, "the earlier reply")
+}
+
+// useModel switches the provider to model and returns a function that
+// switches back
+func (s *Session) useModel(model string) (func(), error) {
+	previous := s.currentModel
+
+	initialize := func(name string) error {
+		return s.provider.Initialize(providers.Config{
+			Model:       name,
+			Temperature: s.config.Temperature,
+			MaxTokens:   s.config.MaxTokens,
+		})
+	}
+
+	if err := initialize(model); err != nil {
+		initialize(previous)
+		return nil, err
+	}
+	s.currentModel = model
+	s.updateContextLimit()
+
+	return func() {
+		if err := initialize(previous); err != nil {
+			ui.PrintError(fmt.Sprintf("Failed to switch back to %s: %v", previous, err))
+			return
+		}
+		s.currentModel = previous
+		s.updateContextLimit()
+	}, nil
+}
+
+// editCommand rewrites a user message in $EDITOR and regenerates the
+// conversation from it. It edits message n as numbered by /history, or the
+// last user message. The replaced messages are kept on a branch of their
+// own.
+func (s *Session) editCommand(args string) {
+	index := -1
+	if args == "" {
+		for i := len(s.messages) - 1; i >= 0; i-- {
+			if s.messages[i].Role == models.RoleUser {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			ui.PrintError("No message to edit")
+			return
+		}
+	} else {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(s.messages) || s.messages[n-1].Role != models.RoleUser {
+			ui.PrintError("Usage: /edit [n], where n numbers one of your messages in /history")
+			return
+		}
+		index = n - 1
+	}
+
+	old := s.messages[index]
+	content, err := s.editText(old.Content)
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+	if content == "" || content == strings.TrimSpace(old.Content) {
+		ui.PrintInfo("Message unchanged")
+		return
+	}
+
+	s.tree.Commit(s.messages)
+	conversation := s.messages
+	edited := models.Message{
+		Role:      models.RoleUser,
+		Content:   content,
+		Timestamp: old.Timestamp,
+		Pinned:    old.Pinned,
+	}
+
+	s.messages = append(append([]models.Message{}, conversation[:index]...), edited)
+	s.window.Reset()
+
+	reply, err := s.generate(s.config.Temperature)
+	if err != nil || reply == nil {
+		s.messages = conversation
+		if err != nil {
+			ui.PrintError(err.Error())
+		}
+		ui.PrintInfo("Edit discarded")
+		return
+	}
+
+	s.messages = append(s.messages, *reply)
+	s.keepVersion(conversation[len(conversation)-1].ID, "the earlier version")
+}
+
+// undoCommand drops the last exchange: the last reply and the message it
+// answered. Unlike retry and edit it keeps no earlier version, as no
+// message replaces the exchange.
+func (s *Session) undoCommand() {
+	end := len(s.messages)
+	start := end
+	for start > 0 && s.messages[start-1].Role == models.RoleAssistant {
+		start--
+	}
+	if start > 0 && s.messages[start-1].Role == models.RoleUser {
+		start--
+	}
+
+	if start == end {
+		ui.PrintError("Nothing to undo")
+		return
+	}
+
+	s.messages = s.messages[:start]
+	ui.PrintSuccess(fmt.Sprintf("Removed the last exchange (%d messages)", end-start))
+}
+
+// keepVersion keeps the conversation as it was before a retry or edit on a
+// new branch ending at head, the ID of its last committed message. The
+// current branch stays checked out.
+func (s *Session) keepVersion(head, what string) {
+	current := s.tree.Current()
+	name := s.tree.NextBranchName()
+	if err := s.tree.Fork(name, head); err != nil {
+		ui.PrintWarning(fmt.Sprintf("Failed to keep %s: %v", what, err))
+		return
+	}
+	s.tree.Checkout(current)
+	ui.MutedColor.Printf("(%s is kept on branch %s; see /branches)\n", what, name)
+}
+
+// editText opens text in the user's editor and returns the saved result
+func (s *Session) editText(text string) (string, error) {
+	file, err := os.CreateTemp("", "llm-chat-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	file.Close()
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// The editor setting may include arguments, such as "code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Ctrl+C in the editor belongs to the editor, not the session
+	resume := s.interrupts.pause()
+	err = cmd.Run()
+	resume()
+	if err != nil {
+		return "", fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read edited message: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/history"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/registry"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// newTestSession returns a session over an echo provider with a
+// conversation of one exchange
+func newTestSession(t *testing.T) *Session {
+	t.Helper()
+
+	reg := registry.New()
+	if err := reg.Register(&echoProvider{name: "echo"}, providers.Metadata{Name: "echo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.HistoryPath = filepath.Join(dir, "history.json")
+	cfg.UsagePath = filepath.Join(dir, "usage.jsonl")
+
+	s, err := NewSession(reg, cfg, "echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.historyManager.Close() })
+
+	s.interrupts = newInterruptHandler()
+	t.Cleanup(s.interrupts.stop)
+
+	s.messages = []models.Message{
+		{Role: models.RoleUser, Content: "Hi", Timestamp: time.Now()},
+		{Role: models.RoleAssistant, Content: "Hello there", Timestamp: time.Now()},
+	}
+	return s
+}
+
+// lastContents returns the last message of each branch of the session
+func lastContents(t *testing.T, s *Session) map[string]string {
+	t.Helper()
+	s.tree.Commit(s.messages)
+
+	last := make(map[string]string)
+	for _, b := range s.tree.Branches() {
+		path, err := s.tree.Path(b.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last[b.Name] = path[len(path)-1].Content
+	}
+	return last
+}
+
+func TestRetryKeepsBranch(t *testing.T) {
+	s := newTestSession(t)
+	s.retryCommand("")
+
+	want := map[string]string{history.DefaultBranch: "from echo/echo-default", "branch-2": "Hello there"}
+	if got := lastContents(t, s); len(got) != 2 || got[history.DefaultBranch] != want[history.DefaultBranch] || got["branch-2"] != want["branch-2"] {
+		t.Errorf("branches end with %v, want %v", got, want)
+	}
+	if s.tree.Current() != history.DefaultBranch || len(s.messages) != 2 {
+		t.Errorf("on %s with %d messages, want the retried conversation checked out", s.tree.Current(), len(s.messages))
+	}
+
+	// The earlier reply can be checked out again
+	s.checkoutCommand("branch-2")
+	if s.messages[1].Content != "Hello there" || s.messages[0].ID != s.tree.Messages()[0].ID {
+		t.Errorf("checked out %+v", s.messages)
+	}
+}
+
+func TestEditKeepsBranch(t *testing.T) {
+	s := newTestSession(t)
+	t.Setenv("VISUAL", "sed -i s/Hi/Hey/")
+	s.editCommand("")
+
+	s.tree.Commit(s.messages)
+	edited, err := s.tree.Path(history.DefaultBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.tree.Path("branch-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if edited[0].Content != "Hey" || edited[1].Content != "from echo/echo-default" {
+		t.Errorf("edited branch = %+v", edited)
+	}
+	if kept[0].Content != "Hi" || kept[1].Content != "Hello there" || history.Divergence(edited, kept) != 0 {
+		t.Errorf("kept branch = %+v", kept)
+	}
+}
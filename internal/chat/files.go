@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// mentionPattern finds @path mentions: an @ at the start of a word
+// followed by a path, which may contain glob characters
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([^\s@]+)`)
+
+// fileCommand reads files into the next message, lists the staged files
+// when given no paths, or drops them with "clear"
+func (s *Session) fileCommand(args string) {
+	switch args {
+	case "":
+		if len(s.attached) == 0 {
+			ui.PrintInfo("No files attached (usage: /file <path|glob>..., /file clear)")
+			return
+		}
+		PrintAttachments(os.Stdout, &attach.Result{Files: s.attached})
+		return
+	case "clear":
+		s.attached = nil
+		ui.PrintSuccess("Attached files cleared")
+		return
+	}
+
+	result, err := attach.Collect(strings.Fields(args), s.attachLimits())
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	s.attached = append(s.attached, result.Files...)
+	PrintAttachments(os.Stdout, result)
+	if len(result.Files) > 0 {
+		ui.MutedColor.Printf("(%d file(s) will be sent with your next message)\n", len(s.attached))
+	}
+}
+
+// withAttachments returns the content of a user message with the staged
+// files and any files it mentions as @path appended. Mentions that name no
+// file are left as they are, and globs matching nothing are reported as
+// skipped.
+func (s *Session) withAttachments(input string) (string, error) {
+	var paths []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		path := strings.TrimRight(match[1], ".,;:!?)")
+		if _, err := os.Stat(path); err == nil || strings.ContainsAny(path, "*?[") {
+			paths = append(paths, path)
+		}
+	}
+
+	files := s.attached
+	if len(paths) > 0 {
+		limits := s.attachLimits()
+		result, err := attach.Collect(paths, limits)
+		if err != nil {
+			return "", err
+		}
+		PrintAttachments(os.Stdout, result)
+		files = append(files[:len(files):len(files)], result.Files...)
+	}
+
+	if len(files) == 0 {
+		return input, nil
+	}
+
+	return input + "\n\n" + (&attach.Result{Files: files}).Format(), nil
+}
+
+// attachLimits returns the limits for newly attached files, counting the
+// files already staged against the token limit
+func (s *Session) attachLimits() attach.Limits {
+	maxTokens := s.config.AttachMaxTokens
+	if maxTokens == 0 {
+		maxTokens = contextwindow.PromptBudget(s.contextLength(), s.config.MaxTokens) / 2
+	}
+
+	staged := (&attach.Result{Files: s.attached}).Tokens()
+	return attach.Limits{
+		MaxFileSize: s.config.AttachMaxFileSize,
+		MaxTokens:   max(maxTokens-staged, 1),
+	}
+}
+
+// PrintAttachments reports which files were attached, truncated or skipped
+func PrintAttachments(w io.Writer, result *attach.Result) {
+	for _, f := range result.Files {
+		note := ""
+		if f.Truncated {
+			note = fmt.Sprintf(", truncated from %d bytes", f.Size)
+		}
+		fmt.Fprintf(w, "  + %s (%s, ~%d tokens%s)\n", f.Path, f.Language, f.Tokens, note)
+	}
+	for _, skipped := range result.Skipped {
+		fmt.Fprintf(w, "  - %s skipped: %s\n", skipped.Path, skipped.Reason)
+	}
+	if len(result.Files) > 1 {
+		fmt.Fprintf(w, "  %d files, ~%d tokens\n", len(result.Files), result.Tokens())
+	}
+}
@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithAttachments(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestSession(t)
+
+	tests := []struct {
+		name, input string
+		attached    bool
+	}{
+		{"mention", "what does @main.go do?", true},
+		{"glob matching nothing", "compare @*.rs with @main.go", true},
+		{"only an unmatched glob", "are there any @*.rs files?", false},
+		{"not a file", "ask @someone about it", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := s.withAttachments(tt.input)
+			if err != nil {
+				t.Fatalf("message failed: %v", err)
+			}
+			if !strings.HasPrefix(content, tt.input) {
+				t.Errorf("content = %q, want the message first", content)
+			}
+			if got := strings.Contains(content, "```go main.go\npackage main\n```"); got != tt.attached {
+				t.Errorf("main.go attached %v, want %v", got, tt.attached)
+			}
+		})
+	}
+}
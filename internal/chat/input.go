@@ -0,0 +1,180 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+)
+
+// inputReader reads lines on a background goroutine, so that a blocked
+// read can be abandoned when the user quits with Ctrl+C. It only reads
+// when a line is requested, leaving the terminal to other programs, such
+// as an editor, in between.
+type inputReader struct {
+	requests chan struct{}
+	lines    chan string
+	pending  bool // a line was requested but not yet received
+	eof      bool // the input has ended
+}
+
+// newInputReader starts reading lines from r
+func newInputReader(r io.Reader) *inputReader {
+	in := &inputReader{
+		requests: make(chan struct{}),
+		lines:    make(chan string),
+	}
+
+	go func() {
+		defer close(in.lines)
+
+		scanner := bufio.NewScanner(r)
+		// Increase scanner buffer size for longer inputs
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for range in.requests {
+			if !scanner.Scan() {
+				return
+			}
+			in.lines <- scanner.Text()
+		}
+	}()
+
+	return in
+}
+
+// interruptHandler turns SIGINT into session actions: while a reply is
+// being generated Ctrl+C cancels it; at an idle prompt the first Ctrl+C
+// shows a hint and a second one ends the session.
+type interruptHandler struct {
+	mu     sync.Mutex
+	cancel context.CancelFunc // cancels the reply in progress, if any
+	armed  bool               // a Ctrl+C was pressed at the idle prompt
+	paused bool               // another program has the terminal
+	quit   chan struct{}      // closed when the session should end
+	once   sync.Once
+	signal chan os.Signal
+}
+
+// newInterruptHandler starts handling SIGINT until stop is called
+func newInterruptHandler() *interruptHandler {
+	h := &interruptHandler{
+		quit:   make(chan struct{}),
+		signal: make(chan os.Signal, 1),
+	}
+
+	signal.Notify(h.signal, os.Interrupt)
+	go h.run()
+
+	return h
+}
+
+// run reacts to each SIGINT
+func (h *interruptHandler) run() {
+	for range h.signal {
+		h.mu.Lock()
+		if h.paused {
+			h.mu.Unlock()
+			continue
+		}
+		cancel := h.cancel
+		armed := h.armed
+		if cancel == nil {
+			h.armed = true
+		}
+		h.mu.Unlock()
+
+		switch {
+		case cancel != nil:
+			cancel()
+		case armed:
+			h.once.Do(func() { close(h.quit) })
+		default:
+			fmt.Println()
+			ui.PrintInfo("Press Ctrl+C again to exit, or type /exit")
+			ui.PrintUserPrompt()
+		}
+	}
+}
+
+// generating returns a context for a reply that Ctrl+C cancels, and a
+// function to call once the reply is finished
+func (h *interruptHandler) generating() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.mu.Lock()
+	h.cancel = cancel
+	h.armed = false
+	h.mu.Unlock()
+
+	return ctx, func() {
+		h.mu.Lock()
+		h.cancel = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// disarm forgets an idle Ctrl+C once the user types something
+func (h *interruptHandler) disarm() {
+	h.mu.Lock()
+	h.armed = false
+	h.mu.Unlock()
+}
+
+// pause ignores Ctrl+C while another program, such as an editor, has the
+// terminal and gets the signal itself. The returned function resumes
+// handling with no Ctrl+C pending.
+func (h *interruptHandler) pause() func() {
+	h.mu.Lock()
+	h.paused = true
+	h.mu.Unlock()
+
+	return func() {
+		h.mu.Lock()
+		h.paused = false
+		h.armed = false
+		h.mu.Unlock()
+	}
+}
+
+// stop restores the default SIGINT behavior
+func (h *interruptHandler) stop() {
+	signal.Stop(h.signal)
+	close(h.signal)
+}
+
+// readLine returns the next line of input. It returns false at the end of
+// input, or once the user has quit with Ctrl+C.
+func (s *Session) readLine() (string, bool) {
+	if s.input.eof {
+		return "", false
+	}
+
+	if !s.input.pending {
+		select {
+		case s.input.requests <- struct{}{}:
+			s.input.pending = true
+		case <-s.interrupts.quit:
+			return "", false
+		}
+	}
+
+	select {
+	case line, ok := <-s.input.lines:
+		s.input.pending = false
+		if !ok {
+			s.input.eof = true
+			return "", false
+		}
+		s.interrupts.disarm()
+		return line, true
+	case <-s.interrupts.quit:
+		return "", false
+	}
+}
@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// Output formats of shell mode
+const (
+	FormatText     = "text"
+	FormatRaw      = "raw"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+	FormatMarkdown = "markdown"
+)
+
+// Result is a shell mode reply as written by the json format and the
+// final event of the jsonl format
+type Result struct {
+	Response     string        `json:"response"`
+	Provider     string        `json:"provider"`
+	Model        string        `json:"model"`
+	Usage        *models.Usage `json:"usage,omitempty"`
+	FinishReason string        `json:"finish_reason,omitempty"`
+	Interrupted  bool          `json:"interrupted,omitempty"`
+	Cost         float64       `json:"cost,omitempty"`
+	DurationMS   int64         `json:"duration_ms"`
+	FirstTokenMS int64         `json:"first_token_ms,omitempty"`
+}
+
+// ErrorInfo describes a failure in the json and jsonl formats. Class is
+// one of the provider error classes, or "unknown".
+type ErrorInfo struct {
+	Message   string `json:"message"`
+	Class     string `json:"class"`
+	Retryable bool   `json:"retryable"`
+}
+
+// event is one line of the jsonl format. Target names the provider and
+// model a comparison's event is about.
+type event struct {
+	Type     string     `json:"type"` // start, delta, done or error
+	Target   string     `json:"target,omitempty"`
+	Provider string     `json:"provider,omitempty"`
+	Model    string     `json:"model,omitempty"`
+	Content  string     `json:"content,omitempty"`
+	Result   *Result    `json:"result,omitempty"`
+	Error    *ErrorInfo `json:"error,omitempty"`
+}
+
+// output writes a streamed reply in one of the shell mode formats. Text
+// formats stream as the reply arrives; json writes one object at the end
+// and jsonl writes an event per chunk.
+type output struct {
+	w       io.Writer
+	format  string
+	verbose bool
+	enc     *json.Encoder
+}
+
+// newOutput returns an output writing to w in the given format
+func newOutput(w io.Writer, format string, verbose bool) *output {
+	return &output{w: w, format: format, verbose: verbose, enc: json.NewEncoder(w)}
+}
+
+// start is called before the reply arrives
+func (o *output) start(provider, model string) {
+	switch o.format {
+	case FormatJSONL:
+		o.enc.Encode(event{Type: "start", Provider: provider, Model: model})
+	case FormatMarkdown:
+		fmt.Fprintf(o.w, "---\nprovider: %s\nmodel: %s\ndate: %s\n---\n\n", provider, model, time.Now().Format(time.RFC3339))
+	}
+}
+
+// chunk writes part of the reply
+func (o *output) chunk(content string) {
+	if content == "" {
+		return
+	}
+
+	switch o.format {
+	case FormatJSON:
+		// Written whole by finish
+	case FormatJSONL:
+		o.enc.Encode(event{Type: "delta", Content: content})
+	default:
+		fmt.Fprint(o.w, content)
+	}
+}
+
+// finish writes the end of the reply, which may have been interrupted
+func (o *output) finish(result Result) {
+	switch o.format {
+	case FormatJSON:
+		o.enc.Encode(result)
+	case FormatJSONL:
+		o.enc.Encode(event{Type: "done", Result: &result})
+	case FormatRaw:
+		// Exactly the reply
+	default:
+		fmt.Fprintln(o.w)
+		if o.verbose {
+			ui.PrintMetrics(time.Duration(result.DurationMS)*time.Millisecond, result.Usage, result.Cost)
+		}
+	}
+}
+
+// IsStructured reports whether a format is meant for programs, so that
+// errors must be written in it too
+func IsStructured(format string) bool {
+	return format == FormatJSON || format == FormatJSONL
+}
+
+// WriteError writes err in a structured format: an object with an error
+// member for json, an error event for jsonl
+func WriteError(w io.Writer, format string, err error) {
+	info := newErrorInfo(err)
+
+	enc := json.NewEncoder(w)
+	if format == FormatJSONL {
+		enc.Encode(event{Type: "error", Error: info})
+		return
+	}
+	enc.Encode(struct {
+		Error *ErrorInfo `json:"error"`
+	}{info})
+}
+
+// newErrorInfo describes err for the structured formats
+func newErrorInfo(err error) *ErrorInfo {
+	class := providers.ClassOf(err)
+	return &ErrorInfo{Message: err.Error(), Class: string(class), Retryable: class.Retryable()}
+}
@@ -2,16 +2,16 @@
 package chat
 
 import (
-	"bufio"
-	"context"
-	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/soyomarvaldezg/llm-chat/internal/assessment"
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
 	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+	"github.com/soyomarvaldezg/llm-chat/internal/cost"
 	"github.com/soyomarvaldezg/llm-chat/internal/history"
 	"github.com/soyomarvaldezg/llm-chat/internal/providers"
 	"github.com/soyomarvaldezg/llm-chat/internal/registry"
@@ -25,12 +25,27 @@ type Session struct {
 	registry          *registry.Registry
 	config            *config.Config
 	messages          []models.Message
-	scanner           *bufio.Scanner
+	input             *inputReader
+	interrupts        *interruptHandler
 	currentModel      string
 	analyzer          *assessment.Analyzer
 	improver          *assessment.Improver
 	historyManager    *history.Manager
+	costs             *costTracker
+	window            *contextwindow.Manager
+	dropped           int // messages left out of the last request
 	conversationStart time.Time
+	tags              []string
+	kind              string        // the history kind of a resumed conversation
+	attached          []attach.File // files to send with the next message
+
+	// tree keeps every branch of the conversation; messages is the
+	// checked-out one and is recorded into the tree before branches change
+	tree *history.Tree
+
+	// conversationID is the history ID this session saves to; it is set on
+	// first save, or when a saved conversation is resumed
+	conversationID string
 }
 
 // NewSession creates a new chat session
@@ -45,8 +60,13 @@ func NewSession(reg *registry.Registry, cfg *config.Config, providerName string)
 	}
 
 	// Initialize the provider with config
+	model := cfg.Model
+	if model == "" {
+		model = provider.DefaultModel()
+	}
+
 	providerCfg := providers.Config{
-		Model:       provider.DefaultModel(),
+		Model:       model,
 		Temperature: cfg.Temperature,
 		MaxTokens:   cfg.MaxTokens,
 	}
@@ -56,7 +76,7 @@ func NewSession(reg *registry.Registry, cfg *config.Config, providerName string)
 	}
 
 	// Initialize history manager
-	historyMgr, err := history.NewManager()
+	historyMgr, err := OpenHistory(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize history: %w", err)
 	}
@@ -65,22 +85,34 @@ func NewSession(reg *registry.Registry, cfg *config.Config, providerName string)
 		provider:          provider,
 		registry:          reg,
 		config:            cfg,
-		messages:          make([]models.Message, 0),
-		scanner:           bufio.NewScanner(os.Stdin),
+		input:             newInputReader(os.Stdin),
 		currentModel:      provider.DefaultModel(),
 		analyzer:          assessment.NewAnalyzer(),
 		improver:          assessment.NewImprover(provider),
 		historyManager:    historyMgr,
+		costs:             newCostTracker(cfg),
 		conversationStart: time.Now(),
+		tree:              history.NewTree(),
 	}
 
-	// Increase scanner buffer size for longer inputs
-	buf := make([]byte, 0, 64*1024)
-	session.scanner.Buffer(buf, 1024*1024)
+	session.messages = session.initialMessages()
+	session.window = session.newContextWindow()
 
 	return session, nil
 }
 
+// OpenHistory opens the conversation history described by the configuration
+func OpenHistory(cfg *config.Config) (*history.Manager, error) {
+	return history.NewManager(history.Config{
+		Path:             cfg.HistoryPath,
+		Backend:          cfg.HistoryBackend,
+		MaxConversations: cfg.MaxHistory,
+		MaxAge:           cfg.HistoryMaxAge,
+		MaxSize:          cfg.HistoryMaxSize,
+		Archive:          cfg.HistoryArchive,
+	})
+}
+
 // Start begins the interactive chat session
 func (s *Session) Start() error {
 	ui.ClearScreen()
@@ -89,15 +121,23 @@ func (s *Session) Start() error {
 	/* ui.PrintHelp() */
 	ui.PrintSeparator()
 
+	if s.conversationID != "" {
+		s.printResumed()
+	}
+
+	// Ctrl+C cancels a reply in progress instead of ending the session
+	s.interrupts = newInterruptHandler()
+	defer s.interrupts.stop()
+
 	for {
 		ui.PrintUserPrompt()
 
 		// Read first line
-		if !s.scanner.Scan() {
+		firstLine, ok := s.readLine()
+		if !ok {
 			break
 		}
 
-		firstLine := s.scanner.Text()
 		trimmedFirst := strings.TrimSpace(firstLine)
 
 		// If it's a command, execute immediately (single Enter)
@@ -120,8 +160,11 @@ func (s *Session) Start() error {
 			continue
 		}
 
-		for s.scanner.Scan() {
-			line := s.scanner.Text()
+		for {
+			line, ok := s.readLine()
+			if !ok {
+				break
+			}
 			// Check if line is empty
 			if strings.TrimSpace(line) == "" {
 				emptyLineCount++
@@ -158,9 +201,10 @@ func (s *Session) Start() error {
 	}
 
 	// Save conversation to history if not disabled
-	if !s.config.NoHistory && len(s.messages) > 0 {
+	if !s.config.NoHistory && s.hasUserMessages() {
 		s.saveConversation()
 	}
+	s.historyManager.Close()
 
 	ui.PrintSystemMessage("Goodbye! 👋")
 	return nil
@@ -183,23 +227,77 @@ func (s *Session) handleCommand(cmd string) bool {
 		ui.PrintProviderInfo(s.provider.Name(), s.currentModel, "ready")
 
 	case cmdLower == "/reset":
-		s.messages = make([]models.Message, 0)
+		s.messages = s.initialMessages()
+		s.conversationID = ""
+		s.conversationStart = time.Now()
+		s.tags = nil
+		s.kind = ""
+		s.attached = nil
+		s.tree = history.NewTree()
+		s.window.Reset()
+		s.dropped = 0
 		ui.PrintSuccess("Conversation reset")
 
+	case cmdLower == "/resume" || strings.HasPrefix(cmdLower, "/resume "):
+		s.resumeCommand(strings.TrimSpace(cmd[len("/resume"):]))
+
+	case cmdLower == "/system" || strings.HasPrefix(cmdLower, "/system "):
+		s.systemCommand(strings.TrimSpace(cmd[len("/system"):]))
+
+	case cmdLower == "/persona" || strings.HasPrefix(cmdLower, "/persona "):
+		s.personaCommand(strings.TrimSpace(cmd[len("/persona"):]))
+
 	case cmdLower == "/history":
 		s.showHistory()
 
+	case cmdLower == "/retry" || strings.HasPrefix(cmdLower, "/retry "):
+		s.retryCommand(strings.TrimSpace(cmd[len("/retry"):]))
+
+	case cmdLower == "/edit" || strings.HasPrefix(cmdLower, "/edit "):
+		s.editCommand(strings.TrimSpace(cmd[len("/edit"):]))
+
+	case cmdLower == "/undo":
+		s.undoCommand()
+
+	case cmdLower == "/branch" || strings.HasPrefix(cmdLower, "/branch "):
+		s.branchCommand(strings.Fields(cmd[len("/branch"):]))
+
+	case cmdLower == "/branches":
+		s.showBranches()
+
+	case cmdLower == "/checkout" || strings.HasPrefix(cmdLower, "/checkout "):
+		s.checkoutCommand(strings.TrimSpace(cmd[len("/checkout"):]))
+
+	case cmdLower == "/compare" || strings.HasPrefix(cmdLower, "/compare "):
+		s.compareCommand(strings.TrimSpace(cmd[len("/compare"):]))
+
+	case cmdLower == "/file" || strings.HasPrefix(cmdLower, "/file "):
+		s.fileCommand(strings.TrimSpace(cmd[len("/file"):]))
+
+	case cmdLower == "/context":
+		s.showContext()
+
+	case cmdLower == "/pin" || strings.HasPrefix(cmdLower, "/pin "):
+		s.pinCommand(strings.TrimSpace(cmd[len("/pin"):]), true)
+
+	case cmdLower == "/unpin" || strings.HasPrefix(cmdLower, "/unpin "):
+		s.pinCommand(strings.TrimSpace(cmd[len("/unpin"):]), false)
+
 	case cmdLower == "/saved":
 		s.showSavedHistory()
 
-	case cmdLower == "/search":
-		s.searchHistory()
+	case cmdLower == "/search" || strings.HasPrefix(cmdLower, "/search "):
+		s.searchHistory(strings.TrimSpace(cmd[len("/search"):]))
+
+	case cmdLower == "/tag" || strings.HasPrefix(cmdLower, "/tag "):
+		s.tagConversation(strings.Fields(cmd[len("/tag"):]))
 
 	case cmdLower == "/export":
 		s.exportConversation()
 
 	case cmdLower == "/stats":
 		s.showHistoryStats()
+		s.showSpend()
 
 	case cmdLower == "/models":
 		s.showModels()
@@ -227,76 +325,227 @@ func (s *Session) handleCommand(cmd string) bool {
 	return false
 }
 
+// initialMessages returns the messages a fresh conversation starts with
+func (s *Session) initialMessages() []models.Message {
+	messages := make([]models.Message, 0)
+	if s.config.SystemPrompt != "" {
+		messages = append(messages, models.Message{
+			Role:      models.RoleSystem,
+			Content:   s.config.SystemPrompt,
+			Timestamp: time.Now(),
+		})
+	}
+	return messages
+}
+
+// hasUserMessages reports whether the conversation contains any user input
+func (s *Session) hasUserMessages() bool {
+	for _, msg := range s.messages {
+		if msg.Role == models.RoleUser {
+			return true
+		}
+	}
+	return false
+}
+
+// requestMetadata returns the metadata sent with every request, which the
+// router's rules can match
+func (s *Session) requestMetadata() map[string]string {
+	return map[string]string{
+		providers.MetadataMode: "interactive",
+		providers.MetadataTags: strings.Join(s.tags, ","),
+	}
+}
+
 // processMessage sends a message to the LLM and displays the response
 func (s *Session) processMessage(input string) error {
+	content, err := s.withAttachments(input)
+	if err != nil {
+		return err
+	}
+
 	// Add user message to history
 	userMsg := models.Message{
 		Role:      models.RoleUser,
-		Content:   input,
+		Content:   content,
 		Timestamp: time.Now(),
 	}
 	s.messages = append(s.messages, userMsg)
 
+	reply, err := s.generate(s.config.Temperature)
+	if err != nil || reply == nil {
+		// Forget the prompt so it can be sent again
+		s.messages = s.messages[:len(s.messages)-1]
+		return err
+	}
+
+	s.messages = append(s.messages, *reply)
+	s.attached = nil
+	return nil
+}
+
+// generate streams a reply to the conversation, which ends with a user
+// message, and returns it without adding it to the conversation. It returns
+// nil if the user cancelled before any text arrived.
+func (s *Session) generate(temperature float64) (*models.Message, error) {
+	warning, err := s.costs.checkBudget()
+	if err != nil {
+		return nil, err
+	}
+	if warning != "" {
+		ui.PrintWarning(warning)
+	}
+
+	ctx, done := s.interrupts.generating()
+	defer done()
+
+	// Fit the conversation into the model's context window
+	window, err := s.window.Build(ctx, s.messages)
+	if ctx.Err() != nil {
+		ui.PrintInfo("Generation cancelled")
+		return nil, nil
+	}
+	if err != nil {
+		ui.PrintWarning(err.Error() + "; older messages were left out instead")
+	}
+	if window.Dropped > 0 && window.Dropped != s.dropped {
+		ui.MutedColor.Printf("\n(%d older messages no longer fit in the context window and were not sent; see /context)\n", window.Dropped)
+	}
+	s.dropped = window.Dropped
+
 	// Create chat request
 	req := models.ChatRequest{
-		Messages:    s.messages,
-		Temperature: s.config.Temperature,
+		Messages:    window.Messages,
+		Temperature: models.Temperature(temperature),
 		MaxTokens:   s.config.MaxTokens,
 		Stream:      true,
+		Metadata:    s.requestMetadata(),
 	}
 
 	// Print assistant prefix
 	ui.PrintAssistantPrefix(s.currentModel)
 
-	ctx := context.Background()
 	start := time.Now()
 
 	// Stream the response
 	streamChan, err := s.provider.StreamMessage(ctx, req)
 	if err != nil {
-		return fmt.Errorf("failed to stream message: %w", err)
+		if ctx.Err() != nil {
+			fmt.Println()
+			ui.PrintInfo("Generation cancelled")
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stream message: %w", err)
 	}
 
 	var fullResponse strings.Builder
-	tokenCount := 0
+	var usage *models.Usage
+	finishReason := ""
+	interrupted := false
 
-	for chunk := range streamChan {
-		if chunk.Error != nil {
-			return fmt.Errorf("stream error: %w", chunk.Error)
-		}
+	// The router reports which backend answered
+	providerName, model := s.provider.Name(), s.provider.DefaultModel()
 
-		// Stream raw - fast and clean
-		fmt.Print(chunk.Content)
-		fullResponse.WriteString(chunk.Content)
+stream:
+	for {
+		select {
+		case <-ctx.Done():
+			interrupted = true
+			break stream
+		case chunk, ok := <-streamChan:
+			if !ok {
+				break stream
+			}
+			if chunk.Error != nil {
+				if ctx.Err() != nil {
+					interrupted = true
+					break stream
+				}
+				return nil, fmt.Errorf("stream error: %w", chunk.Error)
+			}
+			if chunk.Usage != nil {
+				usage = chunk.Usage
+			}
+			if chunk.FinishReason != "" {
+				finishReason = chunk.FinishReason
+			}
+			if chunk.ProviderName != "" {
+				providerName, model = chunk.ProviderName, chunk.ModelName
+			}
 
-		// Approximate token count (rough estimate)
-		tokenCount += len(strings.Fields(chunk.Content))
+			// Stream raw - fast and clean
+			fmt.Print(chunk.Content)
+			fullResponse.WriteString(chunk.Content)
+		}
 	}
 
 	responseTime := time.Since(start)
 
-	// Add assistant response to history
-	assistantMsg := models.Message{
-		Role:      models.RoleAssistant,
-		Content:   fullResponse.String(),
-		Timestamp: time.Now(),
+	amount, err := s.costs.record(providerName, model, usage)
+	if err != nil {
+		ui.PrintWarning(err.Error())
+	}
+
+	if interrupted && fullResponse.Len() == 0 {
+		fmt.Println()
+		ui.PrintInfo("Generation cancelled")
+		return nil, nil
+	}
+
+	// Keep a partial reply so the conversation can continue from it
+	reply := &models.Message{
+		Role:         models.RoleAssistant,
+		Content:      fullResponse.String(),
+		Timestamp:    time.Now(),
+		Model:        model,
+		Interrupted:  interrupted,
+		Usage:        usage,
+		FinishReason: finishReason,
+		Cost:         amount,
+		DurationMS:   responseTime.Milliseconds(),
+	}
+	if providerName != s.provider.Name() {
+		reply.Provider = providerName
+	}
+
+	if interrupted {
+		fmt.Println()
+		ui.MutedColor.Println("[interrupted]")
 	}
-	s.messages = append(s.messages, assistantMsg)
 
 	// Show metrics if verbose mode is enabled
 	if s.config.Verbose {
-		ui.PrintMetrics(responseTime, tokenCount)
+		if reply.Provider != "" {
+			ui.MutedColor.Printf("\n(answered by %s/%s)", providerName, model)
+		}
+		ui.PrintMetrics(responseTime, usage, amount)
 	} else {
 		fmt.Println() // Just add a newline
 	}
 
-	return nil
+	return reply, nil
 }
 
 // assessPrompt analyzes and displays prompt quality
 func (s *Session) assessPrompt(prompt string) {
 	result := s.analyzer.Analyze(prompt)
 
+	PrintAssessment(result)
+
+	// Offer to improve if score is low
+	if result.OverallScore < 75 && s.config.AutoImprove {
+		ui.PromptConfirmation("Would you like me to improve this prompt?")
+		response, _ := s.readLine()
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		if response == "y" || response == "yes" {
+			s.improvePromptWithAssessment(prompt, result)
+		}
+	}
+}
+
+// PrintAssessment displays a prompt assessment report
+func PrintAssessment(result *assessment.Assessment) {
 	ui.PrintSeparator()
 	ui.InfoColor.Println("📊 PROMPT ASSESSMENT")
 	ui.PrintSeparator()
@@ -343,17 +592,6 @@ func (s *Session) assessPrompt(prompt string) {
 	}
 
 	ui.PrintSeparator()
-
-	// Offer to improve if score is low
-	if result.OverallScore < 75 && s.config.AutoImprove {
-		ui.PromptConfirmation("Would you like me to improve this prompt?")
-		s.scanner.Scan()
-		response := strings.ToLower(strings.TrimSpace(s.scanner.Text()))
-
-		if response == "y" || response == "yes" {
-			s.improvePromptWithAssessment(prompt, result)
-		}
-	}
 }
 
 // improvePrompt analyzes and improves a prompt
@@ -413,8 +651,8 @@ func (s *Session) improvePromptWithAssessment(prompt string, result *assessment.
 	ui.PrintSeparator()
 
 	ui.PromptConfirmation("Use this improved prompt?")
-	s.scanner.Scan()
-	response := strings.ToLower(strings.TrimSpace(s.scanner.Text()))
+	response, _ := s.readLine()
+	response = strings.ToLower(strings.TrimSpace(response))
 
 	if response == "y" || response == "yes" {
 		// Process the improved prompt
@@ -451,6 +689,7 @@ func (s *Session) showHistory() {
 	ui.PrintInfo(fmt.Sprintf("Conversation History (%d messages)", len(s.messages)))
 	ui.PrintSeparator()
 
+	forks := s.forkMarks()
 	for i, msg := range s.messages {
 		timestamp := msg.Timestamp.Format("15:04:05")
 		prefix := ""
@@ -460,9 +699,18 @@ func (s *Session) showHistory() {
 			prefix = ui.UserEmoji + " You"
 		case models.RoleAssistant:
 			prefix = ui.AssistantEmoji + " Assistant"
+			if msg.Interrupted {
+				prefix += " [interrupted]"
+			}
 		case models.RoleSystem:
 			prefix = ui.SystemEmoji + " System"
 		}
+		if msg.Pinned {
+			prefix += " 📌"
+		}
+		if names := forks[i]; len(names) > 0 {
+			prefix += fmt.Sprintf(" [branches: %s]", strings.Join(names, ", "))
+		}
 
 		fmt.Printf("\n[%d] %s (%s):\n%s\n", i+1, prefix, timestamp, msg.Content)
 	}
@@ -479,12 +727,18 @@ func (s *Session) showModels() {
 
 // showProviders displays all registered providers
 func (s *Session) showProviders() {
+	PrintProviders(s.registry)
+}
+
+// PrintProviders displays every registered provider with its availability
+func PrintProviders(reg *registry.Registry) {
 	ui.PrintSeparator()
 	ui.PrintInfo("Available Providers")
 	ui.PrintSeparator()
 
-	allProviders := s.registry.GetAll()
-	for _, info := range allProviders {
+	allProviders := reg.GetAll()
+	for _, name := range reg.List() {
+		info := allProviders[name]
 		status := "❌"
 		statusText := "not available"
 		if info.Available {
@@ -532,8 +786,8 @@ func (s *Session) switchModel() {
 
 	fmt.Print("\nEnter model number (or 0 to cancel): ")
 
-	s.scanner.Scan()
-	input := strings.TrimSpace(s.scanner.Text())
+	input, _ := s.readLine()
+	input = strings.TrimSpace(input)
 
 	var choice int
 	if _, err := fmt.Sscanf(input, "%d", &choice); err != nil {
@@ -566,34 +820,199 @@ func (s *Session) switchModel() {
 	}
 
 	s.currentModel = newModel
+	s.updateContextLimit()
 	ui.PrintSuccess(fmt.Sprintf("Switched to model: %s", newModel))
 }
 
 // saveConversation saves the current conversation to history
 func (s *Session) saveConversation() {
-	if len(s.messages) == 0 {
+	if !s.hasUserMessages() {
 		return
 	}
 
+	if s.conversationID == "" {
+		s.conversationID = history.NewID()
+	}
+
+	if err := s.historyManager.AddConversation(s.conversation(s.conversationID)); err != nil {
+		// Silently fail - don't interrupt user experience
+		fmt.Printf("\nWarning: Failed to save conversation: %v\n", err)
+	}
+}
+
+// conversation returns the session as a history entry with the given ID,
+// including every branch
+func (s *Session) conversation(id string) history.Conversation {
+	s.tree.Commit(s.messages)
+
 	conv := history.Conversation{
-		ID:        fmt.Sprintf("conv_%d", time.Now().Unix()),
+		ID:        id,
 		Provider:  s.provider.Name(),
 		Model:     s.currentModel,
-		Messages:  s.messages,
+		Messages:  s.tree.Messages(),
+		Branches:  s.tree.Branches(),
+		Branch:    s.tree.Current(),
 		StartTime: s.conversationStart,
 		EndTime:   time.Now(),
+		Tags:      s.tags,
+		Persona:   s.config.Persona,
+		Kind:      s.kind,
+	}
+	if usage := models.TotalUsage(conv.Messages); usage != nil {
+		conv.Usage = usage
+		conv.TokensUsed = usage.Total()
+	}
+	for _, msg := range conv.Messages {
+		conv.Cost += msg.Cost
 	}
 
-	if err := s.historyManager.AddConversation(conv); err != nil {
-		// Silently fail - don't interrupt user experience
-		fmt.Printf("\nWarning: Failed to save conversation: %v\n", err)
+	return conv
+}
+
+// Resume loads a saved conversation into the session, switching to the
+// provider and model it used. The ID may be any unique prefix; an empty ID
+// resumes the most recently saved conversation. Later saves update the
+// same history entry.
+func (s *Session) Resume(convID string) error {
+	// Pick up conversations saved by other sessions
+	if err := s.historyManager.Load(); err != nil {
+		return err
+	}
+
+	var (
+		conv *history.Conversation
+		err  error
+	)
+	if convID == "" {
+		conv, err = s.historyManager.Latest()
+	} else {
+		conv, err = s.historyManager.Find(convID)
+	}
+	if err != nil {
+		return err
+	}
+
+	provider := s.provider
+	if conv.Provider != provider.Name() {
+		provider, err = s.registry.Get(conv.Provider)
+		if err != nil {
+			return fmt.Errorf("failed to get provider: %w", err)
+		}
+		if !provider.IsAvailable() {
+			return fmt.Errorf("provider %s is not available", conv.Provider)
+		}
+	}
+
+	providerCfg := providers.Config{
+		Model:       conv.Model,
+		Temperature: s.config.Temperature,
+		MaxTokens:   s.config.MaxTokens,
+	}
+
+	if err := provider.Initialize(providerCfg); err != nil {
+		return fmt.Errorf("failed to initialize provider: %w", err)
+	}
+
+	tree := conv.Tree()
+	messages, err := tree.Path(tree.Current())
+	if err != nil {
+		return err
+	}
+
+	s.provider = provider
+	s.improver = assessment.NewImprover(provider)
+	s.currentModel = conv.Model
+	s.messages = messages
+	s.tree = tree
+	s.conversationID = conv.ID
+	s.conversationStart = conv.StartTime
+	s.tags = append([]string{}, conv.Tags...)
+	s.kind = conv.Kind
+	s.window.Reset()
+	s.dropped = 0
+	s.updateContextLimit()
+
+	// The conversation keeps the system prompt it was saved with
+	s.config.SystemPrompt = ""
+	if len(messages) > 0 && messages[0].Role == models.RoleSystem {
+		s.config.SystemPrompt = messages[0].Content
+	}
+	s.config.Persona = conv.Persona
+
+	return nil
+}
+
+// resumeCommand saves the current conversation and switches to a saved one
+func (s *Session) resumeCommand(convID string) {
+	if convID == "" {
+		ui.PrintError("Usage: /resume <id> (see /saved for IDs)")
+		return
+	}
+
+	if !s.config.NoHistory {
+		s.saveConversation()
+	}
+
+	if err := s.Resume(convID); err != nil {
+		ui.PrintError(fmt.Sprintf("Failed to resume: %v", err))
+		return
+	}
+
+	s.printResumed()
+}
+
+// printResumed summarizes a resumed conversation and repeats its last exchange
+func (s *Session) printResumed() {
+	count := 0
+	for _, msg := range s.messages {
+		if msg.Role != models.RoleSystem {
+			count++
+		}
+	}
+
+	ui.PrintSuccess(fmt.Sprintf("Resumed %s (%d messages) with %s (%s)",
+		s.conversationID, count, s.provider.Name(), s.currentModel))
+	if branches := s.tree.Branches(); len(branches) > 1 {
+		ui.MutedColor.Printf("On branch %s of %d (see /branches)\n", s.tree.Current(), len(branches))
+	}
+
+	s.printLastExchange()
+}
+
+// printLastExchange repeats the last user message and the replies to it
+func (s *Session) printLastExchange() {
+	start := len(s.messages)
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Role == models.RoleUser {
+			start = i
+			break
+		}
+	}
+
+	for _, msg := range s.messages[start:] {
+		preview := msg.Content
+		if len(preview) > 300 {
+			preview = preview[:300] + "..."
+		}
+
+		if msg.Role == models.RoleUser {
+			ui.UserColor.Printf("\n%s You: ", ui.UserEmoji)
+			fmt.Println(preview)
+		} else {
+			ui.PrintAssistantPrefix(s.currentModel)
+			ui.PrintAssistantChunk(preview)
+			fmt.Println()
+		}
 	}
 }
 
 // showSavedHistory displays saved conversations from disk
 func (s *Session) showSavedHistory() {
-	conversations := s.historyManager.GetRecent(10)
+	PrintSavedConversations(s.historyManager.GetRecent(10))
+}
 
+// PrintSavedConversations displays a list of saved conversations with previews
+func PrintSavedConversations(conversations []history.Conversation) {
 	if len(conversations) == 0 {
 		ui.PrintInfo("No saved conversations")
 		return
@@ -604,17 +1023,30 @@ func (s *Session) showSavedHistory() {
 	ui.PrintSeparator()
 
 	for i, conv := range conversations {
+		thread := conv.Thread()
 		duration := conv.EndTime.Sub(conv.StartTime).Round(time.Second)
-		fmt.Printf("%d. %s with %s (%s)\n",
-			len(conversations)-i,
-			conv.StartTime.Format("2006-01-02 15:04"),
-			conv.Provider,
-			conv.Model,
-		)
-		fmt.Printf("   Duration: %s | Messages: %d\n", duration, len(conv.Messages))
+		if conv.Kind == history.KindComparison {
+			names := make([]string, len(conv.Branches))
+			for j, b := range conv.Branches {
+				names[j] = b.Name
+			}
+			fmt.Printf("%d. %s comparison of %s\n",
+				len(conversations)-i,
+				conv.StartTime.Format("2006-01-02 15:04"),
+				strings.Join(names, ", "),
+			)
+		} else {
+			fmt.Printf("%d. %s with %s (%s)\n",
+				len(conversations)-i,
+				conv.StartTime.Format("2006-01-02 15:04"),
+				conv.Provider,
+				conv.Model,
+			)
+		}
+		fmt.Printf("   ID: %s | Duration: %s | Messages: %d\n", conv.ID, duration, len(conv.Messages))
 
 		// Show first user message as preview
-		for _, msg := range conv.Messages {
+		for _, msg := range thread {
 			if msg.Role == models.RoleUser {
 				preview := msg.Content
 				if len(preview) > 60 {
@@ -630,45 +1062,108 @@ func (s *Session) showSavedHistory() {
 	ui.PrintSeparator()
 }
 
-// searchHistory searches through saved conversations
-func (s *Session) searchHistory() {
-	fmt.Print("Enter search query: ")
-	s.scanner.Scan()
-	query := strings.TrimSpace(s.scanner.Text())
+// searchHistory searches through saved conversations, asking for a query
+// if none was given
+func (s *Session) searchHistory(query string) {
+	if query == "" {
+		fmt.Print("Enter search query: ")
+		line, _ := s.readLine()
+		query = strings.TrimSpace(line)
+	}
 
 	if query == "" {
 		ui.PrintError("Query cannot be empty")
 		return
 	}
 
-	results := s.historyManager.Search(query)
+	results, err := s.historyManager.Search(query)
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
+	}
+
+	PrintSearchResults(results, query, 10)
+}
+
+// tagConversation adds tags to the current conversation, or lists them.
+// A tag prefixed with "-" is removed instead.
+func (s *Session) tagConversation(args []string) {
+	if len(args) == 0 {
+		if len(s.tags) == 0 {
+			ui.PrintInfo("No tags (usage: /tag <name>... , /tag -<name> to remove)")
+		} else {
+			ui.PrintInfo("Tags: " + strings.Join(s.tags, ", "))
+		}
+		return
+	}
+
+	for _, arg := range args {
+		tag := strings.ToLower(strings.TrimPrefix(arg, "-"))
+		if tag == "" {
+			continue
+		}
+
+		index := -1
+		for i, t := range s.tags {
+			if t == tag {
+				index = i
+				break
+			}
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			if index >= 0 {
+				s.tags = append(s.tags[:index], s.tags[index+1:]...)
+			}
+		} else if index < 0 {
+			s.tags = append(s.tags, tag)
+		}
+	}
 
+	if len(s.tags) == 0 {
+		ui.PrintSuccess("Tags cleared")
+	} else {
+		ui.PrintSuccess("Tags: " + strings.Join(s.tags, ", "))
+	}
+}
+
+// PrintSearchResults displays ranked search results with highlighted
+// excerpts, showing at most limit results (zero shows all)
+func PrintSearchResults(results []history.SearchResult, query string, limit int) {
 	if len(results) == 0 {
 		ui.PrintInfo(fmt.Sprintf("No conversations found matching '%s'", query))
 		return
 	}
 
 	ui.PrintSeparator()
-	ui.PrintInfo(fmt.Sprintf("Found %d conversation(s)", len(results)))
+	if limit > 0 && len(results) > limit {
+		ui.PrintInfo(fmt.Sprintf("Found %d conversation(s), showing top %d", len(results), limit))
+		results = results[:limit]
+	} else {
+		ui.PrintInfo(fmt.Sprintf("Found %d conversation(s)", len(results)))
+	}
 	ui.PrintSeparator()
 
-	for i, conv := range results {
-		fmt.Printf("%d. %s with %s\n",
+	for i, result := range results {
+		conv := result.Conversation
+		fmt.Printf("%d. %s with %s (%s) [%s]",
 			i+1,
 			conv.StartTime.Format("2006-01-02 15:04"),
 			conv.Provider,
+			conv.Model,
+			conv.ID,
 		)
+		if result.Score > 0 {
+			ui.MutedColor.Printf(" score %.2f", result.Score)
+		}
+		fmt.Println()
 
-		// Show matching excerpt
-		for _, msg := range conv.Messages {
-			if strings.Contains(strings.ToLower(msg.Content), strings.ToLower(query)) {
-				preview := msg.Content
-				if len(preview) > 100 {
-					preview = preview[:100] + "..."
-				}
-				fmt.Printf("   Match: %s\n", preview)
-				break
-			}
+		if len(conv.Tags) > 0 {
+			ui.MutedColor.Printf("   Tags: %s\n", strings.Join(conv.Tags, ", "))
+		}
+
+		for _, snippet := range result.Snippets {
+			fmt.Printf("   %s: %s\n", snippet.Role, ui.Highlight(snippet.Text, snippet.Matches))
 		}
 		fmt.Println()
 	}
@@ -676,82 +1171,46 @@ func (s *Session) searchHistory() {
 	ui.PrintSeparator()
 }
 
-// exportConversation exports current or saved conversation
+// exportConversation exports the current conversation, with all of its
+// branches, to a file in the working directory
 func (s *Session) exportConversation() {
-	if len(s.messages) == 0 {
+	if !s.hasUserMessages() {
 		ui.PrintInfo("No conversation to export")
 		return
 	}
 
 	fmt.Print("Export format (markdown/json/txt) [markdown]: ")
-	s.scanner.Scan()
-	format := strings.TrimSpace(strings.ToLower(s.scanner.Text()))
+	format, _ := s.readLine()
+	format = strings.TrimSpace(strings.ToLower(format))
 
 	if format == "" {
 		format = "markdown"
 	}
 
-	// Create temp conversation for export
-	conv := history.Conversation{
-		ID:        fmt.Sprintf("export_%d", time.Now().Unix()),
-		Provider:  s.provider.Name(),
-		Model:     s.currentModel,
-		Messages:  s.messages,
-		StartTime: s.conversationStart,
-		EndTime:   time.Now(),
-	}
-
-	// Try to use history manager's export method
-	filePath := s.exportManually(format)
-	_ = conv // Keep conv to avoid unused variable warning
-
-	if filePath != "" {
-		ui.PrintSuccess(fmt.Sprintf("Conversation exported to: %s", filePath))
-	} else {
-		ui.PrintError("Failed to export conversation")
+	conv := s.conversation(fmt.Sprintf("export_%d", time.Now().Unix()))
+	content, ext, err := s.historyManager.Render(&conv, format)
+	if err != nil {
+		ui.PrintError(fmt.Sprintf("Failed to export conversation: %v", err))
+		return
 	}
-}
 
-// exportManually is a fallback export method
-func (s *Session) exportManually(format string) string {
-	var content strings.Builder
-	var ext string
-
-	switch format {
-	case "markdown":
-		content.WriteString(fmt.Sprintf("# Conversation with %s\n\n", s.provider.Name()))
-		content.WriteString(fmt.Sprintf("**Model:** %s\n\n", s.currentModel))
-		for _, msg := range s.messages {
-			role := "User"
-			if msg.Role == models.RoleAssistant {
-				role = "Assistant"
-			}
-			content.WriteString(fmt.Sprintf("## %s\n\n%s\n\n", role, msg.Content))
-		}
-		ext = ".md"
-	case "json":
-		data, _ := json.MarshalIndent(s.messages, "", "  ")
-		content.Write(data)
-		ext = ".json"
-	default:
-		for _, msg := range s.messages {
-			role := "You"
-			if msg.Role == models.RoleAssistant {
-				role = "Assistant"
-			}
-			content.WriteString(fmt.Sprintf("[%s]:\n%s\n\n", role, msg.Content))
-		}
-		ext = ".txt"
+	filePath := fmt.Sprintf("conversation_%d%s", time.Now().Unix(), ext)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		ui.PrintError(fmt.Sprintf("Failed to export conversation: %v", err))
+		return
 	}
 
-	filename := fmt.Sprintf("conversation_%d%s", time.Now().Unix(), ext)
-	filePath := filename
+	ui.PrintSuccess(fmt.Sprintf("Conversation exported to: %s", filePath))
+}
 
-	if err := os.WriteFile(filePath, []byte(content.String()), 0644); err != nil {
-		return ""
+// showSpend displays spend over the last 30 days
+func (s *Session) showSpend() {
+	entries, err := s.costs.ledger.Entries(time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		ui.PrintError(err.Error())
+		return
 	}
-
-	return filePath
+	PrintSpend(cost.Summarize(entries), "Spend (last 30 days)", s.costs.budget, s.costs.ledger)
 }
 
 // showHistoryStats displays statistics about conversation history
@@ -764,6 +1223,8 @@ func (s *Session) showHistoryStats() {
 
 	fmt.Printf("Total Conversations: %v\n", stats["total_conversations"])
 	fmt.Printf("Total Messages: %v\n", stats["total_messages"])
+	fmt.Printf("Total Branches: %v\n", stats["total_branches"])
+	fmt.Printf("Total Tokens: %v\n", stats["total_tokens"])
 
 	if providers, ok := stats["providers"].(map[string]int); ok {
 		fmt.Println("\nBy Provider:")
@@ -2,16 +2,19 @@ package chat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
 	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
 	"github.com/soyomarvaldezg/llm-chat/internal/providers"
 	"github.com/soyomarvaldezg/llm-chat/internal/registry"
-	"github.com/soyomarvaldezg/llm-chat/internal/ui"
 	"github.com/soyomarvaldezg/llm-chat/pkg/models"
 )
 
@@ -19,6 +22,11 @@ import (
 type ShellMode struct {
 	provider providers.Provider
 	config   *config.Config
+	costs    *costTracker
+	out      *output
+
+	// metadata is sent with every request, for the router's rules
+	metadata map[string]string
 }
 
 // NewShellMode creates a new shell mode session
@@ -33,8 +41,13 @@ func NewShellMode(reg *registry.Registry, cfg *config.Config, providerName strin
 	}
 
 	// Initialize the provider with config
+	model := cfg.Model
+	if model == "" {
+		model = provider.DefaultModel()
+	}
+
 	providerCfg := providers.Config{
-		Model:       provider.DefaultModel(),
+		Model:       model,
 		Temperature: cfg.Temperature,
 		MaxTokens:   cfg.MaxTokens,
 	}
@@ -46,74 +59,173 @@ func NewShellMode(reg *registry.Registry, cfg *config.Config, providerName strin
 	return &ShellMode{
 		provider: provider,
 		config:   cfg,
+		costs:    newCostTracker(cfg),
+		out:      newOutput(os.Stdout, cfg.OutputFormat, cfg.Verbose),
+		metadata: map[string]string{providers.MetadataMode: "shell"},
 	}, nil
 }
 
-// Execute runs a single shell mode query
-func (sm *ShellMode) Execute(prompt string, stdinContent string) error {
-	// Build the complete message
-	var fullPrompt string
-	if stdinContent != "" {
-		// If we have stdin content, combine it with the prompt
-		fullPrompt = fmt.Sprintf("%s\n\n```\n%s\n```", prompt, stdinContent)
-	} else {
-		// Just use the prompt
-		fullPrompt = prompt
-	}
+// ErrInterrupted is returned when a reply is cancelled before it completes
+var ErrInterrupted = errors.New("interrupted")
 
+// SetTags tags the requests, for the router's rules
+func (sm *ShellMode) SetTags(tags []string) {
+	sm.metadata[providers.MetadataTags] = strings.Join(tags, ",")
+}
+
+// Execute runs a single shell mode query with the given inputs, such as
+// files and piped stdin, sent after the prompt. Cancelling ctx stops the
+// reply; the output received so far stays printed and ErrInterrupted is
+// returned.
+func (sm *ShellMode) Execute(ctx context.Context, prompt string, inputs []attach.File) error {
+	fullPrompt := strings.TrimSpace(prompt + "\n\n" + FrameInputs(inputs))
 	if fullPrompt == "" {
 		return fmt.Errorf("no input provided")
 	}
 
-	// Create message
-	message := models.Message{
+	messages := sm.messages(fullPrompt)
+	if err := sm.checkContext(messages); err != nil {
+		return err
+	}
+
+	return sm.run(ctx, messages)
+}
+
+// messages returns the conversation for a single prompt
+func (sm *ShellMode) messages(prompt string) []models.Message {
+	return promptMessages(sm.config.SystemPrompt, prompt)
+}
+
+// promptMessages returns a conversation of a prompt after the system
+// prompt, if there is one
+func promptMessages(systemPrompt, prompt string) []models.Message {
+	messages := make([]models.Message, 0, 2)
+	if systemPrompt != "" {
+		messages = append(messages, models.Message{
+			Role:      models.RoleSystem,
+			Content:   systemPrompt,
+			Timestamp: time.Now(),
+		})
+	}
+
+	return append(messages, models.Message{
 		Role:      models.RoleUser,
-		Content:   fullPrompt,
+		Content:   prompt,
 		Timestamp: time.Now(),
-	}
+	})
+}
 
+// run streams the reply to messages to stdout
+func (sm *ShellMode) run(ctx context.Context, messages []models.Message) error {
 	// Create chat request
 	req := models.ChatRequest{
-		Messages:    []models.Message{message},
-		Temperature: sm.config.Temperature,
+		Messages:    messages,
+		Temperature: models.Temperature(sm.config.Temperature),
 		MaxTokens:   sm.config.MaxTokens,
 		Stream:      true,
+		Metadata:    sm.metadata,
+	}
+
+	// Warnings go to stderr to keep piped output clean
+	warning, err := sm.costs.checkBudget()
+	if err != nil {
+		return err
 	}
+	if warning != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	out := sm.out
+	out.start(sm.provider.Name(), sm.provider.DefaultModel())
 
-	ctx := context.Background()
 	start := time.Now()
 
+	result := sm.newResult()
+
 	// Stream the response
 	streamChan, err := sm.provider.StreamMessage(ctx, req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return sm.interrupted(result)
+		}
 		return fmt.Errorf("failed to stream message: %w", err)
 	}
 
 	var fullResponse strings.Builder
-	tokenCount := 0
 
 	// Stream to stdout
-	for chunk := range streamChan {
-		if chunk.Error != nil {
-			return fmt.Errorf("stream error: %w", chunk.Error)
+stream:
+	for {
+		select {
+		case <-ctx.Done():
+			result.Interrupted = true
+			break stream
+		case chunk, ok := <-streamChan:
+			if !ok {
+				break stream
+			}
+			if chunk.Error != nil {
+				if ctx.Err() != nil {
+					result.Interrupted = true
+					break stream
+				}
+				return fmt.Errorf("stream error: %w", chunk.Error)
+			}
+			if chunk.Usage != nil {
+				result.Usage = chunk.Usage
+			}
+			if chunk.FinishReason != "" {
+				result.FinishReason = chunk.FinishReason
+			}
+			if chunk.ProviderName != "" {
+				// The backend the router picked
+				result.Provider, result.Model = chunk.ProviderName, chunk.ModelName
+			}
+			if chunk.Content != "" && result.FirstTokenMS == 0 {
+				result.FirstTokenMS = time.Since(start).Milliseconds()
+			}
+
+			out.chunk(chunk.Content)
+			fullResponse.WriteString(chunk.Content)
 		}
+	}
 
-		// Stream raw (markdown stays as-is for readability)
-		fmt.Print(chunk.Content)
-		fullResponse.WriteString(chunk.Content)
-		tokenCount += len(strings.Fields(chunk.Content))
+	result.Response = fullResponse.String()
+	result.DurationMS = time.Since(start).Milliseconds()
+
+	if result.Interrupted {
+		return sm.interrupted(result)
 	}
 
-	fmt.Println() // Final newline
+	sm.recordCost(&result)
+	out.finish(result)
+	return nil
+}
 
-	responseTime := time.Since(start)
+// interrupted reports a cancelled reply and returns ErrInterrupted. The
+// usage reported before it stopped is still recorded, as it is billed.
+func (sm *ShellMode) interrupted(result Result) error {
+	result.Interrupted = true
+	sm.recordCost(&result)
+	sm.out.finish(result)
+	return ErrInterrupted
+}
 
-	// Show metrics if verbose mode is enabled
-	if sm.config.Verbose {
-		ui.PrintMetrics(responseTime, tokenCount)
+// newResult returns an empty result for the current provider and model
+func (sm *ShellMode) newResult() Result {
+	return Result{
+		Provider: sm.provider.Name(),
+		Model:    sm.provider.DefaultModel(),
 	}
+}
 
-	return nil
+// recordCost adds the usage of a reply to the ledger and sets its cost
+func (sm *ShellMode) recordCost(result *Result) {
+	amount, err := sm.costs.record(result.Provider, result.Model, result.Usage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	result.Cost = amount
 }
 
 // ReadStdin reads all content from stdin
@@ -138,22 +250,76 @@ func ReadStdin() (string, error) {
 	return "", nil
 }
 
-// FormatOutput formats the response according to the output format
-func (sm *ShellMode) FormatOutput(content string) string {
-	switch sm.config.OutputFormat {
-	case "json":
-		// Escape quotes and wrap in JSON
-		escaped := strings.ReplaceAll(content, `"`, `\"`)
-		escaped = strings.ReplaceAll(escaped, "\n", "\\n")
-		return fmt.Sprintf(`{"response": "%s"}`, escaped)
+// StdinInput returns piped stdin content as an input named "stdin"
+func StdinInput(content string) attach.File {
+	return attach.File{
+		Path:     "stdin",
+		Language: "text",
+		Content:  content,
+		Size:     int64(len(content)),
+		Tokens:   contextwindow.EstimateTokens(content),
+	}
+}
+
+// FrameInputs returns inputs as fenced blocks labelled with their path
+// and language. Several inputs are preceded by a manifest listing them.
+func FrameInputs(inputs []attach.File) string {
+	if len(inputs) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	if len(inputs) > 1 {
+		fmt.Fprintf(&sb, "Inputs (%d):\n", len(inputs))
+		for i, input := range inputs {
+			fmt.Fprintf(&sb, "%d. %s (%s, %d bytes", i+1, filepath.ToSlash(input.Path), input.Language, input.Size)
+			if input.Truncated {
+				sb.WriteString(", truncated")
+			}
+			sb.WriteString(")\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString((&attach.Result{Files: inputs}).Format())
+	return sb.String()
+}
+
+// checkContext fails if the messages cannot fit in the model's context
+// window next to the reply, rather than letting the provider reject them.
+// The token count is an estimate on the high side, so for providers that
+// truncate long prompts themselves it only warns.
+func (sm *ShellMode) checkContext(messages []models.Message) error {
+	length, budget := sm.promptBudget()
 
-	case "markdown":
-		return fmt.Sprintf("# Response\n\n%s", content)
+	tokens := 0
+	for _, msg := range messages {
+		tokens += contextwindow.MessageTokens(msg)
+	}
 
-	case "raw":
-		return content
+	if tokens > budget && contextwindow.Truncates(sm.provider.Name()) {
+		fmt.Fprintf(os.Stderr, "Warning: input is about %d tokens, but %s/%s may only have room for about %d (context %d tokens); it may be truncated, so use --chunk or set --context-length if the model accepts more\n",
+			tokens, sm.provider.Name(), sm.provider.DefaultModel(), budget, length)
+		return nil
+	}
+	if tokens > budget {
+		// Classified as the provider would, since sending it would fail
+		return &providers.Error{
+			Provider: sm.provider.Name(),
+			Class:    providers.ClassContextLength,
+			Err: fmt.Errorf("input is about %d tokens, but %s/%s has room for about %d (context %d tokens, %d reserved for the reply); send fewer or smaller inputs, use --chunk, or set --context-length if the model accepts more",
+				tokens, sm.provider.Name(), sm.provider.DefaultModel(), budget, length, length-budget),
+		}
+	}
+	return nil
+}
 
-	default:
-		return content
+// promptBudget returns the model's context length and the tokens of it
+// available for the prompt
+func (sm *ShellMode) promptBudget() (int, int) {
+	length := sm.config.ContextLength
+	if length == 0 {
+		length = contextwindow.Length(sm.provider.Name(), sm.provider.DefaultModel(), sm.config.ContextLengths)
 	}
+	return length, contextwindow.PromptBudget(length, sm.config.MaxTokens)
 }
@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/attach"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// stalledProvider streams part of a reply with its usage so far, then
+// calls stall and waits to be cancelled
+type stalledProvider struct {
+	providers.Provider
+	stall func()
+}
+
+func (p *stalledProvider) Name() string         { return "stalled" }
+func (p *stalledProvider) DefaultModel() string { return "stalled-default" }
+
+func (p *stalledProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	ch := make(chan models.StreamChunk, 1)
+	go func() {
+		defer close(ch)
+		ch <- models.StreamChunk{Content: "Half a", Usage: &models.Usage{PromptTokens: 7, CompletionTokens: 2}}
+		p.stall()
+		<-ctx.Done()
+		ch <- models.StreamChunk{Error: ctx.Err(), Done: true}
+	}()
+	return ch, nil
+}
+
+func TestShellInterruptRecordsUsage(t *testing.T) {
+	cfg := config.Default()
+	cfg.UsagePath = filepath.Join(t.TempDir(), "usage.jsonl")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out bytes.Buffer
+	sm := &ShellMode{
+		provider: &stalledProvider{stall: cancel},
+		config:   cfg,
+		costs:    newCostTracker(cfg),
+		out:      newOutput(&out, "text", false),
+	}
+
+	err := sm.run(ctx, comparePrompt)
+	if !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("error = %v, want ErrInterrupted", err)
+	}
+
+	entries, err := sm.costs.ledger.Entries(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].PromptTokens != 7 || entries[0].CompletionTokens != 2 {
+		t.Errorf("ledger = %+v, want the usage reported before the interrupt", entries)
+	}
+}
+
+// newTestShell returns a shell mode over an echo provider with the given
+// name, writing its output to out
+func newTestShell(t *testing.T, name string, out *bytes.Buffer) *ShellMode {
+	t.Helper()
+	cfg := config.Default()
+	cfg.UsagePath = filepath.Join(t.TempDir(), "usage.jsonl")
+	return &ShellMode{
+		provider: &echoProvider{name: name},
+		config:   cfg,
+		costs:    newCostTracker(cfg),
+		out:      newOutput(out, "text", false),
+	}
+}
+
+func TestShellPipedInputContext(t *testing.T) {
+	// About 8000 estimated tokens, several times Ollama's default context
+	piped := StdinInput(strings.Repeat("lorem ipsum dolor sit amet\n", 1200))
+
+	// The default provider truncates long prompts itself, so the input is
+	// sent with a warning
+	var out bytes.Buffer
+	if err := newTestShell(t, "ollama", &out).Execute(context.Background(), "summarize", []attach.File{piped}); err != nil {
+		t.Fatalf("piped input to ollama: %v", err)
+	}
+	if !strings.Contains(out.String(), "from ollama") {
+		t.Errorf("output = %q, want the reply", out.String())
+	}
+
+	// Other providers reject prompts that do not fit, so it fails before
+	// sending
+	huge := StdinInput(strings.Repeat("lorem ipsum dolor sit amet\n", 3000))
+	out.Reset()
+	err := newTestShell(t, "groq", &out).Execute(context.Background(), "summarize", []attach.File{huge})
+	if providers.ClassOf(err) != providers.ClassContextLength || out.Len() != 0 {
+		t.Errorf("error = %v, output = %q, want a context_length error and nothing sent", err, out.String())
+	}
+}
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/persona"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// systemCommand shows the system prompt, or replaces it with args.
+// "/system clear" removes it.
+func (s *Session) systemCommand(args string) {
+	switch {
+	case args == "":
+		if s.config.SystemPrompt == "" {
+			ui.PrintInfo("No system prompt (set one with /system <text> or /persona <name>)")
+			return
+		}
+		label := "System prompt"
+		if s.config.Persona != "" {
+			label = fmt.Sprintf("System prompt (persona: %s)", s.config.Persona)
+		}
+		ui.PrintInfo(label + ":")
+		ui.PrintSystemMessage(s.config.SystemPrompt)
+
+	case strings.EqualFold(args, "clear"):
+		s.setSystemPrompt("", "")
+		ui.PrintSuccess("System prompt removed")
+
+	default:
+		s.setSystemPrompt(args, "")
+		ui.PrintSuccess("System prompt updated")
+	}
+}
+
+// personaCommand lists personas, switches to one, or saves the current
+// system prompt as a new persona with "/persona save <name>"
+func (s *Session) personaCommand(args string) {
+	library := persona.NewLibrary(s.config.PersonaDir)
+	fields := strings.Fields(args)
+
+	switch {
+	case len(fields) == 0:
+		personas, err := library.List()
+		if personas == nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		if err != nil {
+			ui.PrintWarning(err.Error())
+		}
+		PrintPersonas(library.Dir(), personas, s.config.Persona)
+
+	case fields[0] == "save":
+		if len(fields) != 2 {
+			ui.PrintError("Usage: /persona save <name>")
+			return
+		}
+		if s.config.SystemPrompt == "" {
+			ui.PrintError("No system prompt to save (set one with /system <text>)")
+			return
+		}
+		p, err := library.Save(fields[1], s.config.SystemPrompt)
+		if err != nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		s.config.Persona = p.Name
+		ui.PrintSuccess(fmt.Sprintf("Saved persona %s to %s", p.Name, p.Path))
+
+	default:
+		p, err := library.Load(fields[0])
+		if err != nil {
+			ui.PrintError(err.Error())
+			return
+		}
+		s.setSystemPrompt(p.Prompt, p.Name)
+		ui.PrintSuccess(fmt.Sprintf("Switched to persona: %s", p.Name))
+	}
+}
+
+// setSystemPrompt replaces the system message at the start of the
+// conversation, removing it when prompt is empty
+func (s *Session) setSystemPrompt(prompt, personaName string) {
+	s.config.SystemPrompt = prompt
+	s.config.Persona = personaName
+
+	hasSystem := len(s.messages) > 0 && s.messages[0].Role == models.RoleSystem
+
+	switch {
+	case prompt == "" && hasSystem:
+		s.messages = s.messages[1:]
+	case prompt != "" && hasSystem:
+		s.messages[0].Content = prompt
+		s.messages[0].Timestamp = time.Now()
+	case prompt != "":
+		system := models.Message{Role: models.RoleSystem, Content: prompt, Timestamp: time.Now()}
+		s.messages = append([]models.Message{system}, s.messages...)
+	}
+}
+
+// PrintPersonas displays the personas in a library, marking the active one
+func PrintPersonas(dir string, personas []persona.Persona, active string) {
+	if len(personas) == 0 {
+		ui.PrintInfo(fmt.Sprintf("No personas found. Add <name>.md files to %s", dir))
+		return
+	}
+
+	ui.PrintSeparator()
+	ui.PrintInfo(fmt.Sprintf("Personas (%s)", dir))
+	ui.PrintSeparator()
+
+	for _, p := range personas {
+		preview := strings.ReplaceAll(p.Prompt, "\n", " ")
+		if len(preview) > 70 {
+			preview = preview[:70] + "..."
+		}
+
+		if p.Name == active {
+			ui.SuccessColor.Printf("▶ %s (active)\n", p.Name)
+		} else {
+			fmt.Printf("  %s\n", p.Name)
+		}
+		ui.MutedColor.Printf("    %s\n", preview)
+	}
+
+	ui.PrintSeparator()
+}
@@ -4,33 +4,75 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// General settings
+	Profile         string // name of the profile loaded from the config file
 	DefaultProvider string
 	Verbose         bool
 	NoHistory       bool
 	ShellMode       bool
 
 	// Model parameters
+	Model       string // empty means the provider's default model
 	Temperature float64
 	MaxTokens   int
 	Timeout     time.Duration
 
+	// SystemPrompt is sent as the first message of every conversation
+	SystemPrompt string
+
+	// Persona names a system prompt from the persona library. When set it
+	// replaces SystemPrompt once resolved.
+	Persona    string
+	PersonaDir string // persona library, empty for ~/.llm-chat/personas
+
+	// Context window settings
+	ContextLength   int            // tokens, 0 to use the model's known context length
+	ContextLengths  map[string]int // context length by provider, from the endpoints' context_length
+	ContextStrategy string         // sliding, summarize or none
+
+	// Attachment settings for /file, @path mentions and ask --file
+	AttachMaxFileSize int64 // bytes read from each file
+	AttachMaxTokens   int   // estimated tokens of all files, 0 for half the prompt budget
+
+	// Retry settings for requests failing with a retryable error class
+	RetryMaxAttempts int           // attempts per request, including the first; 1 disables retries
+	RetryBaseDelay   time.Duration // wait before the first retry, doubled for each further one
+	RetryMaxDelay    time.Duration // longest wait between attempts
+
 	// Output settings
-	OutputFormat string // text, json, markdown, raw
+	OutputFormat string // text, json, jsonl, markdown, raw
 	UseColors    bool
 
 	// History settings
-	HistoryPath string
-	MaxHistory  int
+	HistoryPath    string        // history file, or a directory for per-project histories
+	HistoryBackend string        // storage format: jsonl or sqlite
+	MaxHistory     int           // maximum number of conversations kept, 0 for no limit
+	HistoryMaxAge  time.Duration // conversations older than this are pruned, 0 for no limit
+	HistoryMaxSize int64         // maximum history size in bytes, 0 for no limit
+	HistoryArchive bool          // archive pruned conversations instead of deleting them
 
 	// Assessment settings
 	EnableAssessment bool
 	AutoImprove      bool
+
+	// Endpoints are extra OpenAI-compatible providers from the config file
+	Endpoints map[string]Endpoint
+
+	// Router configures the router provider, nil if it is not used
+	Router *Router
+
+	// Cost settings
+	Prices        map[string]map[string]Price // overrides of the built-in prices
+	UsagePath     string                      // usage ledger, empty for ~/.llm-chat/usage.jsonl
+	BudgetDaily   float64                     // US dollars per day, 0 for no limit
+	BudgetMonthly float64                     // US dollars per month, 0 for no limit
+	BudgetAction  string                      // warn or refuse once a budget is reached
 }
 
 // Default returns the default configuration
@@ -46,9 +88,19 @@ func Default() *Config {
 		OutputFormat:     "text",
 		UseColors:        true,
 		HistoryPath:      defaultHistoryPath(),
+		HistoryBackend:   "jsonl",
 		MaxHistory:       100,
+		HistoryArchive:   true,
 		EnableAssessment: false,
 		AutoImprove:      false,
+		BudgetAction:     "warn",
+		ContextStrategy:  "sliding",
+
+		AttachMaxFileSize: 256 << 10,
+
+		RetryMaxAttempts: 3,
+		RetryBaseDelay:   time.Second,
+		RetryMaxDelay:    30 * time.Second,
 	}
 }
 
@@ -90,6 +142,50 @@ func GetEnvBool(key string, fallback bool) bool {
 	return fallback
 }
 
+// ParseDuration parses a duration that may also use a "d" suffix for days,
+// such as "30d"
+func ParseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// ParseSize parses a byte size such as "512KB", "50MB" or "1GB"
+func ParseSize(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	trimmed := strings.ToUpper(strings.TrimSpace(value))
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(trimmed, unit.suffix); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid size %q", value)
+			}
+			return int64(n * float64(unit.multiplier)), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(trimmed, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n, nil
+}
+
 // defaultHistoryPath returns the default path for history storage
 func defaultHistoryPath() string {
 	homeDir, err := os.UserHomeDir()
@@ -112,12 +208,49 @@ func (c *Config) Validate() error {
 	validFormats := map[string]bool{
 		"text":     true,
 		"json":     true,
+		"jsonl":    true,
 		"markdown": true,
 		"raw":      true,
 	}
 
+	if c.MaxHistory < 0 || c.HistoryMaxAge < 0 || c.HistoryMaxSize < 0 {
+		return fmt.Errorf("history limits cannot be negative")
+	}
+
+	if c.HistoryBackend != "jsonl" && c.HistoryBackend != "sqlite" {
+		return fmt.Errorf("history backend must be jsonl or sqlite")
+	}
+
+	if c.ContextLength < 0 {
+		return fmt.Errorf("context length cannot be negative")
+	}
+
+	if c.ContextStrategy != "sliding" && c.ContextStrategy != "summarize" && c.ContextStrategy != "none" {
+		return fmt.Errorf("context strategy must be sliding, summarize or none")
+	}
+
+	if c.AttachMaxFileSize < 0 || c.AttachMaxTokens < 0 {
+		return fmt.Errorf("attachment limits cannot be negative")
+	}
+
+	if c.RetryMaxAttempts < 1 {
+		return fmt.Errorf("retry max attempts must be at least 1")
+	}
+
+	if c.RetryBaseDelay < 0 || c.RetryMaxDelay < 0 {
+		return fmt.Errorf("retry delays cannot be negative")
+	}
+
+	if c.BudgetDaily < 0 || c.BudgetMonthly < 0 {
+		return fmt.Errorf("budgets cannot be negative")
+	}
+
+	if c.BudgetAction != "warn" && c.BudgetAction != "refuse" {
+		return fmt.Errorf("budget action must be warn or refuse")
+	}
+
 	if !validFormats[c.OutputFormat] {
-		return fmt.Errorf("output format must be text, json, markdown, or raw")
+		return fmt.Errorf("output format must be text, json, jsonl, markdown, or raw")
 	}
 
 	return nil
@@ -0,0 +1,260 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ptr returns a pointer to v, for the optional fields of a profile
+func ptr[T any](v T) *T {
+	return &v
+}
+
+const testConfig = `
+default_profile: work
+profiles:
+  work:
+    provider: anthropic
+    model: claude-haiku-4-5
+    temperature: 0.2
+    max_tokens: 1000
+    budget: {daily: 5, action: refuse}
+  local:
+    provider: ollama
+    model: llama3.2
+endpoints:
+  vllm: {base_url: http://localhost:8000/v1, model: qwen, context_length: 32768}
+router:
+  chain: [groq, openai]
+  rules:
+    - {mode: shell, chain: [ollama]}
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	tests := []struct {
+		name        string
+		profile     string
+		env         map[string]string
+		wantProfile string
+		provider    string
+		model       string
+		temperature float64
+		maxTokens   int
+	}{
+		{"default profile of the file", "", nil, "work", "anthropic", "claude-haiku-4-5", 0.2, 1000},
+		{"LLM_CHAT_PROFILE over default_profile", "", map[string]string{"LLM_CHAT_PROFILE": "local"}, "local", "ollama", "llama3.2", 0.7, 4000},
+		{"named profile over LLM_CHAT_PROFILE", "work", map[string]string{"LLM_CHAT_PROFILE": "local"}, "work", "anthropic", "claude-haiku-4-5", 0.2, 1000},
+		{"environment over profile", "", map[string]string{"LLM_CHAT_MODEL": "claude-sonnet-4-5", "LLM_CHAT_TEMPERATURE": "0", "LLM_CHAT_MAX_TOKENS": "2000"}, "work", "anthropic", "claude-sonnet-4-5", 0, 2000},
+		{"environment provider drops the profile's model", "", map[string]string{"LLM_CHAT_PROVIDER": "openai"}, "work", "openai", "", 0.2, 1000},
+		{"environment provider matching the profile", "", map[string]string{"LLM_CHAT_PROVIDER": "anthropic"}, "work", "anthropic", "claude-haiku-4-5", 0.2, 1000},
+		{"environment provider and model", "", map[string]string{"LLM_CHAT_PROVIDER": "openai", "LLM_CHAT_MODEL": "gpt-4o"}, "work", "openai", "gpt-4o", 0.2, 1000},
+		{"invalid environment values ignored", "", map[string]string{"LLM_CHAT_TEMPERATURE": "warm", "LLM_CHAT_MAX_TOKENS": "many"}, "work", "anthropic", "claude-haiku-4-5", 0.2, 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load(path, tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Profile != tt.wantProfile || cfg.DefaultProvider != tt.provider || cfg.Model != tt.model {
+				t.Errorf("profile %s, provider %s, model %q; want %s, %s, %q",
+					cfg.Profile, cfg.DefaultProvider, cfg.Model, tt.wantProfile, tt.provider, tt.model)
+			}
+			if cfg.Temperature != tt.temperature || cfg.MaxTokens != tt.maxTokens {
+				t.Errorf("temperature %v, max tokens %d; want %v, %d", cfg.Temperature, cfg.MaxTokens, tt.temperature, tt.maxTokens)
+			}
+		})
+	}
+}
+
+func TestLoadFileSettings(t *testing.T) {
+	t.Setenv("LLM_CHAT_ROUTER_CHAIN", "ollama,groq")
+	t.Setenv("LLM_CHAT_BUDGET_ACTION", "warn")
+
+	cfg, err := Load(writeConfig(t, testConfig), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Endpoints["vllm"].Model != "qwen" || cfg.ContextLengths["vllm"] != 32768 {
+		t.Errorf("endpoints %+v, context lengths %v", cfg.Endpoints, cfg.ContextLengths)
+	}
+
+	// The chain from the environment keeps the file's rules
+	if strings.Join(cfg.Router.Chain, ",") != "ollama,groq" || len(cfg.Router.Rules) != 1 {
+		t.Errorf("router = %+v", cfg.Router)
+	}
+	if cfg.BudgetDaily != 5 || cfg.BudgetAction != "warn" {
+		t.Errorf("budget $%v, %s; want the profile's limit and the environment's action", cfg.BudgetDaily, cfg.BudgetAction)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeConfig(t, testConfig)
+
+	tests := []struct {
+		name    string
+		profile string
+		env     map[string]string
+		want    string
+	}{
+		{"unknown profile", "home", nil, `profile "home" not found (available: local, work)`},
+		{"unknown profile from the environment", "", map[string]string{"LLM_CHAT_PROFILE": "home"}, `profile "home" not found`},
+		{"invalid duration", "", map[string]string{"LLM_CHAT_HISTORY_MAX_AGE": "soon"}, "LLM_CHAT_HISTORY_MAX_AGE"},
+		{"invalid size", "", map[string]string{"LLM_CHAT_ATTACH_MAX_FILE_SIZE": "big"}, "LLM_CHAT_ATTACH_MAX_FILE_SIZE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if _, err := Load(path, tt.profile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	cfg := Default()
+	cfg.SystemPrompt = "Be brief"
+	err := cfg.ApplyProfile(Profile{
+		Provider:     "groq",
+		Model:        "llama-3.3-70b-versatile",
+		Temperature:  ptr(0.0),
+		MaxTokens:    ptr(500),
+		Persona:      "reviewer",
+		OutputFormat: "markdown",
+		History:      HistorySettings{Path: "/tmp/history", Backend: "sqlite", Max: ptr(0), MaxAge: "30d", MaxSize: "50MB", Archive: ptr(false), Disabled: ptr(true)},
+		Context:      ContextSettings{Length: ptr(8192), Strategy: "summarize"},
+		Attach:       AttachSettings{MaxFileSize: "1MB", MaxTokens: ptr(2000)},
+		Retry:        RetrySettings{MaxAttempts: ptr(1), BaseDelay: "500ms", MaxDelay: "5s"},
+		Budget:       BudgetSettings{Daily: ptr(0.0), Monthly: ptr(20.0), Action: "refuse"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.DefaultProvider = "groq"
+	want.Model = "llama-3.3-70b-versatile"
+	want.Temperature = 0
+	want.MaxTokens = 500
+	want.Persona = "reviewer"
+	want.OutputFormat = "markdown"
+	want.HistoryPath = "/tmp/history"
+	want.HistoryBackend = "sqlite"
+	want.MaxHistory = 0
+	want.HistoryMaxAge = 30 * 24 * time.Hour
+	want.HistoryMaxSize = 50 << 20
+	want.HistoryArchive = false
+	want.NoHistory = true
+	want.ContextLength = 8192
+	want.ContextStrategy = "summarize"
+	want.AttachMaxFileSize = 1 << 20
+	want.AttachMaxTokens = 2000
+	want.RetryMaxAttempts = 1
+	want.RetryBaseDelay = 500 * time.Millisecond
+	want.RetryMaxDelay = 5 * time.Second
+	want.BudgetMonthly = 20
+	want.BudgetAction = "refuse"
+
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("applied profile = %+v\nwant %+v", cfg, want)
+	}
+
+	// An empty profile changes nothing
+	unchanged := Default()
+	if err := unchanged.ApplyProfile(Profile{}); err != nil || !reflect.DeepEqual(unchanged, Default()) {
+		t.Errorf("empty profile applied as %+v, %v", unchanged, err)
+	}
+}
+
+func TestApplyProfileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    string
+	}{
+		{"system prompt and persona", Profile{SystemPrompt: "Be brief", Persona: "reviewer"}, "either system_prompt or persona"},
+		{"history max age", Profile{History: HistorySettings{MaxAge: "a month"}}, "invalid duration"},
+		{"history max size", Profile{History: HistorySettings{MaxSize: "large"}}, "invalid size"},
+		{"attach max file size", Profile{Attach: AttachSettings{MaxFileSize: "1 TB"}}, "invalid size"},
+		{"retry base delay", Profile{Retry: RetrySettings{BaseDelay: "1 second"}}, "invalid duration"},
+		{"retry max delay", Profile{Retry: RetrySettings{MaxDelay: "x"}}, "invalid duration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Default().ApplyProfile(tt.profile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string // a part of the error, or "" for none
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"temperature 0", func(c *Config) { c.Temperature = 0 }, ""},
+		{"temperature 2", func(c *Config) { c.Temperature = 2 }, ""},
+		{"temperature above 2", func(c *Config) { c.Temperature = 2.1 }, "temperature"},
+		{"negative temperature", func(c *Config) { c.Temperature = -0.1 }, "temperature"},
+		{"zero max tokens", func(c *Config) { c.MaxTokens = 0 }, "max tokens"},
+		{"negative history limit", func(c *Config) { c.HistoryMaxAge = -time.Hour }, "history limits"},
+		{"unknown history backend", func(c *Config) { c.HistoryBackend = "csv" }, "history backend"},
+		{"negative context length", func(c *Config) { c.ContextLength = -1 }, "context length"},
+		{"unknown context strategy", func(c *Config) { c.ContextStrategy = "truncate" }, "context strategy"},
+		{"negative attachment limit", func(c *Config) { c.AttachMaxTokens = -1 }, "attachment limits"},
+		{"no attempts", func(c *Config) { c.RetryMaxAttempts = 0 }, "retry max attempts"},
+		{"negative retry delay", func(c *Config) { c.RetryMaxDelay = -time.Second }, "retry delays"},
+		{"negative budget", func(c *Config) { c.BudgetMonthly = -1 }, "budgets"},
+		{"unknown budget action", func(c *Config) { c.BudgetAction = "block" }, "budget action"},
+		{"unknown output format", func(c *Config) { c.OutputFormat = "yaml" }, "output format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDurationAndSize(t *testing.T) {
+	durations := map[string]time.Duration{"30d": 30 * 24 * time.Hour, "0.5d": 12 * time.Hour, "90m": 90 * time.Minute}
+	for value, want := range durations {
+		if got, err := ParseDuration(value); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+
+	sizes := map[string]int64{"512KB": 512 << 10, "50 mb": 50 << 20, "1GB": 1 << 30, "100B": 100, "4096": 4096}
+	for value, want := range sizes {
+		if got, err := ParseSize(value); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %v, %v; want %d", value, got, err, want)
+		}
+	}
+}
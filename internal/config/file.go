@@ -0,0 +1,465 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File represents the contents of the configuration file
+type File struct {
+	DefaultProfile string              `yaml:"default_profile"`
+	Profiles       map[string]Profile  `yaml:"profiles"`
+	Endpoints      map[string]Endpoint `yaml:"endpoints"`
+	Router         *Router             `yaml:"router"`
+
+	// Prices override the built-in price table, keyed by provider and then
+	// model ID; the model "*" covers every model of the provider
+	Prices map[string]map[string]Price `yaml:"prices"`
+}
+
+// Price is the cost of a model in US dollars per million tokens
+type Price struct {
+	Input  float64 `yaml:"input"`
+	Output float64 `yaml:"output"`
+}
+
+// Endpoint describes an extra OpenAI-compatible provider, such as a vLLM,
+// LM Studio or llama.cpp server, OpenRouter or an internal gateway. The
+// map key in the file is the provider name. Environment variables in
+// api_key and header values are expanded.
+type Endpoint struct {
+	DisplayName string            `yaml:"display_name"`
+	Description string            `yaml:"description"`
+	BaseURL     string            `yaml:"base_url"`
+	APIKey      string            `yaml:"api_key"`
+	APIKeyEnv   string            `yaml:"api_key_env"`
+	Model       string            `yaml:"model"`
+	Models      map[string]string `yaml:"models"` // alias -> model ID
+	Headers     map[string]string `yaml:"headers"`
+
+	// ContextLength is the context window of the endpoint's models in
+	// tokens, for models unknown to llm-chat
+	ContextLength int `yaml:"context_length"`
+}
+
+// Router configures the "router" provider: an ordered fallback chain of
+// backends, and rules that pick another chain for some requests. A backend
+// is a provider name, optionally followed by ":model".
+type Router struct {
+	Chain []string     `yaml:"chain"`
+	Rules []RouterRule `yaml:"rules"`
+}
+
+// RouterRule sends requests matching all of its set conditions to its own
+// chain. Rules are tried in order and the first match wins.
+type RouterRule struct {
+	Mode      string   `yaml:"mode"`       // shell or interactive
+	Tag       string   `yaml:"tag"`        // a tag of the conversation
+	MinTokens int      `yaml:"min_tokens"` // estimated prompt tokens
+	MaxTokens int      `yaml:"max_tokens"`
+	Chain     []string `yaml:"chain"`
+}
+
+// Validate checks that every chain names at least one backend and that
+// rule conditions make sense
+func (r *Router) Validate() error {
+	if len(r.Chain) == 0 {
+		return fmt.Errorf("router: chain must name at least one provider")
+	}
+	for i, rule := range r.Rules {
+		if len(rule.Chain) == 0 {
+			return fmt.Errorf("router: rule %d: chain must name at least one provider", i+1)
+		}
+		if rule.Mode != "" && rule.Mode != "shell" && rule.Mode != "interactive" {
+			return fmt.Errorf("router: rule %d: mode must be shell or interactive", i+1)
+		}
+		if rule.MinTokens < 0 || rule.MaxTokens < 0 || (rule.MaxTokens > 0 && rule.MaxTokens < rule.MinTokens) {
+			return fmt.Errorf("router: rule %d: invalid token range", i+1)
+		}
+	}
+	return nil
+}
+
+// Profile is a named set of settings applied on top of the defaults.
+// Unset fields leave the underlying value untouched.
+type Profile struct {
+	Provider     string          `yaml:"provider"`
+	Model        string          `yaml:"model"`
+	Temperature  *float64        `yaml:"temperature"`
+	MaxTokens    *int            `yaml:"max_tokens"`
+	SystemPrompt string          `yaml:"system_prompt"`
+	Persona      string          `yaml:"persona"`
+	OutputFormat string          `yaml:"output_format"`
+	History      HistorySettings `yaml:"history"`
+	Budget       BudgetSettings  `yaml:"budget"`
+	Context      ContextSettings `yaml:"context"`
+	Attach       AttachSettings  `yaml:"attach"`
+	Retry        RetrySettings   `yaml:"retry"`
+}
+
+// HistorySettings holds the history options a profile can override
+type HistorySettings struct {
+	Path     string `yaml:"path"`
+	Backend  string `yaml:"backend"` // jsonl or sqlite
+	Max      *int   `yaml:"max"`
+	MaxAge   string `yaml:"max_age"`  // e.g. "30d" or "720h"
+	MaxSize  string `yaml:"max_size"` // e.g. "50MB"
+	Archive  *bool  `yaml:"archive"`
+	Disabled *bool  `yaml:"disabled"`
+}
+
+// ContextSettings holds the context window options a profile can override
+type ContextSettings struct {
+	Length   *int   `yaml:"length"`   // tokens; 0 uses the model's known length
+	Strategy string `yaml:"strategy"` // sliding, summarize or none
+}
+
+// AttachSettings holds the limits on attached files a profile can override
+type AttachSettings struct {
+	MaxFileSize string `yaml:"max_file_size"` // e.g. "256KB"
+	MaxTokens   *int   `yaml:"max_tokens"`
+}
+
+// RetrySettings holds the retry limits a profile can override
+type RetrySettings struct {
+	MaxAttempts *int   `yaml:"max_attempts"`
+	BaseDelay   string `yaml:"base_delay"` // e.g. "500ms"
+	MaxDelay    string `yaml:"max_delay"`  // e.g. "30s"
+}
+
+// BudgetSettings holds the spending limits a profile can set, in US dollars
+type BudgetSettings struct {
+	Daily   *float64 `yaml:"daily"`
+	Monthly *float64 `yaml:"monthly"`
+	Action  string   `yaml:"action"` // warn or refuse
+}
+
+// DefaultFilePath returns the default location of the configuration file
+func DefaultFilePath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".llm-chat.yaml"
+	}
+	return filepath.Join(homeDir, ".llm-chat", "config.yaml")
+}
+
+// LoadFile reads a configuration file. A missing file is not an error and
+// yields an empty configuration.
+func LoadFile(path string) (*File, error) {
+	file := &File{Profiles: make(map[string]Profile)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return file, nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	if file.Profiles == nil {
+		file.Profiles = make(map[string]Profile)
+	}
+
+	for name, endpoint := range file.Endpoints {
+		if endpoint.BaseURL == "" {
+			return nil, fmt.Errorf("endpoint %q in %s: base_url is required", name, path)
+		}
+		if endpoint.Model == "" && len(endpoint.Models) == 0 {
+			return nil, fmt.Errorf("endpoint %q in %s: set model or models", name, path)
+		}
+		if endpoint.ContextLength < 0 {
+			return nil, fmt.Errorf("endpoint %q in %s: context_length must not be negative", name, path)
+		}
+	}
+
+	if file.Router != nil {
+		if err := file.Router.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return file, nil
+}
+
+// Profile returns the named profile
+func (f *File) Profile(name string) (Profile, error) {
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("profile %q not found (available: %s)", name, strings.Join(f.ProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// ProfileNames returns the names of all profiles, sorted
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load builds a configuration from the defaults, the selected profile of
+// the configuration file and the environment, in increasing precedence.
+// An empty path uses the default file location and an empty profile name
+// falls back to LLM_CHAT_PROFILE and then the file's default_profile.
+func Load(path, profileName string) (*Config, error) {
+	if path == "" {
+		path = GetEnv("LLM_CHAT_CONFIG", DefaultFilePath())
+	}
+
+	file, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	cfg.Endpoints = file.Endpoints
+	for name, endpoint := range file.Endpoints {
+		if endpoint.ContextLength > 0 {
+			if cfg.ContextLengths == nil {
+				cfg.ContextLengths = make(map[string]int)
+			}
+			cfg.ContextLengths[name] = endpoint.ContextLength
+		}
+	}
+	cfg.Router = file.Router
+	cfg.Prices = file.Prices
+
+	if profileName == "" {
+		profileName = GetEnv("LLM_CHAT_PROFILE", file.DefaultProfile)
+	}
+
+	if profileName != "" {
+		profile, err := file.Profile(profileName)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.ApplyProfile(profile); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", profileName, err)
+		}
+		cfg.Profile = profileName
+	}
+
+	if err := cfg.ApplyEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// ApplyProfile overrides the configuration with the fields set in a profile
+func (c *Config) ApplyProfile(p Profile) error {
+	if p.Provider != "" {
+		c.DefaultProvider = p.Provider
+	}
+	if p.Model != "" {
+		c.Model = p.Model
+	}
+	if p.Temperature != nil {
+		c.Temperature = *p.Temperature
+	}
+	if p.MaxTokens != nil {
+		c.MaxTokens = *p.MaxTokens
+	}
+	if p.SystemPrompt != "" && p.Persona != "" {
+		return fmt.Errorf("set either system_prompt or persona, not both")
+	}
+	if p.SystemPrompt != "" {
+		c.SystemPrompt = p.SystemPrompt
+		c.Persona = ""
+	}
+	if p.Persona != "" {
+		c.Persona = p.Persona
+		c.SystemPrompt = ""
+	}
+	if p.OutputFormat != "" {
+		c.OutputFormat = p.OutputFormat
+	}
+	if p.History.Path != "" {
+		c.HistoryPath = ExpandHome(p.History.Path)
+	}
+	if p.History.Backend != "" {
+		c.HistoryBackend = p.History.Backend
+	}
+	if p.History.Max != nil {
+		c.MaxHistory = *p.History.Max
+	}
+	if p.History.MaxAge != "" {
+		maxAge, err := ParseDuration(p.History.MaxAge)
+		if err != nil {
+			return err
+		}
+		c.HistoryMaxAge = maxAge
+	}
+	if p.History.MaxSize != "" {
+		maxSize, err := ParseSize(p.History.MaxSize)
+		if err != nil {
+			return err
+		}
+		c.HistoryMaxSize = maxSize
+	}
+	if p.History.Archive != nil {
+		c.HistoryArchive = *p.History.Archive
+	}
+	if p.History.Disabled != nil {
+		c.NoHistory = *p.History.Disabled
+	}
+	if p.Context.Length != nil {
+		c.ContextLength = *p.Context.Length
+	}
+	if p.Context.Strategy != "" {
+		c.ContextStrategy = p.Context.Strategy
+	}
+	if p.Attach.MaxFileSize != "" {
+		size, err := ParseSize(p.Attach.MaxFileSize)
+		if err != nil {
+			return err
+		}
+		c.AttachMaxFileSize = size
+	}
+	if p.Attach.MaxTokens != nil {
+		c.AttachMaxTokens = *p.Attach.MaxTokens
+	}
+	if p.Retry.MaxAttempts != nil {
+		c.RetryMaxAttempts = *p.Retry.MaxAttempts
+	}
+	if p.Retry.BaseDelay != "" {
+		delay, err := ParseDuration(p.Retry.BaseDelay)
+		if err != nil {
+			return err
+		}
+		c.RetryBaseDelay = delay
+	}
+	if p.Retry.MaxDelay != "" {
+		delay, err := ParseDuration(p.Retry.MaxDelay)
+		if err != nil {
+			return err
+		}
+		c.RetryMaxDelay = delay
+	}
+	if p.Budget.Daily != nil {
+		c.BudgetDaily = *p.Budget.Daily
+	}
+	if p.Budget.Monthly != nil {
+		c.BudgetMonthly = *p.Budget.Monthly
+	}
+	if p.Budget.Action != "" {
+		c.BudgetAction = p.Budget.Action
+	}
+
+	return nil
+}
+
+// ApplyEnv overrides the configuration with any LLM_CHAT_* environment variables
+func (c *Config) ApplyEnv() error {
+	// A model from a lower layer belongs to that layer's provider, so
+	// switching provider without naming a model uses the new one's default
+	if provider := GetEnv("LLM_CHAT_PROVIDER", ""); provider != "" && provider != c.DefaultProvider {
+		c.DefaultProvider = provider
+		c.Model = ""
+	}
+	c.Model = GetEnv("LLM_CHAT_MODEL", c.Model)
+	c.Temperature = GetEnvFloat("LLM_CHAT_TEMPERATURE", c.Temperature)
+	c.MaxTokens = GetEnvInt("LLM_CHAT_MAX_TOKENS", c.MaxTokens)
+	if value := GetEnv("LLM_CHAT_SYSTEM_PROMPT", ""); value != "" {
+		c.SystemPrompt = value
+		c.Persona = ""
+	}
+	if value := GetEnv("LLM_CHAT_PERSONA", ""); value != "" {
+		c.Persona = value
+		c.SystemPrompt = ""
+	}
+	c.PersonaDir = ExpandHome(GetEnv("LLM_CHAT_PERSONA_DIR", c.PersonaDir))
+	c.OutputFormat = GetEnv("LLM_CHAT_FORMAT", c.OutputFormat)
+	c.HistoryPath = ExpandHome(GetEnv("LLM_CHAT_HISTORY_PATH", c.HistoryPath))
+	c.HistoryBackend = GetEnv("LLM_CHAT_HISTORY_BACKEND", c.HistoryBackend)
+	c.MaxHistory = GetEnvInt("LLM_CHAT_MAX_HISTORY", c.MaxHistory)
+	c.NoHistory = GetEnvBool("LLM_CHAT_NO_HISTORY", c.NoHistory)
+	c.HistoryArchive = GetEnvBool("LLM_CHAT_HISTORY_ARCHIVE", c.HistoryArchive)
+	c.ContextLength = GetEnvInt("LLM_CHAT_CONTEXT_LENGTH", c.ContextLength)
+	c.ContextStrategy = GetEnv("LLM_CHAT_CONTEXT_STRATEGY", c.ContextStrategy)
+	c.AttachMaxTokens = GetEnvInt("LLM_CHAT_ATTACH_MAX_TOKENS", c.AttachMaxTokens)
+	c.RetryMaxAttempts = GetEnvInt("LLM_CHAT_RETRY_MAX_ATTEMPTS", c.RetryMaxAttempts)
+	c.UsagePath = ExpandHome(GetEnv("LLM_CHAT_USAGE_PATH", c.UsagePath))
+
+	// A chain from the environment replaces the configured one but keeps
+	// its rules
+	if value := GetEnv("LLM_CHAT_ROUTER_CHAIN", ""); value != "" {
+		router := &Router{}
+		if c.Router != nil {
+			*router = *c.Router
+		}
+		router.Chain = strings.Split(value, ",")
+		c.Router = router
+	}
+	c.BudgetDaily = GetEnvFloat("LLM_CHAT_BUDGET_DAILY", c.BudgetDaily)
+	c.BudgetMonthly = GetEnvFloat("LLM_CHAT_BUDGET_MONTHLY", c.BudgetMonthly)
+	c.BudgetAction = GetEnv("LLM_CHAT_BUDGET_ACTION", c.BudgetAction)
+
+	if value := GetEnv("LLM_CHAT_HISTORY_MAX_AGE", ""); value != "" {
+		maxAge, err := ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("LLM_CHAT_HISTORY_MAX_AGE: %w", err)
+		}
+		c.HistoryMaxAge = maxAge
+	}
+
+	if value := GetEnv("LLM_CHAT_HISTORY_MAX_SIZE", ""); value != "" {
+		maxSize, err := ParseSize(value)
+		if err != nil {
+			return fmt.Errorf("LLM_CHAT_HISTORY_MAX_SIZE: %w", err)
+		}
+		c.HistoryMaxSize = maxSize
+	}
+
+	if value := GetEnv("LLM_CHAT_ATTACH_MAX_FILE_SIZE", ""); value != "" {
+		size, err := ParseSize(value)
+		if err != nil {
+			return fmt.Errorf("LLM_CHAT_ATTACH_MAX_FILE_SIZE: %w", err)
+		}
+		c.AttachMaxFileSize = size
+	}
+
+	if value := GetEnv("LLM_CHAT_RETRY_BASE_DELAY", ""); value != "" {
+		delay, err := ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("LLM_CHAT_RETRY_BASE_DELAY: %w", err)
+		}
+		c.RetryBaseDelay = delay
+	}
+
+	if value := GetEnv("LLM_CHAT_RETRY_MAX_DELAY", ""); value != "" {
+		delay, err := ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("LLM_CHAT_RETRY_MAX_DELAY: %w", err)
+		}
+		c.RetryMaxDelay = delay
+	}
+
+	return nil
+}
+
+// ExpandHome replaces a leading ~ in a path with the user's home directory
+func ExpandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a configuration file to a temporary directory and
+// returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFileValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // a part of the error, or "" for none
+	}{
+		{"empty", "", ""},
+		{"endpoint", "endpoints:\n  vllm: {base_url: http://localhost:8000/v1, model: qwen, context_length: 32768}\n", ""},
+		{"endpoint with aliases", "endpoints:\n  vllm: {base_url: http://localhost:8000/v1, models: {fast: qwen-7b}}\n", ""},
+		{"endpoint without base_url", "endpoints:\n  vllm: {model: qwen}\n", `endpoint "vllm"`},
+		{"endpoint without a model", "endpoints:\n  vllm: {base_url: http://localhost:8000/v1}\n", "set model or models"},
+		{"negative context length", "endpoints:\n  vllm: {base_url: http://localhost:8000/v1, model: qwen, context_length: -1}\n", "context_length must not be negative"},
+		{"router", "router:\n  chain: [groq, openai:gpt-4o-mini]\n  rules:\n    - {mode: shell, min_tokens: 10, max_tokens: 100, chain: [ollama]}\n", ""},
+		{"router without a chain", "router:\n  rules:\n    - {mode: shell, chain: [ollama]}\n", "router: chain must name at least one provider"},
+		{"rule without a chain", "router:\n  chain: [groq]\n  rules:\n    - {mode: shell}\n", "rule 1: chain must name"},
+		{"rule with an unknown mode", "router:\n  chain: [groq]\n  rules:\n    - {tag: x, chain: [ollama]}\n    - {mode: batch, chain: [ollama]}\n", "rule 2: mode must be shell or interactive"},
+		{"negative token bound", "router:\n  chain: [groq]\n  rules:\n    - {min_tokens: -1, chain: [ollama]}\n", "invalid token range"},
+		{"inverted token range", "router:\n  chain: [groq]\n  rules:\n    - {min_tokens: 100, max_tokens: 10, chain: [ollama]}\n", "invalid token range"},
+		{"invalid yaml", "profiles: [", "failed to parse config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := LoadFile(writeConfig(t, tt.content))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("LoadFile: %v", err)
+				}
+				if file.Profiles == nil {
+					t.Error("profiles are nil")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	file, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil || len(file.Profiles) != 0 || file.Router != nil {
+		t.Errorf("LoadFile = %+v, %v; want an empty file", file, err)
+	}
+}
@@ -0,0 +1,88 @@
+package contextwindow
+
+// DefaultLength is the context length assumed for models not listed below
+const DefaultLength = 8192
+
+// anyModel is the key of a provider-wide context length
+const anyModel = "*"
+
+// lengths are context lengths in tokens, keyed by provider and the model ID
+// sent to the API
+var lengths = map[string]map[string]int{
+	"ollama": {
+		// Ollama truncates prompts to its num_ctx option, 2048 unless the
+		// model or server sets another value
+		anyModel: 2048,
+	},
+	"groq": {
+		"llama-3.3-70b-versatile": 131072,
+		"llama-3.1-8b-instant":    131072,
+		"mixtral-8x7b-32768":      32768,
+		"gemma2-9b-it":            8192,
+	},
+	"together": {
+		"meta-llama/Llama-3.3-70B-Instruct-Turbo":      131072,
+		"meta-llama/Llama-3.3-70B-Instruct-Turbo-Free": 131072,
+		"deepseek-ai/DeepSeek-R1-Distill-Llama-70B":    131072,
+		"Qwen/Qwen2.5-72B-Instruct-Turbo":              32768,
+	},
+	"samba": {
+		"Meta-Llama-3.3-70B-Instruct": 131072,
+		"Meta-Llama-3.1-8B-Instruct":  16384,
+		"Qwen2.5-72B-Instruct":        16384,
+	},
+	"gemini": {
+		anyModel: 1048576,
+	},
+	"openai": {
+		"gpt-4o":       128000,
+		"gpt-4o-mini":  128000,
+		"gpt-4.1":      1047576,
+		"gpt-4.1-mini": 1047576,
+		"o4-mini":      200000,
+	},
+	"anthropic": {
+		anyModel: 200000,
+	},
+}
+
+// truncating lists the providers that cut prompts down to their context
+// window themselves rather than rejecting them
+var truncating = map[string]bool{
+	"ollama": true,
+}
+
+// Truncates reports whether a provider truncates prompts that do not fit
+// in the context window instead of failing the request
+func Truncates(provider string) bool {
+	return truncating[provider]
+}
+
+// Length returns the context length of a model in tokens: the provider's
+// length in overrides, such as one configured for an endpoint, then the
+// built-in length of the model, or DefaultLength if it is not known
+func Length(provider, model string, overrides map[string]int) int {
+	if length, ok := overrides[provider]; ok {
+		return length
+	}
+
+	models, ok := lengths[provider]
+	if !ok {
+		return DefaultLength
+	}
+	if length, ok := models[model]; ok {
+		return length
+	}
+	if length, ok := models[anyModel]; ok {
+		return length
+	}
+	return DefaultLength
+}
+
+// PromptBudget returns the tokens available for the prompt in a context of
+// the given length, leaving room for a reply of up to maxTokens. At most a
+// quarter of the context is reserved for the reply.
+func PromptBudget(length, maxTokens int) int {
+	reserve := min(maxTokens, length/4)
+	return length - max(reserve, 0)
+}
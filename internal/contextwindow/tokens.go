@@ -0,0 +1,46 @@
+// Package contextwindow decides which messages of a conversation are sent
+// to a model so that they fit in its context window.
+package contextwindow
+
+import (
+	"unicode/utf8"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// messageOverhead approximates the tokens every message costs for its role
+// and separators, on top of its content
+const messageOverhead = 4
+
+// EstimateTokens approximates the number of tokens in text. Provider
+// tokenizers differ, so it errs on the high side: about four characters
+// per token for prose, with a floor of one token per word for text made of
+// many short words or symbols, such as code.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+
+	byChars := (utf8.RuneCountInString(text) + 3) / 4
+
+	words := 0
+	inWord := false
+	for _, r := range text {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			inWord = false
+		default:
+			if !inWord {
+				words++
+			}
+			inWord = true
+		}
+	}
+
+	return max(byChars, words)
+}
+
+// MessageTokens approximates the tokens a message uses in a request
+func MessageTokens(msg models.Message) int {
+	return EstimateTokens(msg.Content) + messageOverhead
+}
@@ -0,0 +1,229 @@
+package contextwindow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// Strategy selects what happens to older messages that no longer fit
+type Strategy string
+
+const (
+	// StrategySliding drops the oldest messages
+	StrategySliding Strategy = "sliding"
+	// StrategySummarize replaces the oldest messages with a summary
+	StrategySummarize Strategy = "summarize"
+	// StrategyNone sends the whole conversation
+	StrategyNone Strategy = "none"
+)
+
+// ParseStrategy validates a strategy name
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case StrategySliding, StrategySummarize, StrategyNone:
+		return Strategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown context strategy %q (use sliding, summarize or none)", name)
+	}
+}
+
+// SummaryPrefix starts the system message that carries a summary
+const SummaryPrefix = "Summary of the earlier conversation:\n\n"
+
+// Summarizer condenses messages into a summary. Previous is the summary of
+// the messages before them, or "" if there is none, and should be folded
+// into the result.
+type Summarizer func(ctx context.Context, previous string, messages []models.Message) (string, error)
+
+// Window is the part of a conversation selected for a request
+type Window struct {
+	// Messages are the messages to send, including the summary, if any
+	Messages []models.Message
+
+	// Included holds, for each of Messages, its index in the conversation,
+	// or -1 for the summary
+	Included []int
+
+	Dropped    int // messages left out entirely
+	Summarized int // messages covered by the summary
+	Tokens     int // estimated tokens of Messages
+	Limit      int // tokens available for the prompt
+}
+
+// Manager fits conversations into a token limit. System and pinned
+// messages are always kept, as is the last message; the most recent of
+// the other messages are kept while they fit.
+type Manager struct {
+	strategy  Strategy
+	limit     int
+	summarize Summarizer
+
+	// summary covers the unpinned turns of the first summarized messages
+	summary    string
+	summarized int
+}
+
+// NewManager creates a manager that keeps prompts within limit tokens.
+// Summarize is only used by StrategySummarize.
+func NewManager(strategy Strategy, limit int, summarize Summarizer) *Manager {
+	return &Manager{strategy: strategy, limit: limit, summarize: summarize}
+}
+
+// Strategy returns the strategy in use
+func (m *Manager) Strategy() Strategy {
+	return m.strategy
+}
+
+// SetLimit changes the token limit, for instance after switching models
+func (m *Manager) SetLimit(limit int) {
+	m.limit = limit
+}
+
+// Reset forgets the summary. Call it whenever earlier messages of the
+// conversation change.
+func (m *Manager) Reset() {
+	m.summary = ""
+	m.summarized = 0
+}
+
+// Build selects the messages to send. With StrategySummarize, messages
+// that no longer fit are summarized with the summarizer first; if that
+// fails they are dropped and the error is returned with the window.
+func (m *Manager) Build(ctx context.Context, messages []models.Message) (Window, error) {
+	if m.summarized > len(messages) {
+		m.Reset()
+	}
+
+	w := m.fit(messages)
+	if m.strategy != StrategySummarize || m.summarize == nil || w.Dropped == 0 {
+		return w, nil
+	}
+
+	// Everything before the oldest kept turn is folded into the summary
+	end := m.summarized
+	for i := m.summarized; i < len(messages); i++ {
+		if !w.includes(i) && messages[i].Role != models.RoleSystem {
+			end = i + 1
+		}
+	}
+
+	summary, err := m.summarize(ctx, m.summary, summarizable(messages[m.summarized:end]))
+	if err != nil {
+		return w, fmt.Errorf("failed to summarize earlier messages: %w", err)
+	}
+
+	m.summary = summary
+	m.summarized = end
+
+	return m.fit(messages), nil
+}
+
+// Preview returns the window Build would select without summarizing:
+// messages that Build would summarize are counted as dropped
+func (m *Manager) Preview(messages []models.Message) Window {
+	if m.summarized > len(messages) {
+		m.Reset()
+	}
+	return m.fit(messages)
+}
+
+// fit selects the messages that fit in the limit
+func (m *Manager) fit(messages []models.Message) Window {
+	w := Window{Limit: m.limit}
+
+	summaryMsg := models.Message{Role: models.RoleSystem, Content: SummaryPrefix + m.summary}
+	hasSummary := m.summary != "" && m.strategy == StrategySummarize
+
+	keep := make([]bool, len(messages))
+	tokens := 0
+	if hasSummary {
+		tokens += MessageTokens(summaryMsg)
+	}
+
+	// Required messages are kept even if they exceed the limit
+	for i, msg := range messages {
+		if m.strategy == StrategyNone || msg.Role == models.RoleSystem || msg.Pinned || i == len(messages)-1 {
+			keep[i] = true
+			tokens += MessageTokens(msg)
+		}
+	}
+
+	// Then the most recent messages that fit, stopping at the first that
+	// does not so the kept turns stay contiguous
+	for i := len(messages) - 1; i >= 0; i-- {
+		if keep[i] || (hasSummary && i < m.summarized) {
+			continue
+		}
+		cost := MessageTokens(messages[i])
+		if tokens+cost > m.limit {
+			break
+		}
+		keep[i] = true
+		tokens += cost
+	}
+
+	// Never open the conversation with a reply to a dropped question
+	for i, msg := range messages {
+		if msg.Role == models.RoleSystem {
+			continue
+		}
+		if keep[i] && msg.Role == models.RoleAssistant && !msg.Pinned && i != len(messages)-1 && m.strategy != StrategyNone {
+			keep[i] = false
+			tokens -= MessageTokens(msg)
+			continue
+		}
+		if keep[i] {
+			break
+		}
+	}
+
+	summaryAdded := !hasSummary
+	for i, msg := range messages {
+		if !summaryAdded && msg.Role != models.RoleSystem {
+			w.Messages = append(w.Messages, summaryMsg)
+			w.Included = append(w.Included, -1)
+			summaryAdded = true
+		}
+		if keep[i] {
+			w.Messages = append(w.Messages, msg)
+			w.Included = append(w.Included, i)
+			continue
+		}
+		if hasSummary && i < m.summarized {
+			w.Summarized++
+		} else {
+			w.Dropped++
+		}
+	}
+	if !summaryAdded {
+		w.Messages = append(w.Messages, summaryMsg)
+		w.Included = append(w.Included, -1)
+	}
+
+	w.Tokens = tokens
+	return w
+}
+
+// includes reports whether the conversation message at index i is sent
+func (w Window) includes(i int) bool {
+	for _, index := range w.Included {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizable returns the messages a summary should cover: system
+// messages and pinned messages are sent as they are
+func summarizable(messages []models.Message) []models.Message {
+	result := make([]models.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Role != models.RoleSystem && !msg.Pinned {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
@@ -0,0 +1,170 @@
+package contextwindow
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// msg returns a message of five estimated tokens: one for its content and
+// the per-message overhead
+func msg(role models.Role, content string) models.Message {
+	return models.Message{Role: role, Content: content}
+}
+
+// conversation is a system prompt and two and a half exchanges, 30 tokens
+var conversation = []models.Message{
+	msg(models.RoleSystem, "sys"),
+	msg(models.RoleUser, "u1"),
+	msg(models.RoleAssistant, "a1"),
+	msg(models.RoleUser, "u2"),
+	msg(models.RoleAssistant, "a2"),
+	msg(models.RoleUser, "u3"),
+}
+
+// long returns a message of 24 estimated tokens whose content starts with
+// label
+func long(role models.Role, label string) models.Message {
+	return msg(role, label+" "+strings.Repeat("x", 80-len(label)-1))
+}
+
+// contents returns the first word of each message of a window
+func contents(w Window) string {
+	var out []string
+	for _, m := range w.Messages {
+		out = append(out, strings.Fields(m.Content)[0])
+	}
+	return strings.Join(out, ",")
+}
+
+func TestFit(t *testing.T) {
+	pinned := append([]models.Message{}, conversation...)
+	pinned[1].Pinned = true
+
+	huge := msg(models.RoleUser, strings.Repeat("word ", 100))
+
+	tests := []struct {
+		name     string
+		strategy Strategy
+		limit    int
+		messages []models.Message
+		want     string
+		dropped  int
+		tokens   int
+	}{
+		{"empty", StrategySliding, 100, nil, "", 0, 0},
+		{"all fit exactly", StrategySliding, 30, conversation, "sys,u1,a1,u2,a2,u3", 0, 30},
+		{"one token short", StrategySliding, 29, conversation, "sys,u2,a2,u3", 2, 20},
+		{"only required fit", StrategySliding, 10, conversation, "sys,u3", 4, 10},
+		{"below required", StrategySliding, 1, conversation, "sys,u3", 4, 10},
+		{"pinned kept", StrategySliding, 15, pinned, "sys,u1,u3", 3, 15},
+		{"only a system prompt", StrategySliding, 1, conversation[:1], "sys", 0, 5},
+		{"single message over the limit", StrategySliding, 10, []models.Message{huge}, "word", 0, MessageTokens(huge)},
+		{"system and message over the limit", StrategySliding, 10, []models.Message{conversation[0], huge}, "sys,word", 0, 5 + MessageTokens(huge)},
+		{"none sends everything", StrategyNone, 10, conversation, "sys,u1,a1,u2,a2,u3", 0, 30},
+		{"summarize without a summary slides", StrategySummarize, 29, conversation, "sys,u2,a2,u3", 2, 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewManager(tt.strategy, tt.limit, nil).Preview(tt.messages)
+			if got := contents(w); got != tt.want {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+			if w.Dropped != tt.dropped || w.Tokens != tt.tokens || w.Limit != tt.limit {
+				t.Errorf("dropped %d, tokens %d, limit %d; want %d, %d, %d", w.Dropped, w.Tokens, w.Limit, tt.dropped, tt.tokens, tt.limit)
+			}
+			if len(w.Included) != len(w.Messages) {
+				t.Errorf("%d indexes for %d messages", len(w.Included), len(w.Messages))
+			}
+		})
+	}
+}
+
+func TestBuildSummarize(t *testing.T) {
+	var calls []string
+	summarize := func(ctx context.Context, previous string, messages []models.Message) (string, error) {
+		var covered []string
+		for _, m := range messages {
+			covered = append(covered, strings.Fields(m.Content)[0])
+		}
+		calls = append(calls, fmt.Sprintf("%q+%s", previous, strings.Join(covered, "+")))
+		return "S" + fmt.Sprint(len(calls)), nil
+	}
+
+	// Long turns, so that a summary costs less than the turns it covers
+	turns := []models.Message{
+		msg(models.RoleSystem, "sys"),
+		long(models.RoleUser, "u1"),
+		long(models.RoleAssistant, "a1"),
+		long(models.RoleUser, "u2"),
+		long(models.RoleAssistant, "a2"),
+		msg(models.RoleUser, "u3"),
+	}
+	m := NewManager(StrategySummarize, 90, summarize)
+
+	// The dropped turn is summarized, and the summary follows the system
+	// prompt
+	w, err := m.Build(context.Background(), turns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(w); got != "sys,Summary,u2,a2,u3" || w.Messages[1].Content != SummaryPrefix+"S1" {
+		t.Errorf("sent %q", got)
+	}
+	if w.Summarized != 2 || w.Dropped != 0 || !reflect.DeepEqual(w.Included, []int{0, -1, 3, 4, 5}) {
+		t.Errorf("summarized %d, dropped %d, included %v", w.Summarized, w.Dropped, w.Included)
+	}
+
+	// A longer conversation folds the earlier summary into the next
+	longer := append(append([]models.Message{}, turns...), long(models.RoleAssistant, "a3"), msg(models.RoleUser, "u4"))
+	w, err = m.Build(context.Background(), longer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(w); got != "sys,Summary,u3,a3,u4" || w.Messages[1].Content != SummaryPrefix+"S2" {
+		t.Errorf("sent %q", got)
+	}
+	if want := []string{`""+u1+a1`, `"S1"+u2+a2`}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("summarizer calls = %v, want %v", calls, want)
+	}
+
+	// Editing earlier messages drops the summary
+	m.Reset()
+	if w := m.Preview(turns); w.Summarized != 0 || w.Dropped != 2 {
+		t.Errorf("after reset summarized %d, dropped %d", w.Summarized, w.Dropped)
+	}
+
+	// A failed summary leaves the turns dropped
+	failing := NewManager(StrategySummarize, 90, func(context.Context, string, []models.Message) (string, error) {
+		return "", fmt.Errorf("offline")
+	})
+	w, err = failing.Build(context.Background(), turns)
+	if err == nil || w.Dropped != 2 || contents(w) != "sys,u2,a2,u3" {
+		t.Errorf("failed summary: error %v, sent %q", err, contents(w))
+	}
+}
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		overrides       map[string]int
+		want            int
+	}{
+		{"groq", "llama-3.3-70b-versatile", nil, 131072},
+		{"anthropic", "claude-anything", nil, 200000},
+		{"groq", "unknown", nil, DefaultLength},
+		{"vllm", "m", nil, DefaultLength},
+		{"vllm", "m", map[string]int{"vllm": 32768}, 32768},
+		{"groq", "llama-3.3-70b-versatile", map[string]int{"vllm": 32768}, 131072},
+	}
+	for _, tt := range tests {
+		if got := Length(tt.provider, tt.model, tt.overrides); got != tt.want {
+			t.Errorf("Length(%s, %s, %v) = %d, want %d", tt.provider, tt.model, tt.overrides, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package cost
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when a budget refuses further requests
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// Budget limits spend per calendar day and month, in local time. Zero
+// disables a limit.
+type Budget struct {
+	Daily   float64
+	Monthly float64
+
+	// Refuse makes an exceeded budget an error rather than a warning
+	Refuse bool
+}
+
+// Enabled reports whether any limit is set
+func (b Budget) Enabled() bool {
+	return b.Daily > 0 || b.Monthly > 0
+}
+
+// Check compares the spend recorded in the ledger with the budget. It
+// returns a warning describing the limits that were reached, or "" if
+// none were. When the budget refuses further requests the warning is
+// returned as an error wrapping ErrBudgetExceeded instead.
+func (b Budget) Check(ledger *Ledger, now time.Time) (string, error) {
+	if !b.Enabled() {
+		return "", nil
+	}
+
+	now = now.Local()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	entries, err := ledger.Entries(monthStart)
+	if err != nil {
+		return "", err
+	}
+
+	month, day := 0.0, 0.0
+	for _, entry := range entries {
+		month += entry.Cost
+		if !entry.Time.Before(dayStart) {
+			day += entry.Cost
+		}
+	}
+
+	reached := make([]string, 0, 2)
+	if b.Daily > 0 && day >= b.Daily {
+		reached = append(reached, fmt.Sprintf("daily budget of $%.2f reached ($%.2f spent today)", b.Daily, day))
+	}
+	if b.Monthly > 0 && month >= b.Monthly {
+		reached = append(reached, fmt.Sprintf("monthly budget of $%.2f reached ($%.2f spent this month)", b.Monthly, month))
+	}
+
+	if len(reached) == 0 {
+		return "", nil
+	}
+
+	warning := strings.Join(reached, "; ")
+	if b.Refuse {
+		return "", fmt.Errorf("%w: %s", ErrBudgetExceeded, warning)
+	}
+	return warning, nil
+}
@@ -0,0 +1,77 @@
+package cost
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLedger returns a ledger in a temporary directory holding entries
+// of the given costs at the given times
+func newTestLedger(t *testing.T, costs map[time.Time]float64) *Ledger {
+	t.Helper()
+	ledger := NewLedger(filepath.Join(t.TempDir(), "usage.jsonl"))
+	for at, cost := range costs {
+		if err := ledger.Record(Entry{Time: at, Provider: "openai", Model: "gpt-4o-mini", Cost: cost}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ledger
+}
+
+func TestBudgetCheck(t *testing.T) {
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	ledger := newTestLedger(t, map[time.Time]float64{
+		time.Date(2026, 2, 28, 23, 30, 0, 0, time.Local): 5,
+		time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local):    0.25,
+		time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local):    0.75,
+	})
+
+	tests := []struct {
+		name    string
+		budget  Budget
+		warning string // a part of the warning, or "" for none
+	}{
+		{"disabled", Budget{}, ""},
+		{"daily at the limit", Budget{Daily: 1}, "daily budget of $1.00 reached ($1.00 spent today)"},
+		{"daily under the limit", Budget{Daily: 1.25}, ""},
+		{"monthly at the limit", Budget{Monthly: 1}, "monthly budget of $1.00 reached ($1.00 spent this month)"},
+		{"last month not counted", Budget{Monthly: 2}, ""},
+		{"both reached", Budget{Daily: 0.5, Monthly: 0.5}, "spent today); monthly budget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning, err := tt.budget.Check(ledger, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (tt.warning == "") != (warning == "") || !strings.Contains(warning, tt.warning) {
+				t.Errorf("warning = %q, want %q", warning, tt.warning)
+			}
+
+			// A refusing budget fails where a warning would be given
+			tt.budget.Refuse = true
+			warning, err = tt.budget.Check(ledger, now)
+			if warning != "" {
+				t.Errorf("refusing budget warned %q", warning)
+			}
+			if tt.warning == "" && err != nil {
+				t.Errorf("refused under the limit: %v", err)
+			}
+			if tt.warning != "" && (!errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), tt.warning)) {
+				t.Errorf("error = %v, want ErrBudgetExceeded with %q", err, tt.warning)
+			}
+		})
+	}
+}
+
+func TestBudgetCheckEmptyLedger(t *testing.T) {
+	ledger := NewLedger(filepath.Join(t.TempDir(), "usage.jsonl"))
+	budget := Budget{Daily: 1, Monthly: 10, Refuse: true}
+	if warning, err := budget.Check(ledger, time.Now()); warning != "" || err != nil {
+		t.Errorf("Check = %q, %v on a missing ledger", warning, err)
+	}
+}
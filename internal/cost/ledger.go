@@ -0,0 +1,121 @@
+package cost
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/fsutil"
+)
+
+// Entry records the usage and cost of one reply
+type Entry struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+
+	// Unpriced is set when the model had no known price, so Cost is zero
+	Unpriced bool `json:"unpriced,omitempty"`
+}
+
+// Ledger is an append-only log of usage entries, one JSON object per line.
+// It records every reply, including those of shell mode and of sessions
+// with history disabled.
+type Ledger struct {
+	path string
+}
+
+// DefaultLedgerPath returns the default location of the usage ledger
+func DefaultLedgerPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".llm-chat-usage.jsonl"
+	}
+	return filepath.Join(homeDir, ".llm-chat", "usage.jsonl")
+}
+
+// NewLedger returns the ledger stored at path, or at the default location
+// if path is empty
+func NewLedger(path string) *Ledger {
+	if path == "" {
+		path = DefaultLedgerPath()
+	}
+	return &Ledger{path: path}
+}
+
+// Path returns the ledger file
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Record appends an entry to the ledger
+func (l *Ledger) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	if err := fsutil.AppendSync(l.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the entries recorded at or after since, oldest first.
+// Lines that cannot be decoded are skipped.
+func (l *Ledger) Entries(since time.Time) ([]Entry, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	return entries, nil
+}
+
+// Spend returns the total cost recorded at or after since
+func (l *Ledger) Spend(since time.Time) (float64, error) {
+	entries, err := l.Entries(since)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, entry := range entries {
+		total += entry.Cost
+	}
+	return total, nil
+}
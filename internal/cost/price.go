@@ -0,0 +1,116 @@
+// Package cost prices token usage and keeps a ledger of spend.
+package cost
+
+import (
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// AnyModel is the model key that prices every model of a provider without
+// a price of its own
+const AnyModel = "*"
+
+// Price is the cost in US dollars per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// Cost returns the cost of the usage in US dollars
+func (p Price) Cost(usage models.Usage) float64 {
+	return (float64(usage.PromptTokens)*p.Input + float64(usage.CompletionTokens)*p.Output) / 1e6
+}
+
+// defaultPrices are list prices keyed by provider and the model ID sent to
+// the API. They drift; the config file can override any of them.
+var defaultPrices = map[string]map[string]Price{
+	"ollama": {
+		AnyModel: {},
+	},
+	"groq": {
+		"llama-3.3-70b-versatile": {Input: 0.59, Output: 0.79},
+		"llama-3.1-8b-instant":    {Input: 0.05, Output: 0.08},
+		"mixtral-8x7b-32768":      {Input: 0.24, Output: 0.24},
+		"gemma2-9b-it":            {Input: 0.20, Output: 0.20},
+	},
+	"together": {
+		"meta-llama/Llama-3.3-70B-Instruct-Turbo":      {Input: 0.88, Output: 0.88},
+		"meta-llama/Llama-3.3-70B-Instruct-Turbo-Free": {},
+		"deepseek-ai/DeepSeek-R1-Distill-Llama-70B":    {Input: 2.00, Output: 2.00},
+		"Qwen/Qwen2.5-72B-Instruct-Turbo":              {Input: 1.20, Output: 1.20},
+	},
+	"samba": {
+		"Meta-Llama-3.3-70B-Instruct": {Input: 0.60, Output: 1.20},
+		"Meta-Llama-3.1-8B-Instruct":  {Input: 0.10, Output: 0.20},
+		"Qwen2.5-72B-Instruct":        {Input: 0.80, Output: 1.60},
+	},
+	"gemini": {
+		"gemini-2.0-flash-exp":     {},
+		"gemini-2.0-flash-lite":    {Input: 0.075, Output: 0.30},
+		"gemini-2.5-pro-exp-03-25": {},
+	},
+	"openai": {
+		"gpt-4o":       {Input: 2.50, Output: 10.00},
+		"gpt-4o-mini":  {Input: 0.15, Output: 0.60},
+		"gpt-4.1":      {Input: 2.00, Output: 8.00},
+		"gpt-4.1-mini": {Input: 0.40, Output: 1.60},
+		"o4-mini":      {Input: 1.10, Output: 4.40},
+	},
+	"anthropic": {
+		"claude-sonnet-4-5": {Input: 3.00, Output: 15.00},
+		"claude-haiku-4-5":  {Input: 1.00, Output: 5.00},
+		"claude-opus-4-1":   {Input: 15.00, Output: 75.00},
+	},
+}
+
+// Table looks up prices by provider and model
+type Table struct {
+	prices map[string]map[string]Price
+}
+
+// NewTable returns a table of the built-in prices with overrides applied
+// on top. Overrides are keyed like the built-in prices.
+func NewTable(overrides map[string]map[string]Price) *Table {
+	t := &Table{prices: make(map[string]map[string]Price)}
+
+	for _, prices := range []map[string]map[string]Price{defaultPrices, overrides} {
+		for provider, models := range prices {
+			for model, price := range models {
+				t.Set(provider, model, price)
+			}
+		}
+	}
+
+	return t
+}
+
+// Set sets the price of a model
+func (t *Table) Set(provider, model string, price Price) {
+	if t.prices[provider] == nil {
+		t.prices[provider] = make(map[string]Price)
+	}
+	t.prices[provider][model] = price
+}
+
+// Lookup returns the price of a model, falling back to the provider's
+// AnyModel price. It returns false if the model has no known price.
+func (t *Table) Lookup(provider, model string) (Price, bool) {
+	models, ok := t.prices[provider]
+	if !ok {
+		return Price{}, false
+	}
+	if price, ok := models[model]; ok {
+		return price, true
+	}
+	price, ok := models[AnyModel]
+	return price, ok
+}
+
+// Cost returns the cost of a reply in US dollars. It returns false if the
+// model has no known price.
+func (t *Table) Cost(provider, model string, usage models.Usage) (float64, bool) {
+	price, ok := t.Lookup(provider, model)
+	if !ok {
+		return 0, false
+	}
+	return price.Cost(usage), true
+}
@@ -0,0 +1,49 @@
+package cost
+
+import (
+	"testing"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+func TestTableLookup(t *testing.T) {
+	table := NewTable(map[string]map[string]Price{
+		"openai": {"gpt-4o-mini": {Input: 1, Output: 2}},
+		"custom": {AnyModel: {Input: 3, Output: 4}},
+	})
+
+	tests := []struct {
+		provider, model string
+		want            Price
+		ok              bool
+	}{
+		{"anthropic", "claude-haiku-4-5", Price{Input: 1, Output: 5}, true},
+		{"openai", "gpt-4o-mini", Price{Input: 1, Output: 2}, true},
+		{"ollama", "llama3.2", Price{}, true},
+		{"custom", "anything", Price{Input: 3, Output: 4}, true},
+		{"openai", "gpt-99", Price{}, false},
+		{"unknown", "gpt-4o-mini", Price{}, false},
+		{"anthropic", "", Price{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Lookup(tt.provider, tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%s, %s) = %+v, %v; want %+v, %v", tt.provider, tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTableCost(t *testing.T) {
+	table := NewTable(nil)
+	usage := models.Usage{PromptTokens: 2_000_000, CompletionTokens: 500_000}
+
+	if got, ok := table.Cost("anthropic", "claude-haiku-4-5", usage); !ok || got != 4.5 {
+		t.Errorf("priced at %v, %v; want 4.5", got, ok)
+	}
+	if got, ok := table.Cost("ollama", "llama3.2", usage); !ok || got != 0 {
+		t.Errorf("local model priced at %v, %v; want free", got, ok)
+	}
+	if got, ok := table.Cost("openai", "gpt-99", usage); ok || got != 0 {
+		t.Errorf("unknown model priced at %v, %v", got, ok)
+	}
+}
@@ -0,0 +1,81 @@
+package cost
+
+import (
+	"sort"
+)
+
+// Line totals the entries that share a key, such as a day or a provider
+type Line struct {
+	Key              string
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Unpriced         int // requests whose model had no known price
+}
+
+// add counts an entry in the line
+func (l *Line) add(entry Entry) {
+	l.Requests++
+	l.PromptTokens += entry.PromptTokens
+	l.CompletionTokens += entry.CompletionTokens
+	l.Cost += entry.Cost
+	if entry.Unpriced {
+		l.Unpriced++
+	}
+}
+
+// Report breaks spend down by day, provider and model
+type Report struct {
+	Total      Line
+	ByDay      []Line // oldest first, keyed YYYY-MM-DD in local time
+	ByProvider []Line // most expensive first
+	ByModel    []Line // most expensive first, keyed provider/model
+}
+
+// Summarize builds a report from ledger entries
+func Summarize(entries []Entry) Report {
+	report := Report{Total: Line{Key: "total"}}
+	days := make(map[string]*Line)
+	providers := make(map[string]*Line)
+	models := make(map[string]*Line)
+
+	for _, entry := range entries {
+		report.Total.add(entry)
+		addTo(days, entry.Time.Local().Format("2006-01-02"), entry)
+		addTo(providers, entry.Provider, entry)
+		addTo(models, entry.Provider+"/"+entry.Model, entry)
+	}
+
+	report.ByDay = sortedLines(days, func(a, b Line) bool { return a.Key < b.Key })
+	byCost := func(a, b Line) bool {
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.Key < b.Key
+	}
+	report.ByProvider = sortedLines(providers, byCost)
+	report.ByModel = sortedLines(models, byCost)
+
+	return report
+}
+
+// addTo counts an entry in the line for key
+func addTo(lines map[string]*Line, key string, entry Entry) {
+	line, ok := lines[key]
+	if !ok {
+		line = &Line{Key: key}
+		lines[key] = line
+	}
+	line.add(entry)
+}
+
+// sortedLines returns the lines in the given order
+func sortedLines(lines map[string]*Line, less func(a, b Line) bool) []Line {
+	result := make([]Line, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, *line)
+	}
+	sort.Slice(result, func(i, j int) bool { return less(result[i], result[j]) })
+	return result
+}
@@ -0,0 +1,59 @@
+package cost
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeAcrossMonths(t *testing.T) {
+	entries := []Entry{
+		{Time: time.Date(2026, 2, 28, 23, 30, 0, 0, time.Local), Provider: "openai", Model: "gpt-4o-mini", PromptTokens: 100, CompletionTokens: 10, Cost: 0.5},
+		{Time: time.Date(2026, 2, 28, 8, 0, 0, 0, time.Local), Provider: "anthropic", Model: "claude-haiku-4-5", PromptTokens: 200, CompletionTokens: 20, Cost: 2},
+		{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local), Provider: "openai", Model: "gpt-4o", PromptTokens: 300, CompletionTokens: 30, Cost: 1.5},
+		{Time: time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local), Provider: "custom", Model: "local", PromptTokens: 400, CompletionTokens: 40, Unpriced: true},
+	}
+	report := Summarize(entries)
+
+	total := Line{Key: "total", Requests: 4, PromptTokens: 1000, CompletionTokens: 100, Cost: 4, Unpriced: 1}
+	if report.Total != total {
+		t.Errorf("total = %+v, want %+v", report.Total, total)
+	}
+
+	days := []Line{
+		{Key: "2026-02-28", Requests: 2, PromptTokens: 300, CompletionTokens: 30, Cost: 2.5},
+		{Key: "2026-03-01", Requests: 2, PromptTokens: 700, CompletionTokens: 70, Cost: 1.5, Unpriced: 1},
+	}
+	if len(report.ByDay) != len(days) {
+		t.Fatalf("days = %+v", report.ByDay)
+	}
+	for i, day := range days {
+		if report.ByDay[i] != day {
+			t.Errorf("day %d = %+v, want %+v", i, report.ByDay[i], day)
+		}
+	}
+
+	// Ties in cost are broken by key
+	if got := keys(report.ByProvider); got != "anthropic,openai,custom" {
+		t.Errorf("providers ordered %s", got)
+	}
+	if got := keys(report.ByModel); got != "anthropic/claude-haiku-4-5,openai/gpt-4o,openai/gpt-4o-mini,custom/local" {
+		t.Errorf("models ordered %s", got)
+	}
+}
+
+func TestSummarizeEmpty(t *testing.T) {
+	report := Summarize(nil)
+	if report.Total != (Line{Key: "total"}) || len(report.ByDay) != 0 || len(report.ByProvider) != 0 {
+		t.Errorf("empty report = %+v", report)
+	}
+}
+
+// keys returns the keys of the lines joined by commas
+func keys(lines []Line) string {
+	var out []string
+	for _, line := range lines {
+		out = append(out, line.Key)
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,273 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// AssertionResult is the outcome of one assertion on a reply
+type AssertionResult struct {
+	Type    string `json:"type"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"` // why it failed, or the judge's reason
+}
+
+// judgeFunc grades a reply to prompt against a rubric
+type judgeFunc func(ctx context.Context, prompt, reply, rubric string) (bool, string, error)
+
+// check runs the assertion on a reply to prompt. Rubric assertions are
+// graded by judge.
+func (a *Assertion) check(ctx context.Context, prompt, reply string, judge judgeFunc) AssertionResult {
+	result := AssertionResult{Type: a.Type()}
+
+	switch result.Type {
+	case TypeContains:
+		haystack, needle := reply, a.Contains
+		if a.IgnoreCase {
+			haystack, needle = strings.ToLower(haystack), strings.ToLower(needle)
+		}
+		result.Passed = strings.Contains(haystack, needle)
+		if !result.Passed {
+			result.Message = fmt.Sprintf("reply does not contain %q", a.Contains)
+		}
+
+	case TypeRegex:
+		result.Passed = a.regex.MatchString(reply)
+		if !result.Passed {
+			result.Message = fmt.Sprintf("reply does not match /%s/", a.Regex)
+		}
+
+	case TypeEquals:
+		got, want := strings.TrimSpace(reply), strings.TrimSpace(a.Equals)
+		if a.IgnoreCase {
+			result.Passed = strings.EqualFold(got, want)
+		} else {
+			result.Passed = got == want
+		}
+		if !result.Passed {
+			result.Message = fmt.Sprintf("reply is %q, want %q", truncate(got, 200), want)
+		}
+
+	case TypeJSONSchema:
+		var value any
+		if err := json.Unmarshal([]byte(extractJSON(reply)), &value); err != nil {
+			result.Message = fmt.Sprintf("reply is not JSON: %v", err)
+			break
+		}
+		if err := validate(a.JSONSchema, value, "$"); err != nil {
+			result.Message = err.Error()
+			break
+		}
+		result.Passed = true
+
+	case TypeRubric:
+		passed, reason, err := judge(ctx, prompt, reply, a.Rubric)
+		if err != nil {
+			result.Message = fmt.Sprintf("judge failed: %v", err)
+			break
+		}
+		result.Passed, result.Message = passed, reason
+	}
+
+	return result
+}
+
+// fencePattern matches a fenced code block, capturing its contents
+var fencePattern = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n(.*?)```")
+
+// extractJSON returns the JSON in a reply, which models often wrap in a
+// fenced code block
+func extractJSON(reply string) string {
+	if match := fencePattern.FindStringSubmatch(reply); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(reply)
+}
+
+// validate checks value against a JSON schema. It supports type, enum,
+// const, properties, required, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum and maximum, which
+// cover the shapes replies are usually asked for.
+func validate(schema map[string]any, value any, path string) error {
+	if t, ok := schema["type"]; ok {
+		types := []string{}
+		switch t := t.(type) {
+		case string:
+			types = append(types, t)
+		case []any:
+			for _, name := range t {
+				types = append(types, fmt.Sprint(name))
+			}
+		}
+		if !slices.ContainsFunc(types, func(name string) bool { return hasType(value, name) }) {
+			return fmt.Errorf("%s: is %s, want %s", path, typeName(value), strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		if !slices.ContainsFunc(enum, func(v any) bool { return equal(v, value) }) {
+			return fmt.Errorf("%s: %v is not one of %v", path, value, enum)
+		}
+	}
+	if c, ok := schema["const"]; ok && !equal(c, value) {
+		return fmt.Errorf("%s: is %v, want %v", path, value, c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateObject(schema, v, path)
+
+	case []any:
+		if n, ok := number(schema["minItems"]); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: has %d items, want at least %v", path, len(v), n)
+		}
+		if n, ok := number(schema["maxItems"]); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: has %d items, want at most %v", path, len(v), n)
+		}
+		if items, ok := asSchema(schema["items"]); ok {
+			for i, item := range v {
+				if err := validate(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := number(schema["minLength"]); ok && length < n {
+			return fmt.Errorf("%s: is %v characters, want at least %v", path, length, n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && length > n {
+			return fmt.Errorf("%s: is %v characters, want at most %v", path, length, n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: invalid pattern in schema: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: %q does not match /%s/", path, v, pattern)
+			}
+		}
+
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			return fmt.Errorf("%s: %v is less than %v", path, v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			return fmt.Errorf("%s: %v is more than %v", path, v, n)
+		}
+	}
+
+	return nil
+}
+
+// validateObject checks the properties of an object
+func validateObject(schema map[string]any, object map[string]any, path string) error {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if _, ok := object[fmt.Sprint(name)]; !ok {
+				return fmt.Errorf("%s: missing property %s", path, name)
+			}
+		}
+	}
+
+	properties, _ := asSchema(schema["properties"])
+
+	// Sorted, so that the first failure reported is always the same
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := asSchema(properties[name])
+		if !ok {
+			if additional, isBool := schema["additionalProperties"].(bool); isBool && !additional {
+				return fmt.Errorf("%s: unexpected property %s", path, name)
+			}
+			continue
+		}
+		if err := validate(property, object[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asSchema returns a schema found in another, as decoded from YAML or JSON
+func asSchema(v any) (map[string]any, bool) {
+	schema, ok := v.(map[string]any)
+	return schema, ok
+}
+
+// number returns a numeric schema keyword, decoded as an int from YAML or
+// a float64 from JSON
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// hasType reports whether a decoded JSON value is of the named JSON type
+func hasType(value any, name string) bool {
+	switch name {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return typeName(value) == name
+}
+
+// typeName returns the JSON type of a decoded value
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// equal compares a schema value with a decoded JSON value, treating
+// numbers of any type alike
+func equal(schemaValue, value any) bool {
+	if a, ok := number(schemaValue); ok {
+		b, ok := value.(float64)
+		return ok && a == b
+	}
+	return typeName(schemaValue) == typeName(value) && fmt.Sprint(schemaValue) == fmt.Sprint(value)
+}
+
+// truncate shortens s to at most n bytes for messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,123 @@
+package eval
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssertions(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []any{"name", "tags"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string", "minLength": 1},
+			"age":  map[string]any{"type": "integer", "minimum": 0},
+			"tags": map[string]any{"type": "array", "items": map[string]any{"enum": []any{"a", "b"}}},
+		},
+		"additionalProperties": false,
+	}
+
+	tests := []struct {
+		name      string
+		assertion Assertion
+		reply     string
+		passed    bool
+	}{
+		{"contains", Assertion{Contains: "Paris"}, "It is Paris.", true},
+		{"contains case", Assertion{Contains: "paris"}, "It is Paris.", false},
+		{"contains ignore case", Assertion{Contains: "paris", IgnoreCase: true}, "It is Paris.", true},
+		{"regex", Assertion{Regex: `^\d+$`}, "42", true},
+		{"regex no match", Assertion{Regex: `^\d+$`}, "forty-two", false},
+		{"equals trims", Assertion{Equals: "4"}, " 4\n", true},
+		{"equals", Assertion{Equals: "4"}, "4.", false},
+		{"schema", Assertion{JSONSchema: schema}, `{"name": "Ada", "age": 36, "tags": ["a"]}`, true},
+		{"schema fenced", Assertion{JSONSchema: schema}, "Here:\n```json\n{\"name\": \"Ada\", \"tags\": []}\n```", true},
+		{"schema missing", Assertion{JSONSchema: schema}, `{"name": "Ada"}`, false},
+		{"schema extra", Assertion{JSONSchema: schema}, `{"name": "Ada", "tags": [], "x": 1}`, false},
+		{"schema type", Assertion{JSONSchema: schema}, `{"name": "Ada", "age": 3.5, "tags": []}`, false},
+		{"schema enum", Assertion{JSONSchema: schema}, `{"name": "Ada", "tags": ["c"]}`, false},
+		{"not json", Assertion{JSONSchema: schema}, "no", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.assertion.compile(); err != nil {
+				t.Fatal(err)
+			}
+			result := tt.assertion.check(context.Background(), "prompt", tt.reply, nil)
+			if result.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v (%s)", result.Passed, tt.passed, result.Message)
+			}
+			if !result.Passed && result.Message == "" {
+				t.Error("failed without a message")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlSuite := filepath.Join(dir, "suite.yaml")
+	os.WriteFile(yamlSuite, []byte(`
+name: capitals
+system: Answer with one word.
+targets: [groq, gemini:flash]
+cases:
+  - name: france
+    prompt: Capital of France?
+    expected: Paris
+  - prompt: Capital of Peru?
+    assert:
+      - contains: lima
+        ignore_case: true
+      - json_schema:
+          type: string
+`), 0o644)
+
+	suite, err := Load(yamlSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "capitals" || len(suite.Targets) != 2 || len(suite.Cases) != 2 {
+		t.Fatalf("suite = %+v", suite)
+	}
+	if suite.Cases[0].Assert[0].Type() != TypeEquals {
+		t.Errorf("expected became %q, want an equals assertion", suite.Cases[0].Assert[0].Type())
+	}
+	if suite.Cases[1].Name != "case-2" || suite.Cases[1].Assert[1].Type() != TypeJSONSchema {
+		t.Errorf("second case = %+v", suite.Cases[1])
+	}
+
+	jsonlSuite := filepath.Join(dir, "smoke.jsonl")
+	os.WriteFile(jsonlSuite, []byte(`{"prompt": "2+2?", "expected": "4"}
+
+{"name": "hi", "prompt": "Say hi", "assert": [{"regex": "(?i)hi"}]}
+`), 0o644)
+
+	suite, err = Load(jsonlSuite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "smoke" || len(suite.Cases) != 2 || suite.Cases[1].Name != "hi" {
+		t.Fatalf("suite = %+v", suite)
+	}
+
+	invalid := []struct{ name, content, want string }{
+		{"no assertions", "cases: [{prompt: hi}]", "no assertions"},
+		{"two checks", "cases: [{prompt: hi, assert: [{contains: a, regex: b}]}]", "exactly one"},
+		{"bad regex", "cases: [{prompt: hi, assert: [{regex: '('}]}]", "invalid regex"},
+		{"duplicate", "cases: [{name: a, prompt: hi, expected: x}, {name: a, prompt: hi, expected: x}]", "twice"},
+		{"no prompt", "cases: [{expected: x}]", "no prompt"},
+	}
+	for _, tt := range invalid {
+		path := filepath.Join(dir, "invalid.yaml")
+		os.WriteFile(path, []byte(tt.content), 0o644)
+		if _, err := Load(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
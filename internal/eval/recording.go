@@ -0,0 +1,232 @@
+package eval
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// Recording holds provider replies keyed by the request that produced
+// them, so that a suite can be run again offline. Recordings are saved as
+// JSONL, one reply per line.
+type Recording struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	order   []string // keys in the order they were added
+}
+
+// Entry is a recorded reply. Model is the model asked for, empty for the
+// provider's default, and ResponseModel the one that answered.
+type Entry struct {
+	Provider      string         `json:"provider"`
+	Model         string         `json:"model,omitempty"`
+	Messages      []EntryMessage `json:"messages"`
+	Response      string         `json:"response"`
+	ResponseModel string         `json:"response_model,omitempty"`
+	Usage         *models.Usage  `json:"usage,omitempty"`
+	FinishReason  string         `json:"finish_reason,omitempty"`
+	LatencyMS     int64          `json:"latency_ms,omitempty"`
+}
+
+// EntryMessage is a message of a recorded request
+type EntryMessage struct {
+	Role    models.Role `json:"role"`
+	Content string      `json:"content"`
+}
+
+// NewRecording returns an empty recording
+func NewRecording() *Recording {
+	return &Recording{entries: make(map[string]Entry)}
+}
+
+// LoadRecording reads a recording saved by Save
+func LoadRecording(path string) (*Recording, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+	defer file.Close()
+
+	r := NewRecording()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid recording %s, line %d: %w", path, line, err)
+		}
+		r.Add(entry)
+	}
+	return r, scanner.Err()
+}
+
+// Save writes the recording to path
+func (r *Recording) Save(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to save recording: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	enc := json.NewEncoder(w)
+	for _, key := range r.order {
+		if err := enc.Encode(r.entries[key]); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Add records a reply, replacing any earlier one to the same request
+func (r *Recording) Add(entry Entry) {
+	key := entryKey(entry.Provider, entry.Model, entry.Messages)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.entries[key]; !ok {
+		r.order = append(r.order, key)
+	}
+	r.entries[key] = entry
+}
+
+// find returns the reply recorded for a request
+func (r *Recording) find(provider string, req models.ChatRequest) (Entry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[entryKey(provider, req.Model, entryMessages(req.Messages))]
+	return entry, ok
+}
+
+// Replay returns a provider of the given name that answers from the
+// recording, for use as a registry lookup. Requests that were not
+// recorded fail.
+func (r *Recording) Replay(name string) (providers.Provider, error) {
+	return &replayProvider{name: name, recording: r}, nil
+}
+
+// Record wraps a provider so that its replies are added to the recording
+func (r *Recording) Record(p providers.Provider) providers.Provider {
+	return &recordingProvider{Provider: p, recording: r}
+}
+
+// entryKey identifies a request by provider, model and messages
+func entryKey(provider, model string, messages []EntryMessage) string {
+	data, _ := json.Marshal(struct {
+		Provider string
+		Model    string
+		Messages []EntryMessage
+	}{provider, model, messages})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// entryMessages returns the parts of messages a recording keeps
+func entryMessages(messages []models.Message) []EntryMessage {
+	entries := make([]EntryMessage, len(messages))
+	for i, msg := range messages {
+		entries[i] = EntryMessage{Role: msg.Role, Content: msg.Content}
+	}
+	return entries
+}
+
+// replayProvider answers from a recording
+type replayProvider struct {
+	name      string
+	recording *Recording
+}
+
+func (p *replayProvider) Name() string                          { return p.name }
+func (p *replayProvider) Models() []string                      { return nil }
+func (p *replayProvider) DefaultModel() string                  { return "recorded" }
+func (p *replayProvider) Initialize(cfg providers.Config) error { return nil }
+func (p *replayProvider) IsAvailable() bool                     { return true }
+
+func (p *replayProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	entry, ok := p.recording.find(p.name, req)
+	if !ok {
+		return nil, &providers.Error{
+			Provider: p.name,
+			Class:    providers.ClassBadRequest,
+			Err:      fmt.Errorf("no recorded reply from %s to this request; record the suite again", p.name),
+		}
+	}
+
+	return &models.ChatResponse{
+		Content:      entry.Response,
+		FinishReason: entry.FinishReason,
+		Usage:        entry.Usage,
+		ResponseTime: time.Duration(entry.LatencyMS) * time.Millisecond,
+		ProviderName: p.name,
+		ModelName:    cmp.Or(entry.ResponseModel, entry.Model),
+	}, nil
+}
+
+// StreamMessage sends the recorded reply as a single chunk
+func (p *replayProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	resp, err := p.SendMessage(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan models.StreamChunk, 2)
+	ch <- models.StreamChunk{Content: resp.Content}
+	ch <- models.StreamChunk{
+		Done:         true,
+		Usage:        resp.Usage,
+		FinishReason: resp.FinishReason,
+		ProviderName: resp.ProviderName,
+		ModelName:    resp.ModelName,
+	}
+	close(ch)
+	return ch, nil
+}
+
+// recordingProvider adds the replies of a provider to a recording
+type recordingProvider struct {
+	providers.Provider
+	recording *Recording
+}
+
+func (p *recordingProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	start := time.Now()
+	resp, err := p.Provider.SendMessage(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	p.recording.Add(Entry{
+		Provider:      p.Name(),
+		Model:         req.Model,
+		Messages:      entryMessages(req.Messages),
+		Response:      resp.Content,
+		ResponseModel: cmp.Or(resp.ModelName, req.Model, p.DefaultModel()),
+		Usage:         resp.Usage,
+		FinishReason:  resp.FinishReason,
+		LatencyMS:     time.Since(start).Milliseconds(),
+	})
+	return resp, nil
+}
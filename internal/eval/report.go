@@ -0,0 +1,278 @@
+package eval
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/internal/ui"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// CaseResult is the outcome of one case on one target. A case passes when
+// the target replied and every assertion passed.
+type CaseResult struct {
+	Case       string            `json:"case"`
+	Target     string            `json:"target"`
+	Provider   string            `json:"provider"`
+	Model      string            `json:"model"`
+	Passed     bool              `json:"passed"`
+	Response   string            `json:"response,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	ErrorClass string            `json:"error_class,omitempty"`
+	Assertions []AssertionResult `json:"assertions,omitempty"`
+	LatencyMS  int64             `json:"latency_ms"`
+	Usage      *models.Usage     `json:"usage,omitempty"`
+	Cost       float64           `json:"cost"`
+}
+
+// TargetSummary totals the results of one target. Errors counts cases the
+// target failed to answer, which are also counted as failed.
+type TargetSummary struct {
+	Target       string  `json:"target"`
+	Cases        int     `json:"cases"`
+	Passed       int     `json:"passed"`
+	Failed       int     `json:"failed"`
+	Errors       int     `json:"errors"`
+	PassRate     float64 `json:"pass_rate"`
+	AvgLatencyMS int64   `json:"avg_latency_ms"`
+	Cost         float64 `json:"cost"`
+}
+
+// Report is the outcome of running a suite
+type Report struct {
+	Suite      string          `json:"suite"`
+	Started    time.Time       `json:"started"`
+	DurationMS int64           `json:"duration_ms"`
+	Targets    []TargetSummary `json:"targets"`
+	Results    []CaseResult    `json:"results"`
+	JudgeCost  float64         `json:"judge_cost,omitempty"`
+}
+
+// summarize totals the results of each target
+func (r *Report) summarize(targets []providers.Route) {
+	r.Targets = make([]TargetSummary, len(targets))
+	index := make(map[string]int, len(targets))
+	for i, target := range targets {
+		r.Targets[i].Target = target.String()
+		index[target.String()] = i
+	}
+
+	latency := make([]int64, len(targets))
+	for _, result := range r.Results {
+		i := index[result.Target]
+		summary := &r.Targets[i]
+
+		summary.Cases++
+		summary.Cost += result.Cost
+		latency[i] += result.LatencyMS
+		switch {
+		case result.Passed:
+			summary.Passed++
+		case result.Error != "":
+			summary.Errors++
+			summary.Failed++
+		default:
+			summary.Failed++
+		}
+	}
+
+	for i := range r.Targets {
+		if n := r.Targets[i].Cases; n > 0 {
+			r.Targets[i].PassRate = float64(r.Targets[i].Passed) / float64(n)
+			r.Targets[i].AvgLatencyMS = latency[i] / int64(n)
+		}
+	}
+}
+
+// Failed returns the number of results that did not pass
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Cost returns the total cost of the run, the judge's included
+func (r *Report) Cost() float64 {
+	total := r.JudgeCost
+	for _, summary := range r.Targets {
+		total += summary.Cost
+	}
+	return total
+}
+
+// WriteTable writes the failures, then a table of pass rates per target
+func (r *Report) WriteTable(w io.Writer) error {
+	for _, result := range r.Results {
+		if result.Passed {
+			continue
+		}
+		fmt.Fprintf(w, "FAIL %s on %s: %s\n", result.Case, result.Target, failureMessage(result))
+	}
+	if r.Failed() > 0 {
+		fmt.Fprintln(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join([]string{"Target", "Passed", "Failed", "Errors", "Pass rate", "Avg latency", "Cost"}, "\t"))
+	for _, s := range r.Targets {
+		fmt.Fprintln(tw, strings.Join([]string{
+			s.Target,
+			fmt.Sprint(s.Passed),
+			fmt.Sprint(s.Failed),
+			fmt.Sprint(s.Errors),
+			fmt.Sprintf("%.0f%%", s.PassRate*100),
+			fmt.Sprintf("%.2fs", float64(s.AvgLatencyMS)/1000),
+			ui.FormatCost(s.Cost),
+		}, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	summary := fmt.Sprintf("\n%s: %d of %d passed in %.1fs, %s",
+		r.Suite, len(r.Results)-r.Failed(), len(r.Results), float64(r.DurationMS)/1000, ui.FormatCost(r.Cost()))
+	if r.JudgeCost > 0 {
+		summary += fmt.Sprintf(" (judge %s)", ui.FormatCost(r.JudgeCost))
+	}
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+// WriteJSON writes the report as a JSON document
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// JUnit XML elements, as read by CI systems
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Errors   int          `xml:"errors,attr"`
+		Time     string       `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Errors   int         `xml:"errors,attr"`
+		Time     string      `xml:"time,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitProblem `xml:"failure,omitempty"`
+		Error     *junitProblem `xml:"error,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitProblem struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes the report as JUnit XML, with a test suite per target
+// and a test case per case. Replies that failed an assertion are failures;
+// targets that failed to reply are errors.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	doc := junitSuites{Name: r.Suite, Time: seconds(r.DurationMS)}
+
+	for _, summary := range r.Targets {
+		suite := junitSuite{Name: r.Suite + "/" + summary.Target, Tests: summary.Cases}
+		var total int64
+
+		for _, result := range r.Results {
+			if result.Target != summary.Target {
+				continue
+			}
+			total += result.LatencyMS
+
+			tc := junitCase{
+				Name:      result.Case,
+				ClassName: r.Suite + "." + summary.Target,
+				Time:      seconds(result.LatencyMS),
+			}
+			switch {
+			case result.Error != "":
+				tc.Error = &junitProblem{Message: result.Error, Type: result.ErrorClass}
+				suite.Errors++
+			case !result.Passed:
+				tc.Failure = &junitProblem{Message: failureMessage(result), Text: failureDetails(result)}
+				tc.SystemOut = result.Response
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+
+		suite.Time = seconds(total)
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Errors += suite.Errors
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// failureMessage returns why a result failed: its error, or the message of
+// its first failed assertion
+func failureMessage(result CaseResult) string {
+	if result.Error != "" {
+		return result.Error
+	}
+	for _, a := range result.Assertions {
+		if !a.Passed {
+			return fmt.Sprintf("%s: %s", a.Type, a.Message)
+		}
+	}
+	return "failed"
+}
+
+// failureDetails lists every assertion of a result with its outcome
+func failureDetails(result CaseResult) string {
+	var lines []string
+	for _, a := range result.Assertions {
+		status := "ok"
+		if !a.Passed {
+			status = "FAIL"
+		}
+		line := fmt.Sprintf("%s %s", status, a.Type)
+		if a.Message != "" {
+			line += ": " + a.Message
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// seconds formats milliseconds as the seconds JUnit expects
+func seconds(ms int64) string {
+	return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
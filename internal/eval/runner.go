@@ -0,0 +1,248 @@
+package eval
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// Runner runs suites against its targets
+type Runner struct {
+	// Lookup returns the provider of a target, usually a registry's Get
+	Lookup func(name string) (providers.Provider, error)
+
+	Targets     []providers.Route
+	Judge       *providers.Route // grades rubric assertions
+	Concurrency int              // requests sent at once
+	Temperature float64          // unless the suite sets one
+	MaxTokens   int
+
+	// Cost, if set, prices a reply, which it may also record
+	Cost func(provider, model string, usage *models.Usage) (float64, error)
+
+	// OnResult, if set, is called as each case finishes on a target
+	OnResult func(CaseResult)
+
+	costMu sync.Mutex
+}
+
+// judgePrompt asks the judge to grade a reply against a rubric
+const judgePrompt = `You are grading a reply from an AI assistant.
+
+Prompt:
+%s
+
+Reply:
+%s
+
+Rubric:
+%s
+
+Answer PASS if the reply meets the rubric and FAIL if it does not. Write
+PASS or FAIL on the first line and one sentence explaining why on the
+second.`
+
+// Run sends every case to every target and checks the replies. Cases run
+// concurrently; results are reported in case order, then target order.
+// Cancelling ctx stops the run and returns the results so far with the
+// context's error.
+func (r *Runner) Run(ctx context.Context, suite *Suite) (*Report, error) {
+	if len(r.Targets) == 0 {
+		return nil, fmt.Errorf("no targets to evaluate")
+	}
+	if suite.UsesJudge() && r.Judge == nil {
+		return nil, fmt.Errorf("suite %s has rubric assertions but no judge; set one with --judge", suite.Name)
+	}
+
+	seen := make(map[string]bool)
+	for _, target := range r.Targets {
+		if seen[target.String()] {
+			return nil, fmt.Errorf("%s is listed twice", target)
+		}
+		seen[target.String()] = true
+	}
+
+	providerOf := make(map[string]providers.Provider)
+	routes := append([]providers.Route{}, r.Targets...)
+	if r.Judge != nil {
+		routes = append(routes, *r.Judge)
+	}
+	for _, route := range routes {
+		provider, err := r.Lookup(route.Provider)
+		if err != nil {
+			return nil, err
+		}
+		providerOf[route.Provider] = provider
+	}
+
+	temperature := r.Temperature
+	if suite.Temperature != nil {
+		temperature = *suite.Temperature
+	}
+
+	report := &Report{Suite: suite.Name, Started: time.Now()}
+	results := make([]CaseResult, len(suite.Cases)*len(r.Targets))
+
+	var judgeCost float64
+	judge := func(ctx context.Context, prompt, reply, rubric string) (bool, string, error) {
+		passed, reason, amount, err := r.judge(ctx, providerOf[r.Judge.Provider], prompt, reply, rubric)
+		r.costMu.Lock()
+		judgeCost += amount
+		r.costMu.Unlock()
+		return passed, reason, err
+	}
+
+	slots := make(chan struct{}, max(r.Concurrency, 1))
+	var wg sync.WaitGroup
+
+cases:
+	for i, c := range suite.Cases {
+		for j, target := range r.Targets {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break cases
+			}
+
+			wg.Add(1)
+			go func(index int, c Case, target providers.Route) {
+				defer wg.Done()
+				defer func() { <-slots }()
+
+				req := models.ChatRequest{
+					Messages:    caseMessages(suite, c),
+					Model:       target.Model,
+					Temperature: models.Temperature(temperature),
+					MaxTokens:   r.MaxTokens,
+					Metadata:    map[string]string{providers.MetadataMode: "shell"},
+				}
+				results[index] = r.runCase(ctx, providerOf[target.Provider], target, c, req, judge)
+				if r.OnResult != nil {
+					r.OnResult(results[index])
+				}
+			}(i*len(r.Targets)+j, c, target)
+		}
+	}
+	wg.Wait()
+
+	report.DurationMS = time.Since(report.Started).Milliseconds()
+	report.JudgeCost = judgeCost
+
+	// Cases that never started are left out
+	for _, result := range results {
+		if result.Case != "" {
+			report.Results = append(report.Results, result)
+		}
+	}
+	report.summarize(r.Targets)
+
+	return report, ctx.Err()
+}
+
+// caseMessages returns the conversation sent for a case
+func caseMessages(suite *Suite, c Case) []models.Message {
+	now := time.Now()
+
+	var messages []models.Message
+	if system := cmp.Or(c.System, suite.System); system != "" {
+		messages = append(messages, models.Message{Role: models.RoleSystem, Content: system, Timestamp: now})
+	}
+	return append(messages, models.Message{Role: models.RoleUser, Content: c.Prompt, Timestamp: now})
+}
+
+// runCase sends a case to a target and checks the reply
+func (r *Runner) runCase(ctx context.Context, provider providers.Provider, target providers.Route, c Case, req models.ChatRequest, judge judgeFunc) CaseResult {
+	result := CaseResult{
+		Case:     c.Name,
+		Target:   target.String(),
+		Provider: provider.Name(),
+		Model:    cmp.Or(target.Model, provider.DefaultModel()),
+	}
+
+	start := time.Now()
+	resp, err := provider.SendMessage(ctx, req)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		result.ErrorClass = string(providers.ClassOf(err))
+		return result
+	}
+
+	result.Response = resp.Content
+	result.Usage = resp.Usage
+	if resp.ResponseTime > 0 {
+		result.LatencyMS = resp.ResponseTime.Milliseconds()
+	}
+	if resp.ProviderName != "" {
+		result.Provider = resp.ProviderName
+	}
+	if resp.ModelName != "" {
+		result.Model = resp.ModelName
+	}
+	result.Cost = r.cost(result.Provider, result.Model, resp.Usage)
+
+	result.Passed = true
+	for i := range c.Assert {
+		check := c.Assert[i].check(ctx, c.Prompt, resp.Content, judge)
+		result.Assertions = append(result.Assertions, check)
+		result.Passed = result.Passed && check.Passed
+	}
+	return result
+}
+
+// judge asks the judge whether a reply meets a rubric, returning its
+// verdict, its reason and the cost of asking
+func (r *Runner) judge(ctx context.Context, provider providers.Provider, prompt, reply, rubric string) (bool, string, float64, error) {
+	req := models.ChatRequest{
+		Messages: []models.Message{{
+			Role:      models.RoleUser,
+			Content:   fmt.Sprintf(judgePrompt, prompt, reply, rubric),
+			Timestamp: time.Now(),
+		}},
+		Model:       r.Judge.Model,
+		Temperature: models.Temperature(0),
+		MaxTokens:   200,
+		Metadata:    map[string]string{providers.MetadataMode: "shell"},
+	}
+
+	resp, err := provider.SendMessage(ctx, req)
+	if err != nil {
+		return false, "", 0, err
+	}
+	amount := r.cost(cmp.Or(resp.ProviderName, provider.Name()), cmp.Or(resp.ModelName, r.Judge.Model, provider.DefaultModel()), resp.Usage)
+
+	verdict, reason, _ := strings.Cut(strings.TrimSpace(resp.Content), "\n")
+	verdict = strings.ToUpper(strings.Trim(strings.TrimSpace(verdict), "*.:"))
+	reason = strings.TrimSpace(reason)
+
+	switch {
+	case strings.HasPrefix(verdict, "PASS"):
+		return true, reason, amount, nil
+	case strings.HasPrefix(verdict, "FAIL"):
+		return false, reason, amount, nil
+	}
+	return false, "", amount, fmt.Errorf("unexpected verdict %q", truncate(verdict, 50))
+}
+
+// cost prices a reply. Costs are serialized, since recording one appends
+// to the usage ledger.
+func (r *Runner) cost(provider, model string, usage *models.Usage) float64 {
+	if r.Cost == nil {
+		return 0
+	}
+
+	r.costMu.Lock()
+	defer r.costMu.Unlock()
+
+	// A ledger that cannot be written does not fail the case
+	amount, _ := r.Cost(provider, model, usage)
+	return amount
+}
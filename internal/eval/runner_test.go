@@ -0,0 +1,269 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/providers"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// scriptedProvider answers each request with answer, tracking how many
+// requests are in flight at once
+type scriptedProvider struct {
+	providers.Provider
+	name   string
+	answer func(req models.ChatRequest) (string, error)
+
+	inFlight, maxInFlight atomic.Int32
+}
+
+func (p *scriptedProvider) Name() string         { return p.name }
+func (p *scriptedProvider) DefaultModel() string { return p.name + "-default" }
+
+func (p *scriptedProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	n := p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+	for {
+		m := p.maxInFlight.Load()
+		if n <= m || p.maxInFlight.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	content, err := p.answer(req)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ChatResponse{
+		Content:      content,
+		Usage:        &models.Usage{PromptTokens: 10, CompletionTokens: 2},
+		ProviderName: p.name,
+		ModelName:    req.Model,
+	}, nil
+}
+
+func lookupOf(ps ...*scriptedProvider) func(string) (providers.Provider, error) {
+	return func(name string) (providers.Provider, error) {
+		for _, p := range ps {
+			if p.name == name {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("provider %s not found", name)
+	}
+}
+
+// lastMessage returns the prompt of a request
+func lastMessage(req models.ChatRequest) string {
+	return req.Messages[len(req.Messages)-1].Content
+}
+
+func testSuite(t *testing.T) *Suite {
+	t.Helper()
+
+	suite := &Suite{
+		Name:   "arithmetic",
+		System: "Answer with a number.",
+		Cases: []Case{
+			{Name: "add", Prompt: "2+2?", Expected: "4"},
+			{Name: "mul", Prompt: "3*3?", Expected: "9"},
+			{Name: "sub", Prompt: "5-1?", Assert: []Assertion{{Regex: `^\d+$`}}},
+		},
+	}
+	if err := suite.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return suite
+}
+
+func TestRunnerMatrix(t *testing.T) {
+	good := &scriptedProvider{name: "good", answer: func(req models.ChatRequest) (string, error) {
+		if req.Messages[0].Role != models.RoleSystem {
+			return "", fmt.Errorf("no system prompt")
+		}
+		return map[string]string{"2+2?": "4", "3*3?": "9", "5-1?": "4"}[lastMessage(req)], nil
+	}}
+	bad := &scriptedProvider{name: "bad", answer: func(req models.ChatRequest) (string, error) {
+		if lastMessage(req) == "5-1?" {
+			return "", &providers.Error{Provider: "bad", Class: providers.ClassRateLimited, Err: fmt.Errorf("slow down")}
+		}
+		return "four", nil
+	}}
+
+	var reported atomic.Int32
+	runner := &Runner{
+		Lookup:      lookupOf(good, bad),
+		Targets:     providers.ParseRoutes([]string{"good:big", "bad"}),
+		Concurrency: 2,
+		Cost: func(provider, model string, usage *models.Usage) (float64, error) {
+			return 0.5, nil
+		},
+		OnResult: func(CaseResult) { reported.Add(1) },
+	}
+
+	report, err := runner.Run(context.Background(), testSuite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Results) != 6 || reported.Load() != 6 {
+		t.Fatalf("got %d results, %d reported, want 6", len(report.Results), reported.Load())
+	}
+	if r := report.Results[1]; r.Case != "add" || r.Target != "bad" || r.Model != "bad-default" || r.Passed {
+		t.Errorf("second result = %+v, want add on bad failing", r)
+	}
+	if r := report.Results[5]; r.ErrorClass != "rate_limited" || r.Passed {
+		t.Errorf("last result = %+v, want a rate_limited error", r)
+	}
+	if max := max(good.maxInFlight.Load(), bad.maxInFlight.Load()); max > 2 {
+		t.Errorf("%d requests in flight, want at most 2", max)
+	}
+
+	want := []TargetSummary{
+		{Target: "good:big", Cases: 3, Passed: 3, PassRate: 1, Cost: 1.5},
+		{Target: "bad", Cases: 3, Failed: 3, Errors: 1, Cost: 1},
+	}
+	for i, w := range want {
+		got := report.Targets[i]
+		got.AvgLatencyMS = 0
+		if got != w {
+			t.Errorf("summary %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if report.Failed() != 3 || report.Cost() != 2.5 {
+		t.Errorf("failed = %d, cost = %v", report.Failed(), report.Cost())
+	}
+
+	var junit bytes.Buffer
+	if err := report.WriteJUnit(&junit); err != nil {
+		t.Fatal(err)
+	}
+	var doc junitSuites
+	if err := xml.Unmarshal(junit.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JUnit XML: %v\n%s", err, junit.String())
+	}
+	if doc.Tests != 6 || doc.Failures != 2 || doc.Errors != 1 || len(doc.Suites) != 2 {
+		t.Errorf("JUnit totals = %d tests, %d failures, %d errors, %d suites", doc.Tests, doc.Failures, doc.Errors, len(doc.Suites))
+	}
+	if f := doc.Suites[1].Cases[0].Failure; f == nil || !strings.Contains(f.Message, `want "4"`) {
+		t.Errorf("failure of add on bad = %+v", f)
+	}
+
+	var table bytes.Buffer
+	report.WriteTable(&table)
+	if !strings.Contains(table.String(), "FAIL sub on bad: ") || !strings.Contains(table.String(), "3 of 6 passed") {
+		t.Errorf("table =\n%s", table.String())
+	}
+}
+
+func TestRunnerJudge(t *testing.T) {
+	target := &scriptedProvider{name: "target", answer: func(models.ChatRequest) (string, error) {
+		return "Roses are red", nil
+	}}
+	judge := &scriptedProvider{name: "judge", answer: func(req models.ChatRequest) (string, error) {
+		if strings.Contains(lastMessage(req), "a poem") {
+			return "**PASS**\nIt rhymes well enough.", nil
+		}
+		return "FAIL\nNot about the sea.", nil
+	}}
+
+	suite := &Suite{Cases: []Case{
+		{Name: "poem", Prompt: "Write a poem", Assert: []Assertion{{Rubric: "It is a poem"}}},
+		{Name: "sea", Prompt: "Write about the sea", Assert: []Assertion{{Rubric: "It is about the sea"}}},
+	}}
+	if err := suite.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &Runner{Lookup: lookupOf(target, judge), Targets: []providers.Route{{Provider: "target"}}}
+	if _, err := runner.Run(context.Background(), suite); err == nil || !strings.Contains(err.Error(), "no judge") {
+		t.Fatalf("error = %v, want one asking for a judge", err)
+	}
+
+	runner.Judge = &providers.Route{Provider: "judge", Model: "strict"}
+	runner.Cost = func(provider, model string, usage *models.Usage) (float64, error) {
+		if provider == "judge" {
+			return 0.25, nil
+		}
+		return 0, nil
+	}
+
+	report, err := runner.Run(context.Background(), suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Results[0].Passed || report.Results[0].Assertions[0].Message != "It rhymes well enough." {
+		t.Errorf("poem = %+v", report.Results[0])
+	}
+	if report.Results[1].Passed || report.Results[1].Assertions[0].Message != "Not about the sea." {
+		t.Errorf("sea = %+v", report.Results[1])
+	}
+	if report.JudgeCost != 0.5 {
+		t.Errorf("judge cost = %v, want 0.5", report.JudgeCost)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	live := &scriptedProvider{name: "live", answer: func(req models.ChatRequest) (string, error) {
+		return map[string]string{"2+2?": "4", "3*3?": "9", "5-1?": "4"}[lastMessage(req)], nil
+	}}
+
+	recording := NewRecording()
+	runner := &Runner{
+		Lookup: func(name string) (providers.Provider, error) {
+			p, err := lookupOf(live)(name)
+			if err != nil {
+				return nil, err
+			}
+			return recording.Record(p), nil
+		},
+		Targets: providers.ParseRoutes([]string{"live", "live:big"}),
+	}
+
+	recorded, err := runner.Run(context.Background(), testSuite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	if err := recording.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner.Lookup = loaded.Replay
+	replayed, err := runner.Run(context.Background(), testSuite(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, r := range replayed.Results {
+		want := recorded.Results[i]
+		if r.Response != want.Response || r.Passed != want.Passed || r.Model != want.Model || r.Usage == nil {
+			t.Errorf("replayed %s on %s = %+v, recorded %+v", r.Case, r.Target, r, want)
+		}
+	}
+
+	// A request that was never recorded fails rather than calling out
+	suite := testSuite(t)
+	suite.System = "Answer in words."
+	replayed, err = runner.Run(context.Background(), suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := replayed.Results[0]; r.Passed || !strings.Contains(r.Error, "no recorded reply") {
+		t.Errorf("unrecorded request = %+v", r)
+	}
+}
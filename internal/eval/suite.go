@@ -0,0 +1,201 @@
+// Package eval runs suites of prompts with expected outputs against a
+// matrix of providers and models, and reports how many replies passed.
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of cases run against every target. Targets and Judge
+// are written as "provider" or "provider:model" and may be replaced on
+// the command line.
+type Suite struct {
+	Name        string   `yaml:"name"`
+	System      string   `yaml:"system"`
+	Targets     []string `yaml:"targets"`
+	Judge       string   `yaml:"judge"` // grades rubric assertions
+	Temperature *float64 `yaml:"temperature"`
+	Cases       []Case   `yaml:"cases"`
+}
+
+// Case is a prompt and the assertions its reply must pass. Expected is
+// shorthand for an equals assertion.
+type Case struct {
+	Name     string      `yaml:"name" json:"name"`
+	Prompt   string      `yaml:"prompt" json:"prompt"`
+	System   string      `yaml:"system" json:"system"` // replaces the suite's
+	Expected string      `yaml:"expected" json:"expected"`
+	Assert   []Assertion `yaml:"assert" json:"assert"`
+}
+
+// Assertion checks a reply. Exactly one of its checks is set.
+type Assertion struct {
+	Contains   string         `yaml:"contains" json:"contains"`
+	Regex      string         `yaml:"regex" json:"regex"`
+	Equals     string         `yaml:"equals" json:"equals"` // the whole reply, ignoring surrounding space
+	JSONSchema map[string]any `yaml:"json_schema" json:"json_schema"`
+	Rubric     string         `yaml:"rubric" json:"rubric"` // graded by the judge model
+	IgnoreCase bool           `yaml:"ignore_case" json:"ignore_case"`
+
+	regex *regexp.Regexp
+}
+
+// Assertion types, as reported in results
+const (
+	TypeContains   = "contains"
+	TypeRegex      = "regex"
+	TypeEquals     = "equals"
+	TypeJSONSchema = "json_schema"
+	TypeRubric     = "rubric"
+)
+
+// Type returns which check the assertion makes, or "" if it sets none
+func (a *Assertion) Type() string {
+	switch {
+	case a.Contains != "":
+		return TypeContains
+	case a.Regex != "":
+		return TypeRegex
+	case a.Equals != "":
+		return TypeEquals
+	case a.JSONSchema != nil:
+		return TypeJSONSchema
+	case a.Rubric != "":
+		return TypeRubric
+	}
+	return ""
+}
+
+// Load reads a suite from a YAML file, or from a JSONL file of cases, one
+// per line, named after the file
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+
+	var suite *Suite
+	if filepath.Ext(path) == ".jsonl" {
+		suite, err = parseJSONL(data)
+	} else {
+		suite = &Suite{}
+		err = yaml.Unmarshal(data, suite)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid suite %s: %w", path, err)
+	}
+
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := suite.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid suite %s: %w", path, err)
+	}
+	return suite, nil
+}
+
+// parseJSONL reads one case per non-empty line
+func parseJSONL(data []byte) (*Suite, error) {
+	suite := &Suite{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var c Case
+		if err := json.Unmarshal(text, &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	return suite, scanner.Err()
+}
+
+// Validate checks that every case has a prompt and well-formed
+// assertions, naming unnamed cases by their position
+func (s *Suite) Validate() error {
+	if len(s.Cases) == 0 {
+		return fmt.Errorf("no cases")
+	}
+
+	seen := make(map[string]bool)
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case-%d", i+1)
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("case %s is defined twice", c.Name)
+		}
+		seen[c.Name] = true
+
+		if strings.TrimSpace(c.Prompt) == "" {
+			return fmt.Errorf("case %s has no prompt", c.Name)
+		}
+		if c.Expected != "" {
+			c.Assert = append(c.Assert, Assertion{Equals: c.Expected})
+			c.Expected = ""
+		}
+		if len(c.Assert) == 0 {
+			return fmt.Errorf("case %s has no assertions", c.Name)
+		}
+
+		for j := range c.Assert {
+			if err := c.Assert[j].compile(); err != nil {
+				return fmt.Errorf("case %s, assertion %d: %w", c.Name, j+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// UsesJudge reports whether any case has a rubric assertion
+func (s *Suite) UsesJudge() bool {
+	for _, c := range s.Cases {
+		for _, a := range c.Assert {
+			if a.Rubric != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compile checks that exactly one check is set and prepares it
+func (a *Assertion) compile() error {
+	set := 0
+	for _, isSet := range []bool{a.Contains != "", a.Regex != "", a.Equals != "", a.JSONSchema != nil, a.Rubric != ""} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("set exactly one of contains, regex, equals, json_schema or rubric")
+	}
+
+	if a.Regex != "" {
+		pattern := a.Regex
+		if a.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		a.regex = re
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package history
+
+import (
+	"slices"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// KindComparison marks a conversation recording a comparison: the same
+// prompt answered by several providers and models, one branch per answer
+const KindComparison = "comparison"
+
+// NewComparison returns a comparison as a conversation. The prompt
+// messages are shared by every branch; branch i is named names[i] and ends
+// with replies[i]. The first branch is checked out and gives the
+// conversation its provider and model.
+func NewComparison(id string, prompt []models.Message, names []string, replies []models.Message) Conversation {
+	t := newTree(names[0])
+	for i, reply := range replies {
+		if i > 0 {
+			t.Fork(names[i], prompt[len(prompt)-1].ID)
+		}
+
+		path := append(slices.Clone(prompt), reply)
+		t.Commit(path)
+
+		// Later branches share the prompt as committed
+		prompt = path[:len(path)-1]
+	}
+	t.Checkout(names[0])
+
+	conv := Conversation{
+		ID:        id,
+		Kind:      KindComparison,
+		Provider:  replies[0].Provider,
+		Model:     replies[0].Model,
+		Messages:  t.Messages(),
+		Branches:  t.Branches(),
+		Branch:    t.Current(),
+		StartTime: prompt[len(prompt)-1].Timestamp,
+		EndTime:   time.Now(),
+	}
+	if usage := models.TotalUsage(replies); usage != nil {
+		conv.Usage = usage
+		conv.TokensUsed = usage.Total()
+	}
+	for _, reply := range replies {
+		conv.Cost += reply.Cost
+	}
+
+	return conv
+}
@@ -1,6 +1,8 @@
 package history
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -11,79 +13,126 @@ import (
 	"github.com/soyomarvaldezg/llm-chat/pkg/models"
 )
 
-// Conversation represents a single chat conversation
+// Conversation represents a single chat conversation. Messages holds
+// every message of the conversation tree (see Tree), parents before
+// children; Branches names the lines through it and Branch the one that
+// was checked out.
 type Conversation struct {
 	ID         string           `json:"id"`
 	Provider   string           `json:"provider"`
 	Model      string           `json:"model"`
 	Messages   []models.Message `json:"messages"`
+	Branches   []Branch         `json:"branches,omitempty"`
+	Branch     string           `json:"branch,omitempty"`
 	StartTime  time.Time        `json:"start_time"`
 	EndTime    time.Time        `json:"end_time"`
 	TokensUsed int              `json:"tokens_used,omitempty"`
+	Usage      *models.Usage    `json:"usage,omitempty"`
+	Cost       float64          `json:"cost,omitempty"`
 	Summary    string           `json:"summary,omitempty"`
+	Tags       []string         `json:"tags,omitempty"`
+	Persona    string           `json:"persona,omitempty"`
+	Kind       string           `json:"kind,omitempty"` // empty for a chat, or KindComparison
+}
+
+// Config controls where history is stored and how much of it is kept
+type Config struct {
+	// Path is the history file. If it names a directory (an existing one, or
+	// any path ending in a separator), each project gets its own file inside it.
+	Path string
+
+	// Backend selects the storage format: "jsonl" (default) or "sqlite"
+	Backend string
+
+	// Retention limits; zero values disable the corresponding limit
+	MaxConversations int
+	MaxAge           time.Duration
+	MaxSize          int64
+
+	// Archive appends pruned conversations to a compressed side file
+	// instead of discarding them
+	Archive bool
 }
 
 // Manager handles conversation history
 type Manager struct {
-	historyPath   string
+	config        Config
+	store         Store
 	conversations []Conversation
+
+	// index is built on first search and dropped whenever history changes
+	index *searchIndex
 }
 
 // NewManager creates a new history manager
-func NewManager() (*Manager, error) {
-	homeDir, err := os.UserHomeDir()
+func NewManager(cfg Config) (*Manager, error) {
+	historyPath, err := resolvePath(cfg.Path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return nil, err
 	}
 
-	historyDir := filepath.Join(homeDir, ".llm-chat")
-	if err := os.MkdirAll(historyDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create history directory: %w", err)
 	}
 
-	historyPath := filepath.Join(historyDir, "history.json")
+	store, err := OpenStore(cfg.Backend, historyPath)
+	if err != nil {
+		return nil, err
+	}
 
 	manager := &Manager{
-		historyPath:   historyPath,
+		config:        cfg,
+		store:         store,
 		conversations: make([]Conversation, 0),
 	}
 
 	// Load existing history
 	if err := manager.Load(); err != nil {
-		// If file doesn't exist, that's okay
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
+		store.Close()
+		return nil, err
 	}
 
 	return manager, nil
 }
 
-// Load reads history from disk
+// Path returns the file the history is stored in
+func (m *Manager) Path() string {
+	return m.store.Path()
+}
+
+// Close releases the underlying store
+func (m *Manager) Close() error {
+	return m.store.Close()
+}
+
+// Load reads history from the store, picking up conversations saved by
+// other sessions since the last load
 func (m *Manager) Load() error {
-	data, err := os.ReadFile(m.historyPath)
+	conversations, err := m.store.Load()
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, &m.conversations)
+	m.conversations = conversations
+	m.index = nil
+	return nil
 }
 
-// Save writes history to disk
-func (m *Manager) Save() error {
-	data, err := json.MarshalIndent(m.conversations, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal history: %w", err)
-	}
-
-	return os.WriteFile(m.historyPath, data, 0644)
+// NewID returns a new conversation ID. The time in nanoseconds keeps IDs in
+// order, and the random suffix keeps conversations started at the same
+// moment, such as by parallel shell commands, from replacing each other.
+func NewID() string {
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	return fmt.Sprintf("conv_%d_%s", time.Now().UnixNano(), hex.EncodeToString(suffix[:]))
 }
 
-// AddConversation adds a new conversation to history
+// AddConversation saves a conversation, replacing any saved conversation
+// with the same ID, and applies the retention policy
 func (m *Manager) AddConversation(conv Conversation) error {
 	// Generate ID if not set
 	if conv.ID == "" {
-		conv.ID = fmt.Sprintf("conv_%d", time.Now().Unix())
+		conv.ID = NewID()
 	}
 
 	// Set end time if not set
@@ -91,8 +140,22 @@ func (m *Manager) AddConversation(conv Conversation) error {
 		conv.EndTime = time.Now()
 	}
 
+	if err := m.store.Put(conv); err != nil {
+		return err
+	}
+
+	// The most recently saved conversation always sorts last
+	for i := range m.conversations {
+		if m.conversations[i].ID == conv.ID {
+			m.conversations = append(m.conversations[:i], m.conversations[i+1:]...)
+			break
+		}
+	}
 	m.conversations = append(m.conversations, conv)
-	return m.Save()
+	m.index = nil
+
+	_, err := m.prune(time.Now())
+	return err
 }
 
 // GetAll returns all conversations
@@ -110,98 +173,207 @@ func (m *Manager) GetRecent(n int) []Conversation {
 	return m.conversations[start:]
 }
 
-// Search finds conversations containing the query string
-func (m *Manager) Search(query string) []Conversation {
-	query = strings.ToLower(query)
-	results := make([]Conversation, 0)
+// Search runs a query (see ParseQuery) against the history and returns
+// matching conversations ranked by relevance
+func (m *Manager) Search(query string) ([]SearchResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, conv := range m.conversations {
-		// Search in messages
-		for _, msg := range conv.Messages {
-			if strings.Contains(strings.ToLower(msg.Content), query) {
-				results = append(results, conv)
-				break
-			}
-		}
+	if m.index == nil {
+		m.index = buildIndex(m.conversations)
 	}
 
-	return results
+	return m.index.search(q), nil
+}
+
+// SetTags replaces the tags of a saved conversation
+func (m *Manager) SetTags(convID string, tags []string) error {
+	conv, err := m.Get(convID)
+	if err != nil {
+		return err
+	}
+
+	updated := *conv
+	updated.Tags = tags
+	return m.AddConversation(updated)
 }
 
 // Clear removes all history
 func (m *Manager) Clear() error {
+	if err := m.Load(); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(m.conversations))
+	for i, conv := range m.conversations {
+		ids[i] = conv.ID
+	}
+
+	if err := m.store.Delete(ids...); err != nil {
+		return err
+	}
+
 	m.conversations = make([]Conversation, 0)
-	return m.Save()
+	m.index = nil
+	return nil
 }
 
-// Export exports conversation to a file
-func (m *Manager) Export(convID string, format string) (string, error) {
-	// Find conversation
-	var conv *Conversation
+// Get returns the conversation with the given ID
+func (m *Manager) Get(convID string) (*Conversation, error) {
 	for i := range m.conversations {
 		if m.conversations[i].ID == convID {
-			conv = &m.conversations[i]
-			break
+			return &m.conversations[i], nil
 		}
 	}
 
-	if conv == nil {
-		return "", fmt.Errorf("conversation not found: %s", convID)
+	return nil, fmt.Errorf("conversation not found: %s", convID)
+}
+
+// Find returns the conversation whose ID is id or, failing that, the only
+// conversation whose ID starts with id
+func (m *Manager) Find(id string) (*Conversation, error) {
+	if conv, err := m.Get(id); err == nil {
+		return conv, nil
 	}
 
-	var content string
-	var extension string
+	var match *Conversation
+	for i := range m.conversations {
+		if strings.HasPrefix(m.conversations[i].ID, id) {
+			if match != nil {
+				return nil, fmt.Errorf("conversation ID %q is ambiguous", id)
+			}
+			match = &m.conversations[i]
+		}
+	}
 
+	if match == nil {
+		return nil, fmt.Errorf("conversation not found: %s", id)
+	}
+
+	return match, nil
+}
+
+// Latest returns the most recently saved conversation
+func (m *Manager) Latest() (*Conversation, error) {
+	if len(m.conversations) == 0 {
+		return nil, fmt.Errorf("no saved conversations")
+	}
+
+	return &m.conversations[len(m.conversations)-1], nil
+}
+
+// Export exports conversation to a file
+func (m *Manager) Export(convID string, format string) (string, error) {
+	conv, err := m.Get(convID)
+	if err != nil {
+		return "", err
+	}
+
+	content, extension, err := m.Render(conv, format)
+	if err != nil {
+		return "", err
+	}
+
+	// Create filename
+	filename := fmt.Sprintf("conversation_%s%s", conv.ID, extension)
+	filePath := filepath.Join(os.TempDir(), filename)
+
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+
+	return filePath, nil
+}
+
+// Render formats a conversation as markdown, json or txt and returns the
+// content along with the matching file extension
+func (m *Manager) Render(conv *Conversation, format string) (string, string, error) {
 	switch format {
 	case "markdown":
-		content = m.exportMarkdown(conv)
-		extension = ".md"
+		return m.exportMarkdown(conv), ".md", nil
 	case "json":
 		data, err := json.MarshalIndent(conv, "", "  ")
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
-		content = string(data)
-		extension = ".json"
+		return string(data), ".json", nil
 	case "txt":
-		content = m.exportText(conv)
-		extension = ".txt"
+		return m.exportText(conv), ".txt", nil
 	default:
-		return "", fmt.Errorf("unsupported format: %s", format)
+		return "", "", fmt.Errorf("unsupported format: %s", format)
 	}
+}
 
-	// Create filename
-	filename := fmt.Sprintf("conversation_%s%s", conv.ID, extension)
-	filePath := filepath.Join(os.TempDir(), filename)
+// branchSection is part of a conversation as exported: the checked-out
+// branch in full, or another branch from the point where it leaves it
+type branchSection struct {
+	name     string
+	fork     int // messages shared with the checked-out branch
+	messages []models.Message
+}
 
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
-		return "", fmt.Errorf("failed to write export: %w", err)
+// branchSections returns the checked-out branch of a conversation followed
+// by the other branches
+func branchSections(conv *Conversation) []branchSection {
+	tree := conv.Tree()
+	current, _ := tree.Path(tree.Current())
+	sections := []branchSection{{name: tree.Current(), messages: current}}
+
+	for _, b := range tree.Branches() {
+		if b.Name == tree.Current() {
+			continue
+		}
+		path, _ := tree.Path(b.Name)
+		fork := Divergence(current, path)
+		sections = append(sections, branchSection{name: b.Name, fork: fork, messages: path[fork:]})
 	}
 
-	return filePath, nil
+	return sections
 }
 
 // exportMarkdown exports conversation as markdown
 func (m *Manager) exportMarkdown(conv *Conversation) string {
 	var sb strings.Builder
 
+	sections := branchSections(conv)
+
 	sb.WriteString(fmt.Sprintf("# Conversation with %s\n\n", conv.Provider))
 	sb.WriteString(fmt.Sprintf("**Model:** %s\n", conv.Model))
 	sb.WriteString(fmt.Sprintf("**Date:** %s\n", conv.StartTime.Format("2006-01-02 15:04:05")))
+	if len(sections) > 1 {
+		sb.WriteString(fmt.Sprintf("**Branch:** %s (%d others below)\n", sections[0].name, len(sections)-1))
+	}
 	sb.WriteString(fmt.Sprintf("**Duration:** %s\n\n", conv.EndTime.Sub(conv.StartTime).Round(time.Second)))
 	sb.WriteString("---\n\n")
 
-	for _, msg := range conv.Messages {
-		role := "User"
-		if msg.Role == models.RoleAssistant {
-			role = "Assistant"
-		} else if msg.Role == models.RoleSystem {
-			role = "System"
+	for i, section := range sections {
+		if i > 0 {
+			sb.WriteString("---\n\n")
+			sb.WriteString(fmt.Sprintf("# Branch: %s\n\n", section.name))
+			sb.WriteString(fmt.Sprintf("*Continues from message %d of %s*\n\n", section.fork, sections[0].name))
 		}
 
-		sb.WriteString(fmt.Sprintf("## %s\n\n", role))
-		sb.WriteString(msg.Content)
-		sb.WriteString("\n\n")
+		for _, msg := range section.messages {
+			role := "User"
+			if msg.Role == models.RoleAssistant {
+				role = "Assistant"
+			} else if msg.Role == models.RoleSystem {
+				role = "System"
+			}
+
+			if msg.Provider != "" {
+				role += fmt.Sprintf(" (%s/%s)", msg.Provider, msg.Model)
+			}
+
+			sb.WriteString(fmt.Sprintf("## %s\n\n", role))
+			sb.WriteString(msg.Content)
+			if msg.Interrupted {
+				sb.WriteString("\n\n*[interrupted]*")
+			}
+			sb.WriteString("\n\n")
+		}
 	}
 
 	return sb.String()
@@ -211,22 +383,43 @@ func (m *Manager) exportMarkdown(conv *Conversation) string {
 func (m *Manager) exportText(conv *Conversation) string {
 	var sb strings.Builder
 
+	sections := branchSections(conv)
+
 	sb.WriteString(fmt.Sprintf("Conversation with %s (%s)\n", conv.Provider, conv.Model))
 	sb.WriteString(fmt.Sprintf("Date: %s\n", conv.StartTime.Format("2006-01-02 15:04:05")))
+	if len(sections) > 1 {
+		sb.WriteString(fmt.Sprintf("Branch: %s (%d others below)\n", sections[0].name, len(sections)-1))
+	}
 	sb.WriteString(strings.Repeat("=", 60))
 	sb.WriteString("\n\n")
 
-	for _, msg := range conv.Messages {
-		role := "You"
-		if msg.Role == models.RoleAssistant {
-			role = "Assistant"
-		} else if msg.Role == models.RoleSystem {
-			role = "System"
+	for i, section := range sections {
+		if i > 0 {
+			sb.WriteString(strings.Repeat("=", 60))
+			sb.WriteString(fmt.Sprintf("\nBranch %s, continuing from message %d of %s\n", section.name, section.fork, sections[0].name))
+			sb.WriteString(strings.Repeat("=", 60))
+			sb.WriteString("\n\n")
 		}
 
-		sb.WriteString(fmt.Sprintf("[%s] %s:\n", msg.Timestamp.Format("15:04:05"), role))
-		sb.WriteString(msg.Content)
-		sb.WriteString("\n\n")
+		for _, msg := range section.messages {
+			role := "You"
+			if msg.Role == models.RoleAssistant {
+				role = "Assistant"
+			} else if msg.Role == models.RoleSystem {
+				role = "System"
+			}
+
+			if msg.Provider != "" {
+				role += fmt.Sprintf(" (%s/%s)", msg.Provider, msg.Model)
+			}
+
+			sb.WriteString(fmt.Sprintf("[%s] %s:\n", msg.Timestamp.Format("15:04:05"), role))
+			sb.WriteString(msg.Content)
+			if msg.Interrupted {
+				sb.WriteString("\n[interrupted]")
+			}
+			sb.WriteString("\n\n")
+		}
 	}
 
 	return sb.String()
@@ -237,17 +430,24 @@ func (m *Manager) GetStats() map[string]interface{} {
 	stats := make(map[string]interface{})
 
 	totalMessages := 0
+	totalBranches := 0
+	totalTokens := 0
 	providerCount := make(map[string]int)
 	modelCount := make(map[string]int)
 
 	for _, conv := range m.conversations {
-		totalMessages += len(conv.Messages)
+		// Count the conversation as it was left, not every branch of it
+		totalMessages += len(conv.Thread())
+		totalBranches += max(len(conv.Branches), 1)
+		totalTokens += conv.TokensUsed
 		providerCount[conv.Provider]++
 		modelCount[conv.Model]++
 	}
 
 	stats["total_conversations"] = len(m.conversations)
 	stats["total_messages"] = totalMessages
+	stats["total_branches"] = totalBranches
+	stats["total_tokens"] = totalTokens
 	stats["providers"] = providerCount
 	stats["models"] = modelCount
 
@@ -0,0 +1,187 @@
+package history
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFileName is used when no history path is configured. The store
+// swaps the extension for its own format.
+const defaultFileName = "history.json"
+
+// resolvePath turns the configured history path into the file to use.
+// Directories get one file per project so that workspaces stay isolated.
+func resolvePath(path string) (string, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".llm-chat", defaultFileName), nil
+	}
+
+	isDir := os.IsPathSeparator(path[len(path)-1])
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		isDir = true
+	}
+
+	if !isDir {
+		return path, nil
+	}
+
+	key, err := projectKey()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(path, key+".json"), nil
+}
+
+// projectKey identifies the current workspace: the enclosing git repository,
+// or the working directory when there is none. The key combines the
+// directory name with a hash of its absolute path.
+func projectKey() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	root := cwd
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			root = dir
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	sum := sha256.Sum256([]byte(root))
+	return fmt.Sprintf("%s-%s", filepath.Base(root), hex.EncodeToString(sum[:4])), nil
+}
+
+// ArchivePath returns the compressed file pruned conversations are moved to
+func (m *Manager) ArchivePath() string {
+	path := m.Path()
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".archive.jsonl.gz"
+}
+
+// Prune reloads the history and applies the retention policy. It returns
+// the number of conversations removed.
+func (m *Manager) Prune() (int, error) {
+	if err := m.Load(); err != nil {
+		return 0, err
+	}
+
+	return m.prune(time.Now())
+}
+
+// prune drops conversations outside the configured count, age and size
+// limits, oldest first, archiving them if enabled
+func (m *Manager) prune(now time.Time) (int, error) {
+	keep, pruned, err := m.applyRetention(m.conversations, now)
+	if err != nil || len(pruned) == 0 {
+		return 0, err
+	}
+
+	if m.config.Archive {
+		if err := appendArchive(m.ArchivePath(), pruned); err != nil {
+			return 0, err
+		}
+	}
+
+	ids := make([]string, len(pruned))
+	for i, conv := range pruned {
+		ids[i] = conv.ID
+	}
+
+	if err := m.store.Delete(ids...); err != nil {
+		return 0, err
+	}
+
+	m.conversations = keep
+	m.index = nil
+	return len(pruned), nil
+}
+
+// applyRetention splits conversations into those kept and those pruned
+func (m *Manager) applyRetention(conversations []Conversation, now time.Time) ([]Conversation, []Conversation, error) {
+	keep := conversations
+	pruned := make([]Conversation, 0)
+
+	if m.config.MaxAge > 0 {
+		cutoff := now.Add(-m.config.MaxAge)
+		fresh := make([]Conversation, 0, len(keep))
+		for _, conv := range keep {
+			if conv.EndTime.Before(cutoff) {
+				pruned = append(pruned, conv)
+			} else {
+				fresh = append(fresh, conv)
+			}
+		}
+		keep = fresh
+	}
+
+	if m.config.MaxConversations > 0 && len(keep) > m.config.MaxConversations {
+		excess := len(keep) - m.config.MaxConversations
+		pruned = append(pruned, keep[:excess]...)
+		keep = keep[excess:]
+	}
+
+	if m.config.MaxSize > 0 {
+		sizes := make([]int64, len(keep))
+		var total int64
+		for i, conv := range keep {
+			data, err := json.Marshal(conv)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to measure conversation %s: %w", conv.ID, err)
+			}
+			sizes[i] = int64(len(data))
+			total += sizes[i]
+		}
+
+		drop := 0
+		for drop < len(keep) && total > m.config.MaxSize {
+			total -= sizes[drop]
+			drop++
+		}
+
+		pruned = append(pruned, keep[:drop]...)
+		keep = keep[drop:]
+	}
+
+	return keep, pruned, nil
+}
+
+// appendArchive writes conversations as a new gzip member at the end of the
+// archive file. Concatenated members form a valid gzip stream of JSON lines.
+func appendArchive(path string, conversations []Conversation) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history archive: %w", err)
+	}
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+	encoder := json.NewEncoder(zw)
+	for _, conv := range conversations {
+		if err := encoder.Encode(conv); err != nil {
+			zw.Close()
+			return fmt.Errorf("failed to archive conversation %s: %w", conv.ID, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write history archive: %w", err)
+	}
+
+	return file.Sync()
+}
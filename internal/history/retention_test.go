@@ -0,0 +1,204 @@
+package history
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// endedAt returns a test conversation that ended at the given time
+func endedAt(id string, end time.Time) Conversation {
+	conv := testConversation(id, id)
+	conv.EndTime = end
+	return conv
+}
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	conversations := []Conversation{
+		endedAt("a", now.Add(-90*24*time.Hour)),
+		endedAt("b", now.Add(-40*24*time.Hour)),
+		endedAt("c", now.Add(-2*24*time.Hour)),
+		endedAt("d", now.Add(-time.Hour)),
+	}
+
+	data, err := json.Marshal(conversations[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+
+	tests := []struct {
+		name         string
+		config       Config
+		keep, pruned string
+	}{
+		{"no limits", Config{}, "a,b,c,d", ""},
+		{"count", Config{MaxConversations: 3}, "b,c,d", "a"},
+		{"count above total", Config{MaxConversations: 10}, "a,b,c,d", ""},
+		{"age", Config{MaxAge: 30 * 24 * time.Hour}, "c,d", "a,b"},
+		{"size exactly", Config{MaxSize: 4 * size}, "a,b,c,d", ""},
+		{"size one byte short", Config{MaxSize: 4*size - 1}, "b,c,d", "a"},
+		{"size below one", Config{MaxSize: 1}, "", "a,b,c,d"},
+		{"age then count", Config{MaxAge: 60 * 24 * time.Hour, MaxConversations: 2}, "c,d", "a,b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{config: tt.config}
+			keep, pruned, err := m.applyRetention(conversations, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids(keep) != tt.keep || ids(pruned) != tt.pruned {
+				t.Errorf("kept %q and pruned %q, want %q and %q", ids(keep), ids(pruned), tt.keep, tt.pruned)
+			}
+		})
+	}
+}
+
+// readArchive returns the conversations in a history archive
+func readArchive(t *testing.T, path string) []Conversation {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conversations []Conversation
+	decoder := json.NewDecoder(zr)
+	for {
+		var conv Conversation
+		if err := decoder.Decode(&conv); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations
+}
+
+func TestPruneArchive(t *testing.T) {
+	for _, archive := range []bool{true, false} {
+		dir := t.TempDir()
+		m, err := NewManager(Config{Path: filepath.Join(dir, "history.json"), MaxConversations: 2, Archive: archive})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Each save prunes, so the archive gets one member per save
+		for _, id := range []string{"a", "b", "c", "d"} {
+			if err := m.AddConversation(testConversation(id, id)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m.Close()
+
+		reopened, err := NewManager(Config{Path: filepath.Join(dir, "history.json")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer reopened.Close()
+		if got := ids(reopened.GetAll()); got != "c,d" {
+			t.Errorf("archive %v: kept %q, want c,d", archive, got)
+		}
+
+		if !archive {
+			if _, err := os.Stat(m.ArchivePath()); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("archive written while disabled: %v", err)
+			}
+			continue
+		}
+
+		archived := readArchive(t, m.ArchivePath())
+		if got := ids(archived); got != "a,b" {
+			t.Errorf("archived %q, want a,b", got)
+		}
+		if len(archived) > 0 && archived[0].Messages[1].Content != "reply to a" {
+			t.Errorf("archived conversation lost its messages: %+v", archived[0])
+		}
+	}
+}
+
+func TestProjectHistory(t *testing.T) {
+	historyDir := t.TempDir() + string(filepath.Separator)
+
+	root := t.TempDir()
+	projects := map[string]string{}
+	for _, name := range []string{"api", "web"} {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Join(dir, ".git"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(dir, "cmd", "server"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		projects[name] = dir
+	}
+
+	open := func(dir string, maxConversations int) *Manager {
+		t.Helper()
+		t.Chdir(dir)
+		m, err := NewManager(Config{Path: historyDir, MaxConversations: maxConversations, Archive: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	web := open(projects["web"], 0)
+	for _, id := range []string{"w1", "w2", "w3"} {
+		if err := web.AddConversation(testConversation(id, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A subdirectory of a repository shares its history
+	api := open(filepath.Join(projects["api"], "cmd", "server"), 1)
+	if filepath.Dir(api.Path()) != filepath.Dir(web.Path()) || api.Path() == web.Path() {
+		t.Fatalf("histories at %s and %s, want separate files in one directory", api.Path(), web.Path())
+	}
+	if again := open(projects["api"], 1); again.Path() != api.Path() {
+		t.Errorf("repository root uses %s, subdirectory %s", again.Path(), api.Path())
+	}
+	if base := filepath.Base(api.Path()); base[:4] != "api-" {
+		t.Errorf("history file %s is not named after the project", base)
+	}
+
+	for _, id := range []string{"a1", "a2", "a3"} {
+		if err := api.AddConversation(testConversation(id, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Pruning one project leaves the others alone
+	if got := ids(api.GetAll()); got != "a3" {
+		t.Errorf("api kept %q, want a3", got)
+	}
+	if got := ids(readArchive(t, api.ArchivePath())); got != "a1,a2" {
+		t.Errorf("api archived %q, want a1,a2", got)
+	}
+	if err := web.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(web.GetAll()); got != "w1,w2,w3" {
+		t.Errorf("web has %q, want w1,w2,w3", got)
+	}
+	if _, err := os.Stat(web.ArchivePath()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("web history was archived: %v", err)
+	}
+}
@@ -0,0 +1,609 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// BM25 tuning parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// SearchResult is a conversation matching a search, with its relevance
+type SearchResult struct {
+	Conversation Conversation
+	Score        float64
+	Snippets     []Snippet
+}
+
+// Snippet is an excerpt of a matching message. Matches holds the byte
+// ranges within Text that matched query terms.
+type Snippet struct {
+	Role    models.Role
+	Text    string
+	Matches [][2]int
+}
+
+// Query is a parsed search query: free-text clauses combined as an OR of
+// ANDs, plus filters that restrict which conversations and messages count
+type Query struct {
+	Clauses  [][]QueryTerm
+	Provider string
+	Model    string
+	Role     models.Role
+	Before   time.Time
+	After    time.Time
+	Tags     []string
+}
+
+// QueryTerm is a single word or a quoted phrase, possibly negated
+type QueryTerm struct {
+	Words   []string
+	Negated bool
+}
+
+// ParseQuery parses the search syntax:
+//
+//	error handling          both words, anywhere in the conversation
+//	"error handling"        the exact phrase
+//	retry OR backoff        either word (AND binds tighter than OR)
+//	-python, NOT python     exclude conversations containing the word
+//	provider:groq model:llama-70b role:assistant tag:work
+//	after:2025-01-01 before:2025-02-01
+func ParseQuery(input string) (*Query, error) {
+	query := &Query{}
+	clause := make([]QueryTerm, 0)
+	negateNext := false
+
+	for _, tok := range lexQuery(input) {
+		if !tok.quoted {
+			switch tok.text {
+			case "OR":
+				if len(clause) > 0 {
+					query.Clauses = append(query.Clauses, clause)
+					clause = make([]QueryTerm, 0)
+				}
+				continue
+			case "AND":
+				continue
+			case "NOT":
+				negateNext = true
+				continue
+			}
+
+			if key, value, ok := strings.Cut(tok.text, ":"); ok && value != "" {
+				handled, err := query.applyFilter(strings.ToLower(key), value)
+				if err != nil {
+					return nil, err
+				}
+				if handled {
+					continue
+				}
+			}
+		}
+
+		words := tokenize(tok.text)
+		if len(words) == 0 {
+			continue
+		}
+
+		term := QueryTerm{Negated: tok.negated || negateNext}
+		for _, w := range words {
+			term.Words = append(term.Words, w.text)
+		}
+		clause = append(clause, term)
+		negateNext = false
+	}
+
+	if len(clause) > 0 {
+		query.Clauses = append(query.Clauses, clause)
+	}
+
+	return query, nil
+}
+
+// applyFilter records a key:value filter, reporting whether key was known
+func (q *Query) applyFilter(key, value string) (bool, error) {
+	switch key {
+	case "provider":
+		q.Provider = strings.ToLower(value)
+	case "model":
+		q.Model = strings.ToLower(value)
+	case "role":
+		q.Role = models.Role(strings.ToLower(value))
+	case "tag":
+		q.Tags = append(q.Tags, strings.ToLower(value))
+	case "before", "after":
+		date, err := parseDate(value)
+		if err != nil {
+			return false, err
+		}
+		if key == "before" {
+			q.Before = date
+		} else {
+			q.After = date
+		}
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// parseDate accepts a date or an RFC 3339 timestamp
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", value)
+}
+
+// queryToken is a raw token of the query string
+type queryToken struct {
+	text    string
+	quoted  bool
+	negated bool
+}
+
+// lexQuery splits a query on whitespace, keeping quoted phrases together
+func lexQuery(input string) []queryToken {
+	tokens := make([]queryToken, 0)
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		negated := false
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			negated = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			tokens = append(tokens, queryToken{text: string(runes[i+1 : end]), quoted: true, negated: negated})
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		tokens = append(tokens, queryToken{text: string(runes[i:end]), negated: negated})
+		i = end
+	}
+
+	return tokens
+}
+
+// token is a normalized word with its byte offsets in the source text
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []token {
+	tokens := make([]token, 0)
+	start := -1
+
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			tokens = append(tokens, token{text: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, token{text: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+
+	return tokens
+}
+
+// posting records where a term occurs in one message
+type posting struct {
+	doc       int
+	positions []int
+}
+
+// indexedMessage locates a message within the indexed conversations
+type indexedMessage struct {
+	conv   int
+	msg    int
+	length int
+}
+
+// searchIndex is an inverted index over every message of every conversation
+type searchIndex struct {
+	conversations []Conversation
+	docs          []indexedMessage
+	postings      map[string][]posting
+}
+
+// buildIndex indexes the given conversations
+func buildIndex(conversations []Conversation) *searchIndex {
+	idx := &searchIndex{
+		conversations: conversations,
+		docs:          make([]indexedMessage, 0),
+		postings:      make(map[string][]posting),
+	}
+
+	for c, conv := range conversations {
+		for m, msg := range conv.Messages {
+			doc := len(idx.docs)
+			tokens := tokenize(msg.Content)
+			idx.docs = append(idx.docs, indexedMessage{conv: c, msg: m, length: len(tokens)})
+
+			positions := make(map[string][]int)
+			for pos, tok := range tokens {
+				positions[tok.text] = append(positions[tok.text], pos)
+			}
+			for term, pos := range positions {
+				idx.postings[term] = append(idx.postings[term], posting{doc: doc, positions: pos})
+			}
+		}
+	}
+
+	return idx
+}
+
+// search evaluates a query and returns matching conversations, best first
+func (idx *searchIndex) search(q *Query) []SearchResult {
+	allowed := make(map[int]bool)
+	for c, conv := range idx.conversations {
+		if q.matchesConversation(conv) {
+			allowed[c] = true
+		}
+	}
+
+	eligible := func(doc int) bool {
+		d := idx.docs[doc]
+		if !allowed[d.conv] {
+			return false
+		}
+		return q.Role == "" || idx.conversations[d.conv].Messages[d.msg].Role == q.Role
+	}
+
+	// Boolean matching at conversation level
+	matched := make(map[int]bool)
+	if len(q.Clauses) == 0 {
+		matched = allowed
+	}
+
+	for _, clause := range q.Clauses {
+		var clauseConvs map[int]bool
+		for _, term := range clause {
+			if term.Negated {
+				continue
+			}
+			convs := idx.termConversations(term, eligible)
+			if clauseConvs == nil {
+				clauseConvs = convs
+			} else {
+				for c := range clauseConvs {
+					if !convs[c] {
+						delete(clauseConvs, c)
+					}
+				}
+			}
+		}
+
+		// A clause made only of exclusions starts from everything allowed
+		if clauseConvs == nil {
+			clauseConvs = make(map[int]bool, len(allowed))
+			for c := range allowed {
+				clauseConvs[c] = true
+			}
+		}
+
+		for _, term := range clause {
+			if term.Negated {
+				for c := range idx.termConversations(term, eligible) {
+					delete(clauseConvs, c)
+				}
+			}
+		}
+
+		for c := range clauseConvs {
+			matched[c] = true
+		}
+	}
+
+	scores := idx.bm25(q, matched, allowed, eligible)
+
+	results := make([]SearchResult, 0, len(matched))
+	for c := range matched {
+		results = append(results, SearchResult{
+			Conversation: idx.conversations[c],
+			Score:        scores[c],
+			Snippets:     idx.snippets(q, c, eligible),
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Conversation.EndTime.After(results[j].Conversation.EndTime)
+	})
+
+	return results
+}
+
+// termConversations returns the conversations where a word or phrase occurs
+// within an eligible message
+func (idx *searchIndex) termConversations(term QueryTerm, eligible func(int) bool) map[int]bool {
+	convs := make(map[int]bool)
+	for _, p := range idx.phrasePostings(term.Words) {
+		if eligible(p.doc) {
+			convs[idx.docs[p.doc].conv] = true
+		}
+	}
+	return convs
+}
+
+// phrasePostings returns postings for messages containing the words in
+// sequence, with positions of the first word
+func (idx *searchIndex) phrasePostings(words []string) []posting {
+	if len(words) == 0 {
+		return nil
+	}
+
+	first := idx.postings[words[0]]
+	if len(words) == 1 {
+		return first
+	}
+
+	result := make([]posting, 0)
+	for _, p := range first {
+		positions := make([]int, 0)
+		for _, start := range p.positions {
+			if idx.hasSequence(p.doc, words[1:], start+1) {
+				positions = append(positions, start)
+			}
+		}
+		if len(positions) > 0 {
+			result = append(result, posting{doc: p.doc, positions: positions})
+		}
+	}
+
+	return result
+}
+
+// hasSequence reports whether words occur in doc starting at position pos
+func (idx *searchIndex) hasSequence(doc int, words []string, pos int) bool {
+	for i, w := range words {
+		found := false
+		for _, p := range idx.postings[w] {
+			if p.doc != doc {
+				continue
+			}
+			for _, position := range p.positions {
+				if position == pos+i {
+					found = true
+					break
+				}
+			}
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// bm25 scores matched conversations, treating each conversation's eligible
+// messages as one document
+func (idx *searchIndex) bm25(q *Query, matched, allowed map[int]bool, eligible func(int) bool) map[int]float64 {
+	scores := make(map[int]float64, len(matched))
+
+	lengths := make(map[int]int)
+	for doc, d := range idx.docs {
+		if eligible(doc) {
+			lengths[d.conv] += d.length
+		}
+	}
+
+	total := 0
+	for _, l := range lengths {
+		total += l
+	}
+	if len(allowed) == 0 || total == 0 {
+		return scores
+	}
+	avgLen := float64(total) / float64(len(allowed))
+	n := float64(len(allowed))
+
+	seen := make(map[string]bool)
+	for _, clause := range q.Clauses {
+		for _, term := range clause {
+			if term.Negated {
+				continue
+			}
+			for _, word := range term.Words {
+				if seen[word] {
+					continue
+				}
+				seen[word] = true
+
+				freqs := make(map[int]int)
+				for _, p := range idx.postings[word] {
+					if eligible(p.doc) {
+						freqs[idx.docs[p.doc].conv] += len(p.positions)
+					}
+				}
+
+				df := float64(len(freqs))
+				idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+				for c, f := range freqs {
+					if !matched[c] {
+						continue
+					}
+					tf := float64(f)
+					norm := 1 - bm25B + bm25B*float64(lengths[c])/avgLen
+					scores[c] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+				}
+			}
+		}
+	}
+
+	return scores
+}
+
+// maxSnippets limits how many excerpts are shown per conversation
+const maxSnippets = 2
+
+// snippets builds highlighted excerpts from the messages with most hits
+func (idx *searchIndex) snippets(q *Query, conv int, eligible func(int) bool) []Snippet {
+	words := make(map[string]bool)
+	for _, clause := range q.Clauses {
+		for _, term := range clause {
+			if !term.Negated {
+				for _, w := range term.Words {
+					words[w] = true
+				}
+			}
+		}
+	}
+
+	type candidate struct {
+		msg  models.Message
+		hits int
+	}
+
+	candidates := make([]candidate, 0)
+	for doc, d := range idx.docs {
+		if d.conv != conv || !eligible(doc) {
+			continue
+		}
+		msg := idx.conversations[conv].Messages[d.msg]
+		hits := 0
+		for _, tok := range tokenize(msg.Content) {
+			if words[tok.text] {
+				hits++
+			}
+		}
+		if hits > 0 || len(words) == 0 {
+			candidates = append(candidates, candidate{msg: msg, hits: hits})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].hits > candidates[j].hits })
+
+	snippets := make([]Snippet, 0, maxSnippets)
+	for _, cand := range candidates {
+		if len(snippets) == maxSnippets {
+			break
+		}
+		snippets = append(snippets, makeSnippet(cand.msg, words))
+	}
+
+	return snippets
+}
+
+// Snippet window size in words around the first match
+const (
+	snippetBefore = 8
+	snippetAfter  = 20
+)
+
+// makeSnippet extracts a window of text around the first matching word
+func makeSnippet(msg models.Message, words map[string]bool) Snippet {
+	tokens := tokenize(msg.Content)
+	if len(tokens) == 0 {
+		return Snippet{Role: msg.Role, Text: strings.TrimSpace(msg.Content)}
+	}
+
+	first := 0
+	for i, tok := range tokens {
+		if words[tok.text] {
+			first = i
+			break
+		}
+	}
+
+	from := max(first-snippetBefore, 0)
+	to := min(first+snippetAfter, len(tokens)-1)
+
+	start, end := 0, len(msg.Content)
+	prefix, suffix := "", ""
+	if from > 0 {
+		start = tokens[from].start
+		prefix = "…"
+	}
+	if to < len(tokens)-1 {
+		end = tokens[to].end
+		suffix = "…"
+	}
+
+	// Newlines become spaces so the excerpt stays on one line; byte
+	// offsets are unchanged because both are a single byte
+	text := prefix + strings.ReplaceAll(msg.Content[start:end], "\n", " ") + suffix
+	trimmed := strings.TrimLeft(text, " ")
+	start += len(text) - len(trimmed)
+	text = strings.TrimRight(trimmed, " ")
+
+	snippet := Snippet{Role: msg.Role, Text: text}
+	for _, tok := range tokens[from : to+1] {
+		if words[tok.text] {
+			offset := len(prefix) - start
+			snippet.Matches = append(snippet.Matches, [2]int{tok.start + offset, tok.end + offset})
+		}
+	}
+
+	return snippet
+}
+
+// matchesConversation applies the conversation-level filters
+func (q *Query) matchesConversation(conv Conversation) bool {
+	if q.Provider != "" && strings.ToLower(conv.Provider) != q.Provider {
+		return false
+	}
+	if q.Model != "" && !strings.Contains(strings.ToLower(conv.Model), q.Model) {
+		return false
+	}
+	if !q.Before.IsZero() && !conv.StartTime.Before(q.Before) {
+		return false
+	}
+	if !q.After.IsZero() && conv.StartTime.Before(q.After) {
+		return false
+	}
+
+	for _, tag := range q.Tags {
+		found := false
+		for _, t := range conv.Tags {
+			if strings.ToLower(t) == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
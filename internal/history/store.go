@@ -0,0 +1,114 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/fsutil"
+)
+
+// Store persists conversations. Implementations must be safe to use from
+// several processes at once.
+type Store interface {
+	// Load returns every stored conversation, least recently saved first
+	Load() ([]Conversation, error)
+
+	// Put saves a conversation, replacing any stored one with the same ID
+	Put(conv Conversation) error
+
+	// Delete removes the conversations with the given IDs
+	Delete(ids ...string) error
+
+	// Path returns the file backing the store
+	Path() string
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Supported storage backends
+const (
+	BackendJSONL  = "jsonl"
+	BackendSQLite = "sqlite"
+)
+
+// lockTimeout bounds how long a store waits for another process
+const lockTimeout = 10 * time.Second
+
+// OpenStore opens the store for the given backend. The backend decides the
+// file extension: "history.json" becomes "history.jsonl" or "history.db".
+// A legacy whole-file JSON history found next to it is migrated once.
+func OpenStore(backend, path string) (Store, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+
+	var (
+		store Store
+		err   error
+	)
+
+	switch backend {
+	case "", BackendJSONL:
+		store, err = NewJSONLStore(base + ".jsonl")
+	case BackendSQLite:
+		store, err = NewSQLiteStore(base + ".db")
+	default:
+		return nil, fmt.Errorf("unknown history backend: %s", backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateLegacy(store, base+".json"); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// migrateLegacy imports a history.json written by earlier versions into the
+// store and renames it so the import only happens once
+func migrateLegacy(store Store, legacyPath string) error {
+	if _, err := os.Stat(legacyPath); err != nil {
+		return nil
+	}
+
+	// The lock file stays in place: removing it would let a process still
+	// waiting on the old file and one locking a new file migrate at once
+	lock, err := fsutil.LockFile(legacyPath+".lock", true, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// Another process may have finished the migration while we waited
+	data, err := os.ReadFile(legacyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read legacy history: %w", err)
+	}
+
+	var conversations []Conversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return fmt.Errorf("failed to parse legacy history %s: %w", legacyPath, err)
+	}
+
+	for _, conv := range conversations {
+		if err := store.Put(conv); err != nil {
+			return fmt.Errorf("failed to migrate conversation %s: %w", conv.ID, err)
+		}
+	}
+
+	if err := os.Rename(legacyPath, legacyPath+".migrated"); err != nil {
+		return fmt.Errorf("failed to retire legacy history: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/fsutil"
+)
+
+// jsonlRecord is one line of the append-only log
+type jsonlRecord struct {
+	Op           string        `json:"op"` // "put" or "delete"
+	ID           string        `json:"id"`
+	Conversation *Conversation `json:"conversation,omitempty"`
+}
+
+// compactSlack is how far the log may grow past twice its size after the
+// last compaction before a save compacts it again
+const compactSlack = 1 << 20
+
+// JSONLStore keeps history as an append-only log of JSON lines. Saving a
+// conversation appends one record, so writes are O(1) and an interrupted
+// write can only damage the final line, which is skipped on load. The log
+// is compacted with an atomic rename once superseded records dominate,
+// checked on open, after deletes and when saves have grown it.
+type JSONLStore struct {
+	path string
+
+	// compactAt is the log size at which a save checks for compaction
+	compactAt atomic.Int64
+}
+
+// NewJSONLStore opens or creates a JSONL store at path
+func NewJSONLStore(path string) (*JSONLStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	file.Close()
+
+	s := &JSONLStore{path: path}
+	if err := s.Compact(false); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Path returns the log file
+func (s *JSONLStore) Path() string {
+	return s.path
+}
+
+// Close is a no-op; the store holds no open files between calls
+func (s *JSONLStore) Close() error {
+	return nil
+}
+
+// Load replays the log and returns the live conversations
+func (s *JSONLStore) Load() ([]Conversation, error) {
+	lock, err := fsutil.LockFile(s.lockPath(), false, lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	conversations, _, err := s.replay()
+	return conversations, err
+}
+
+// Put appends a record saving the conversation
+func (s *JSONLStore) Put(conv Conversation) error {
+	if err := s.append(jsonlRecord{Op: "put", ID: conv.ID, Conversation: &conv}); err != nil {
+		return err
+	}
+
+	// Every save appends the whole conversation, so a long session grows
+	// the log quickly. Compacting each time it doubles keeps saves O(1)
+	// on average.
+	if info, err := os.Stat(s.path); err == nil && info.Size() > s.compactAt.Load() {
+		return s.Compact(true)
+	}
+	return nil
+}
+
+// Delete appends tombstones for the given conversations
+func (s *JSONLStore) Delete(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	records := make([]jsonlRecord, len(ids))
+	for i, id := range ids {
+		records[i] = jsonlRecord{Op: "delete", ID: id}
+	}
+
+	if err := s.append(records...); err != nil {
+		return err
+	}
+
+	return s.Compact(false)
+}
+
+// append writes records to the end of the log under an exclusive lock
+func (s *JSONLStore) append(records ...jsonlRecord) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history record: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	lock, err := fsutil.LockFile(s.lockPath(), true, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	data := buf.Bytes()
+
+	// Start on a fresh line if a previous write was cut short
+	torn, err := s.endsMidLine()
+	if err != nil {
+		return err
+	}
+	if torn {
+		data = append([]byte{'\n'}, data...)
+	}
+
+	if err := fsutil.AppendSync(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to append to history: %w", err)
+	}
+
+	return nil
+}
+
+// replay reads the log and returns the live conversations, ordered by their
+// most recent save, along with the total number of records
+func (s *JSONLStore) replay() ([]Conversation, int, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Conversation{}, 0, nil
+		}
+		return nil, 0, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	type entry struct {
+		conv Conversation
+		seq  int
+	}
+
+	live := make(map[string]entry)
+	records := 0
+
+	reader := bufio.NewReader(file)
+	for seq := 0; ; seq++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record jsonlRecord
+			// A line that fails to parse is the remains of an interrupted write
+			if jsonErr := json.Unmarshal(line, &record); jsonErr == nil {
+				records++
+				switch record.Op {
+				case "put":
+					if record.Conversation != nil {
+						live[record.ID] = entry{conv: *record.Conversation, seq: seq}
+					}
+				case "delete":
+					delete(live, record.ID)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read history: %w", err)
+		}
+	}
+
+	entries := make([]entry, 0, len(live))
+	for _, e := range live {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].seq < entries[j].seq })
+
+	conversations := make([]Conversation, len(entries))
+	for i, e := range entries {
+		conversations[i] = e.conv
+	}
+
+	return conversations, records, nil
+}
+
+// Compact rewrites the log with only the live records, atomically. Unless
+// forced it only does so once at least half of the log is superseded.
+func (s *JSONLStore) Compact(force bool) error {
+	lock, err := fsutil.LockFile(s.lockPath(), true, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	conversations, records, err := s.replay()
+	if err != nil {
+		return err
+	}
+
+	if !force && (records < 64 || records < 2*len(conversations)) {
+		s.updateCompactAt()
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for i := range conversations {
+		data, err := json.Marshal(jsonlRecord{Op: "put", ID: conversations[i].ID, Conversation: &conversations[i]})
+		if err != nil {
+			return fmt.Errorf("failed to marshal history record: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if err := fsutil.WriteFileAtomic(s.path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	s.updateCompactAt()
+	return nil
+}
+
+// updateCompactAt sets the size at which a save next checks for compaction
+// from the current size of the log
+func (s *JSONLStore) updateCompactAt() {
+	if info, err := os.Stat(s.path); err == nil {
+		s.compactAt.Store(2*info.Size() + compactSlack)
+	}
+}
+
+// endsMidLine reports whether the log's last byte is not a newline
+func (s *JSONLStore) endsMidLine() (bool, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+
+	return last[0] != '\n', nil
+}
+
+// lockPath returns the lock file guarding the log
+func (s *JSONLStore) lockPath() string {
+	return s.path + ".lock"
+}
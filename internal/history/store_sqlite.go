@@ -0,0 +1,130 @@
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema creates the conversations table. The full conversation is
+// stored as JSON; the other columns exist for ordering and inspection.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS conversations (
+	id         TEXT PRIMARY KEY,
+	seq        INTEGER NOT NULL,
+	provider   TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time   TIMESTAMP NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS conversations_seq ON conversations (seq);
+`
+
+// SQLiteStore keeps history in a SQLite database. SQLite provides atomic
+// transactions and its own file locking, and WAL mode lets readers proceed
+// while another session writes.
+type SQLiteStore struct {
+	path string
+	db   *sql.DB
+}
+
+// NewSQLiteStore opens or creates a SQLite store at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=%d&_journal_mode=WAL&_synchronous=NORMAL", path, lockTimeout.Milliseconds())
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history database: %w", err)
+	}
+
+	return &SQLiteStore{path: path, db: db}, nil
+}
+
+// Path returns the database file
+func (s *SQLiteStore) Path() string {
+	return s.path
+}
+
+// Close closes the database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Load returns every conversation, least recently saved first
+func (s *SQLiteStore) Load() ([]Conversation, error) {
+	rows, err := s.db.Query(`SELECT data FROM conversations ORDER BY seq`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := make([]Conversation, 0)
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+
+		var conv Conversation
+		if err := json.Unmarshal([]byte(data), &conv); err != nil {
+			return nil, fmt.Errorf("failed to parse stored conversation: %w", err)
+		}
+		conversations = append(conversations, conv)
+	}
+
+	return conversations, rows.Err()
+}
+
+// Put inserts or replaces a conversation in a single transaction
+func (s *SQLiteStore) Put(conv Conversation) error {
+	data, err := json.Marshal(conv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal conversation: %w", err)
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO conversations (id, seq, provider, model, start_time, end_time, data)
+		VALUES (?, (SELECT COALESCE(MAX(seq), 0) + 1 FROM conversations), ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			seq        = excluded.seq,
+			provider   = excluded.provider,
+			model      = excluded.model,
+			start_time = excluded.start_time,
+			end_time   = excluded.end_time,
+			data       = excluded.data`,
+		conv.ID, conv.Provider, conv.Model, conv.StartTime, conv.EndTime, string(data),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes conversations by ID
+func (s *SQLiteStore) Delete(ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	if _, err := s.db.Exec(`DELETE FROM conversations WHERE id IN (`+placeholders+`)`, args...); err != nil {
+		return fmt.Errorf("failed to delete conversations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+var backends = []string{BackendJSONL, BackendSQLite}
+
+// testConversation returns a conversation with one exchange
+func testConversation(id, content string) Conversation {
+	start := time.Date(2026, 1, 5, 10, 0, 0, 0, time.UTC)
+	return Conversation{
+		ID:       id,
+		Provider: "ollama",
+		Model:    "llama3.2",
+		Messages: []models.Message{
+			{Role: models.RoleUser, Content: content, Timestamp: start},
+			{Role: models.RoleAssistant, Content: "reply to " + content, Timestamp: start.Add(time.Second)},
+		},
+		StartTime: start,
+		EndTime:   start.Add(time.Second),
+	}
+}
+
+// ids returns the IDs of conversations in order
+func ids(conversations []Conversation) string {
+	var out []string
+	for _, conv := range conversations {
+		out = append(out, conv.ID)
+	}
+	return strings.Join(out, ",")
+}
+
+// openStore opens a store of backend in dir, closing it when the test ends
+func openStore(t *testing.T, backend, dir string) Store {
+	t.Helper()
+	store, err := OpenStore(backend, filepath.Join(dir, "history.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStore(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			store := openStore(t, backend, dir)
+
+			steps := []struct {
+				name string
+				do   func() error
+				want string
+			}{
+				{"empty", func() error { return nil }, ""},
+				{"put", func() error {
+					for _, id := range []string{"a", "b", "c"} {
+						if err := store.Put(testConversation(id, id)); err != nil {
+							return err
+						}
+					}
+					return nil
+				}, "a,b,c"},
+				{"replace moves to the end", func() error { return store.Put(testConversation("a", "again")) }, "b,c,a"},
+				{"delete", func() error { return store.Delete("b", "missing") }, "c,a"},
+				{"delete nothing", func() error { return store.Delete() }, "c,a"},
+			}
+			for _, step := range steps {
+				if err := step.do(); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				conversations, err := store.Load()
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if got := ids(conversations); got != step.want {
+					t.Errorf("%s: loaded %q, want %q", step.name, got, step.want)
+				}
+			}
+
+			// The saved conversations survive reopening, whole
+			store.Close()
+			conversations, err := openStore(t, backend, dir).Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids(conversations) != "c,a" || conversations[1].Messages[0].Content != "again" {
+				t.Errorf("reopened store has %+v", conversations)
+			}
+		})
+	}
+}
+
+func TestJSONLTornLine(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, BackendJSONL, dir)
+	for _, id := range []string{"a", "b"} {
+		if err := store.Put(testConversation(id, id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A write cut short leaves a partial last line
+	file, err := os.OpenFile(store.Path(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"put","id":"c","conversation":{"id":"c","mess`)
+	file.Close()
+
+	conversations, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(conversations); got != "a,b" {
+		t.Errorf("loaded %q, want the torn record skipped", got)
+	}
+
+	// The next save starts on a line of its own
+	if err := store.Put(testConversation("d", "d")); err != nil {
+		t.Fatal(err)
+	}
+	conversations, err = openStore(t, BackendJSONL, dir).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(conversations); got != "a,b,d" {
+		t.Errorf("loaded %q after a save, want a,b,d", got)
+	}
+}
+
+// logLines returns the number of records in a JSONL log
+func logLines(t *testing.T, path string) int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "\n")
+}
+
+func TestJSONLCompaction(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, BackendJSONL, dir)
+
+	// Saving a conversation after every reply supersedes the earlier saves
+	for i := range 100 {
+		if err := store.Put(testConversation("a", strings.Repeat("x", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Put(testConversation("b", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLines(t, store.Path()); n != 101 {
+		t.Fatalf("log has %d records, want 101 before compacting", n)
+	}
+
+	// Opening the store compacts it
+	reopened := openStore(t, BackendJSONL, dir)
+	if n := logLines(t, store.Path()); n != 2 {
+		t.Errorf("log has %d records after reopening, want 2", n)
+	}
+	conversations, err := reopened.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(conversations) != "a,b" || len(conversations[0].Messages[0].Content) != 99 {
+		t.Errorf("compaction lost data: %+v", conversations)
+	}
+
+	// A session that keeps saving compacts once the log has grown enough
+	big := strings.Repeat("y", 64<<10)
+	for range 64 {
+		if err := reopened.Put(testConversation("c", big)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := int64(3 * compactSlack); info.Size() > max {
+		t.Errorf("log is %d bytes after repeated saves, want at most %d", info.Size(), max)
+	}
+}
+
+// writeLegacy writes a history.json from earlier versions to dir
+func writeLegacy(t *testing.T, dir string, conversations ...Conversation) string {
+	t.Helper()
+	data, err := json.Marshal(conversations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "history.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			legacy := writeLegacy(t, dir, testConversation("old1", "one"), testConversation("old2", "two"))
+
+			conversations, err := openStore(t, backend, dir).Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(conversations); got != "old1,old2" {
+				t.Errorf("migrated %q, want old1,old2", got)
+			}
+			if _, err := os.Stat(legacy + ".migrated"); err != nil {
+				t.Errorf("legacy file not retired: %v", err)
+			}
+			if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+				t.Errorf("legacy file still in place: %v", err)
+			}
+
+			// The import happens once
+			conversations, err = openStore(t, backend, dir).Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(conversations); got != "old1,old2" {
+				t.Errorf("after reopening %q, want old1,old2", got)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	writeLegacy(t, dir, testConversation("old1", "one"), testConversation("old2", "two"))
+
+	// Sessions started at once import the legacy file only once between them
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store, err := OpenStore(BackendJSONL, filepath.Join(dir, "history.json"))
+			if err == nil {
+				store.Close()
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := logLines(t, filepath.Join(dir, "history.jsonl")); n != 2 {
+		t.Errorf("log has %d records, want each legacy conversation imported once", n)
+	}
+}
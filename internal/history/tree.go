@@ -0,0 +1,243 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// DefaultBranch names the branch a conversation starts on
+const DefaultBranch = "main"
+
+// Branch is a named line of a conversation, ending at its head message
+type Branch struct {
+	Name    string    `json:"name"`
+	Head    string    `json:"head,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Tree holds the messages of a conversation linked by parent IDs, and the
+// branches that run through them. One branch is checked out at a time.
+type Tree struct {
+	nodes    []models.Message // parents before children
+	index    map[string]int
+	branches []Branch
+	current  string
+	next     int // number used for the next message ID
+}
+
+// NewTree returns an empty tree with the default branch checked out
+func NewTree() *Tree {
+	return newTree(DefaultBranch)
+}
+
+// newTree returns an empty tree with the named branch checked out
+func newTree(branch string) *Tree {
+	return &Tree{
+		index:    make(map[string]int),
+		branches: []Branch{{Name: branch, Created: time.Now()}},
+		current:  branch,
+		next:     1,
+	}
+}
+
+// Tree returns the message tree of the conversation. Conversations saved
+// before branching existed have no message IDs; they load as a single
+// branch through their messages in order.
+func (c *Conversation) Tree() *Tree {
+	t := NewTree()
+	t.branches = nil
+
+	parent := ""
+	for _, msg := range c.Messages {
+		if msg.ID == "" {
+			msg.ID = t.newID()
+			msg.ParentID = parent
+		} else if n, err := strconv.Atoi(strings.TrimPrefix(msg.ID, "m")); err == nil && n >= t.next {
+			t.next = n + 1
+		}
+		t.put(msg)
+		parent = msg.ID
+	}
+
+	for _, b := range c.Branches {
+		if _, ok := t.index[b.Head]; ok || b.Head == "" {
+			t.branches = append(t.branches, b)
+		}
+	}
+	if len(t.branches) == 0 {
+		t.branches = []Branch{{Name: DefaultBranch, Head: parent, Created: c.StartTime}}
+	}
+
+	t.current = t.branches[0].Name
+	if _, ok := t.find(c.Branch); ok {
+		t.current = c.Branch
+	}
+
+	return t
+}
+
+// Thread returns the messages of the branch that was checked out when the
+// conversation was saved, oldest first
+func (c *Conversation) Thread() []models.Message {
+	t := c.Tree()
+	path, _ := t.Path(t.Current())
+	return path
+}
+
+// Current returns the name of the checked-out branch
+func (t *Tree) Current() string {
+	return t.current
+}
+
+// Branches returns the branches in the order they were created
+func (t *Tree) Branches() []Branch {
+	return append([]Branch{}, t.branches...)
+}
+
+// Messages returns every message on some branch, parents before children
+func (t *Tree) Messages() []models.Message {
+	return append([]models.Message{}, t.nodes...)
+}
+
+// Path returns the messages of a branch, oldest first
+func (t *Tree) Path(name string) ([]models.Message, error) {
+	i, ok := t.find(name)
+	if !ok {
+		return nil, fmt.Errorf("branch not found: %s", name)
+	}
+
+	var path []models.Message
+	for id := t.branches[i].Head; id != ""; {
+		msg := t.nodes[t.index[id]]
+		path = append(path, msg)
+		id = msg.ParentID
+	}
+
+	for l, r := 0, len(path)-1; l < r; l, r = l+1, r-1 {
+		path[l], path[r] = path[r], path[l]
+	}
+	return path, nil
+}
+
+// Commit records path as the checked-out branch, giving IDs to new
+// messages in place. A message whose content or predecessor changed since
+// it was recorded gets a new ID, so branches sharing the old one keep it.
+func (t *Tree) Commit(path []models.Message) {
+	parent := ""
+	for i := range path {
+		msg := &path[i]
+		if j, ok := t.index[msg.ID]; !ok || t.nodes[j].ParentID != parent || t.nodes[j].Content != msg.Content {
+			msg.ID = t.newID()
+		}
+		msg.ParentID = parent
+		t.put(*msg)
+		parent = msg.ID
+	}
+
+	i, _ := t.find(t.current)
+	t.branches[i].Head = parent
+	t.prune()
+}
+
+// Fork creates a branch that ends at the message with the given ID and
+// checks it out. An empty ID starts the branch with no messages.
+func (t *Tree) Fork(name, at string) error {
+	if name == "" {
+		return fmt.Errorf("branch name cannot be empty")
+	}
+	if _, ok := t.find(name); ok {
+		return fmt.Errorf("branch %s already exists", name)
+	}
+	if _, ok := t.index[at]; !ok && at != "" {
+		return fmt.Errorf("message not found: %s", at)
+	}
+
+	t.branches = append(t.branches, Branch{Name: name, Head: at, Created: time.Now()})
+	t.current = name
+	return nil
+}
+
+// Checkout switches to a branch and returns its messages
+func (t *Tree) Checkout(name string) ([]models.Message, error) {
+	path, err := t.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	t.current = name
+	return path, nil
+}
+
+// NextBranchName returns an unused name for a new branch
+func (t *Tree) NextBranchName() string {
+	for n := len(t.branches) + 1; ; n++ {
+		name := fmt.Sprintf("branch-%d", n)
+		if _, ok := t.find(name); !ok {
+			return name
+		}
+	}
+}
+
+// find returns the position of the named branch
+func (t *Tree) find(name string) (int, bool) {
+	for i, b := range t.branches {
+		if b.Name == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// newID returns an ID no message in the tree has
+func (t *Tree) newID() string {
+	id := fmt.Sprintf("m%d", t.next)
+	t.next++
+	return id
+}
+
+// put adds a message, or replaces the one with the same ID
+func (t *Tree) put(msg models.Message) {
+	if i, ok := t.index[msg.ID]; ok {
+		t.nodes[i] = msg
+		return
+	}
+	t.index[msg.ID] = len(t.nodes)
+	t.nodes = append(t.nodes, msg)
+}
+
+// prune drops messages that no branch reaches any more, such as those
+// removed by /undo
+func (t *Tree) prune() {
+	reachable := make(map[string]bool)
+	for _, b := range t.branches {
+		for id := b.Head; id != "" && !reachable[id]; id = t.nodes[t.index[id]].ParentID {
+			reachable[id] = true
+		}
+	}
+
+	kept := t.nodes[:0]
+	for _, msg := range t.nodes {
+		if reachable[msg.ID] {
+			kept = append(kept, msg)
+		}
+	}
+	t.nodes = kept
+
+	t.index = make(map[string]int, len(t.nodes))
+	for i, msg := range t.nodes {
+		t.index[msg.ID] = i
+	}
+}
+
+// Divergence returns how many leading messages two paths share
+func Divergence(a, b []models.Message) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n].ID == b[n].ID {
+		n++
+	}
+	return n
+}
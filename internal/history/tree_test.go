@@ -0,0 +1,220 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// turns returns messages alternating between user and assistant with the
+// given contents
+func turns(contents ...string) []models.Message {
+	messages := make([]models.Message, len(contents))
+	for i, content := range contents {
+		role := models.RoleUser
+		if i%2 == 1 {
+			role = models.RoleAssistant
+		}
+		messages[i] = models.Message{Role: role, Content: content}
+	}
+	return messages
+}
+
+// texts returns the contents of messages joined by commas
+func texts(messages []models.Message) string {
+	out := make([]string, len(messages))
+	for i, msg := range messages {
+		out[i] = msg.Content
+	}
+	return strings.Join(out, ",")
+}
+
+// branchPath returns the contents along a branch of t
+func branchPath(t *testing.T, tree *Tree, name string) string {
+	t.Helper()
+	path, err := tree.Path(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return texts(path)
+}
+
+func TestTreeForkAndCheckout(t *testing.T) {
+	tree := NewTree()
+	main := turns("q1", "a1", "q2", "a2")
+	tree.Commit(main)
+
+	for i, msg := range main {
+		if msg.ID == "" || (i > 0 && msg.ParentID != main[i-1].ID) {
+			t.Fatalf("message %d committed as %+v", i, msg)
+		}
+	}
+
+	// Fork after the first answer and continue differently
+	if err := tree.Fork("retry", main[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Current() != "retry" {
+		t.Errorf("checked out %s after forking, want retry", tree.Current())
+	}
+	path, err := tree.Path("retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree.Commit(append(path, turns("q2b", "a2b")...))
+
+	if got := branchPath(t, tree, "retry"); got != "q1,a1,q2b,a2b" {
+		t.Errorf("retry = %q", got)
+	}
+	if got := branchPath(t, tree, DefaultBranch); got != "q1,a1,q2,a2" {
+		t.Errorf("main = %q", got)
+	}
+	if n := len(tree.Messages()); n != 6 {
+		t.Errorf("tree has %d messages, want the 2 shared ones stored once", n)
+	}
+
+	// Checking out by name returns the branch's messages
+	messages, err := tree.Checkout(DefaultBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if texts(messages) != "q1,a1,q2,a2" || tree.Current() != DefaultBranch {
+		t.Errorf("checkout gave %q on %s", texts(messages), tree.Current())
+	}
+	if Divergence(messages, path) != 2 {
+		t.Errorf("divergence = %d, want 2", Divergence(messages, path))
+	}
+	if _, err := tree.Checkout("missing"); err == nil || tree.Current() != DefaultBranch {
+		t.Errorf("checkout of a missing branch: %v, on %s", err, tree.Current())
+	}
+
+	invalid := []struct{ name, at, want string }{
+		{"", main[0].ID, "empty"},
+		{"retry", main[0].ID, "already exists"},
+		{"other", "m999", "not found"},
+	}
+	for _, tt := range invalid {
+		if err := tree.Fork(tt.name, tt.at); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Fork(%q, %q) = %v, want %q", tt.name, tt.at, err, tt.want)
+		}
+	}
+
+	if name := tree.NextBranchName(); name != "branch-3" {
+		t.Errorf("next branch name = %s", name)
+	}
+}
+
+func TestTreeCommitChanges(t *testing.T) {
+	tree := NewTree()
+	main := turns("q1", "a1", "q2", "a2")
+	tree.Commit(main)
+	if err := tree.Fork("keep", main[3].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Checkout(DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing a shared message gives it and what follows new IDs, so the
+	// other branch keeps the original
+	edited := append([]models.Message{}, main...)
+	edited[2].Content = "q2 edited"
+	tree.Commit(edited)
+
+	if edited[1].ID != main[1].ID || edited[2].ID == main[2].ID || edited[3].ID == main[3].ID {
+		t.Errorf("IDs after editing: %s %s %s, were %s %s %s", edited[1].ID, edited[2].ID, edited[3].ID, main[1].ID, main[2].ID, main[3].ID)
+	}
+	if got := branchPath(t, tree, "keep"); got != "q1,a1,q2,a2" {
+		t.Errorf("keep = %q", got)
+	}
+	if got := branchPath(t, tree, DefaultBranch); got != "q1,a1,q2 edited,a2" {
+		t.Errorf("main = %q", got)
+	}
+}
+
+func TestTreePrune(t *testing.T) {
+	tree := NewTree()
+	main := turns("q1", "a1", "q2", "a2")
+	tree.Commit(main)
+
+	// Dropping the last exchange leaves no branch reaching it
+	tree.Commit(main[:2])
+	if got := texts(tree.Messages()); got != "q1,a1" {
+		t.Errorf("messages after undo = %q", got)
+	}
+
+	// Messages another branch reaches are kept
+	tree.Commit(main)
+	if err := tree.Fork("old", main[3].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Checkout(DefaultBranch); err != nil {
+		t.Fatal(err)
+	}
+	tree.Commit(main[:2])
+	if n := len(tree.Messages()); n != 4 {
+		t.Errorf("tree has %d messages, want the forked ones kept", n)
+	}
+
+	// New IDs are never reused after pruning
+	next := append(append([]models.Message{}, main[:2]...), turns("q3")...)
+	tree.Commit(next)
+	for _, msg := range main {
+		if next[2].ID == msg.ID {
+			t.Errorf("new message reused ID %s", msg.ID)
+		}
+	}
+}
+
+func TestConversationTree(t *testing.T) {
+	// Conversations saved before branching load as a single branch
+	legacy := Conversation{ID: "old", Messages: turns("q1", "a1", "q2")}
+	tree := legacy.Tree()
+	if branches := tree.Branches(); len(branches) != 1 || branches[0].Name != DefaultBranch || tree.Current() != DefaultBranch {
+		t.Fatalf("legacy branches = %+v, current %s", branches, tree.Current())
+	}
+	if got := texts(legacy.Thread()); got != "q1,a1,q2" {
+		t.Errorf("legacy thread = %q", got)
+	}
+	path, _ := tree.Path(DefaultBranch)
+	if path[0].ID == "" || path[1].ParentID != path[0].ID || path[0].ParentID != "" {
+		t.Errorf("legacy messages not linked: %+v", path)
+	}
+
+	// A saved tree loads with its branches and checked-out branch
+	tree.Commit(path)
+	if err := tree.Fork("alt", path[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	alt, _ := tree.Path("alt")
+	tree.Commit(append(alt, models.Message{Role: models.RoleAssistant, Content: "a1b"}))
+
+	saved := Conversation{Messages: tree.Messages(), Branches: tree.Branches(), Branch: tree.Current()}
+	loaded := saved.Tree()
+	if loaded.Current() != "alt" || len(loaded.Branches()) != 2 {
+		t.Fatalf("loaded on %s with %+v", loaded.Current(), loaded.Branches())
+	}
+	if got := texts(saved.Thread()); got != "q1,a1b" {
+		t.Errorf("thread = %q, want the checked-out branch", got)
+	}
+	if got := branchPath(t, loaded, DefaultBranch); got != "q1,a1,q2" {
+		t.Errorf("main = %q", got)
+	}
+
+	// Messages added after loading get fresh IDs
+	thread := saved.Thread()
+	thread = append(thread, turns("q3")...)
+	loaded.Commit(thread)
+	for _, msg := range saved.Messages {
+		if msg.ID == thread[2].ID {
+			t.Errorf("loaded tree reused ID %s", msg.ID)
+		}
+	}
+
+	// A saved branch that no longer exists falls back to the first
+	saved.Branch = "gone"
+	if current := saved.Tree().Current(); current != DefaultBranch {
+		t.Errorf("current = %s for a missing branch", current)
+	}
+}
@@ -0,0 +1,154 @@
+// Package persona manages a library of named system prompts stored as files.
+package persona
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// extensions lists the file types recognized as personas, in lookup order
+var extensions = []string{".md", ".txt"}
+
+// validName restricts persona names to safe file names
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Persona is a named system prompt
+type Persona struct {
+	Name   string
+	Prompt string
+	Path   string
+}
+
+// Library is a directory of persona files, one prompt per file
+type Library struct {
+	dir string
+}
+
+// DefaultDir returns the default persona directory
+func DefaultDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".llm-chat-personas"
+	}
+	return filepath.Join(homeDir, ".llm-chat", "personas")
+}
+
+// NewLibrary creates a library backed by dir, or DefaultDir if dir is empty
+func NewLibrary(dir string) *Library {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Library{dir: dir}
+}
+
+// Dir returns the directory the library reads from
+func (l *Library) Dir() string {
+	return l.dir
+}
+
+// List returns every persona in the library, sorted by name. Files that
+// cannot be loaded are left out and reported together in the error, next
+// to the personas that loaded; a nil list means the directory is unreadable.
+func (l *Library) List() ([]Persona, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Persona{}, nil
+		}
+		return nil, fmt.Errorf("failed to read persona directory: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	personas := make([]Persona, 0)
+	var errs []error
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+		if !isPersonaFile(ext) || !validName.MatchString(name) || seen[name] {
+			continue
+		}
+
+		seen[name] = true
+		persona, err := l.Load(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		personas = append(personas, *persona)
+	}
+
+	sort.Slice(personas, func(i, j int) bool { return personas[i].Name < personas[j].Name })
+	return personas, errors.Join(errs...)
+}
+
+// Load reads the persona with the given name
+func (l *Library) Load(name string) (*Persona, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid persona name: %s", name)
+	}
+
+	for _, ext := range extensions {
+		path := filepath.Join(l.dir, name+ext)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read persona %s: %w", name, err)
+		}
+
+		prompt := strings.TrimSpace(string(data))
+		if prompt == "" {
+			return nil, fmt.Errorf("persona %s is empty", name)
+		}
+
+		return &Persona{Name: name, Prompt: prompt, Path: path}, nil
+	}
+
+	return nil, fmt.Errorf("persona not found: %s (looked in %s)", name, l.dir)
+}
+
+// Save writes a persona to the library as <name>.md, replacing any
+// existing persona with that name
+func (l *Library) Save(name, prompt string) (*Persona, error) {
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid persona name: %s", name)
+	}
+
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create persona directory: %w", err)
+	}
+
+	path := filepath.Join(l.dir, name+".md")
+	if err := os.WriteFile(path, []byte(strings.TrimSpace(prompt)+"\n"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to save persona: %w", err)
+	}
+
+	// Drop other files for the same name so the new prompt is the one loaded
+	for _, ext := range extensions[1:] {
+		os.Remove(filepath.Join(l.dir, name+ext))
+	}
+
+	return &Persona{Name: name, Prompt: strings.TrimSpace(prompt), Path: path}, nil
+}
+
+// isPersonaFile reports whether ext is a recognized persona extension
+func isPersonaFile(ext string) bool {
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+const (
+	anthropicVersion = "2023-06-01"
+
+	// anthropicMaxTokens is used when the request sets no limit, since the
+	// Messages API requires one
+	anthropicMaxTokens = 4096
+)
+
+var anthropicModels = map[string]string{
+	"sonnet": "claude-sonnet-4-5",
+	"haiku":  "claude-haiku-4-5",
+	"opus":   "claude-opus-4-1",
+}
+
+// AnthropicProvider implements the Provider interface for the Anthropic
+// Messages API
+type AnthropicProvider struct {
+	client      *http.Client
+	apiKey      string
+	baseURL     string
+	model       string
+	temperature float64
+	isAvailable bool
+}
+
+// NewAnthropicProvider creates a new Anthropic provider instance
+func NewAnthropicProvider() *AnthropicProvider {
+	apiKey := config.GetEnv("ANTHROPIC_API_KEY", "")
+	model := config.GetEnv("ANTHROPIC_MODEL", "sonnet")
+
+	return &AnthropicProvider{
+		client:      &http.Client{},
+		apiKey:      apiKey,
+		baseURL:     config.GetEnv("ANTHROPIC_BASE_URL", "https://api.anthropic.com"),
+		model:       resolveModel(anthropicModels, model),
+		isAvailable: apiKey != "",
+	}
+}
+
+func (a *AnthropicProvider) Name() string {
+	return "anthropic"
+}
+
+func (a *AnthropicProvider) Models() []string {
+	models := make([]string, 0, len(anthropicModels))
+	for key := range anthropicModels {
+		models = append(models, key)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (a *AnthropicProvider) DefaultModel() string {
+	return a.model
+}
+
+func (a *AnthropicProvider) Initialize(cfg Config) error {
+	if cfg.Model != "" {
+		a.model = resolveModel(anthropicModels, cfg.Model)
+	}
+	a.temperature = cfg.Temperature
+	if cfg.APIKey != "" {
+		a.apiKey = cfg.APIKey
+		a.isAvailable = true
+	}
+	if cfg.BaseURL != "" {
+		a.baseURL = cfg.BaseURL
+	}
+
+	if !a.isAvailable {
+		return newError(a.Name(), ClassAuth, "anthropic is not configured (set ANTHROPIC_API_KEY)")
+	}
+
+	return nil
+}
+
+func (a *AnthropicProvider) IsAvailable() bool {
+	return a.isAvailable
+}
+
+// anthropicMessage is a conversation turn in the Messages API
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// anthropicRequest is the body of a Messages API call
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float64            `json:"temperature"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+// anthropicUsage reports token counts
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// toModel converts the token counts, returning nil when none were reported
+func (u anthropicUsage) toModel() *models.Usage {
+	if u.InputTokens == 0 && u.OutputTokens == 0 {
+		return nil
+	}
+	return &models.Usage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens}
+}
+
+// anthropicResponse is a complete Messages API response
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string         `json:"stop_reason"`
+	Usage      anthropicUsage `json:"usage"`
+}
+
+// anthropicError is the body of a failed call, and of an SSE error event
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicEvent is one server-sent event of a streaming response. Only the
+// fields used by the event types we handle are declared.
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (a *AnthropicProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	start := time.Now()
+
+	resp, err := a.do(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode anthropic response: %w", err)
+	}
+
+	var content strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			content.WriteString(block.Text)
+		}
+	}
+
+	return &models.ChatResponse{
+		Content:      content.String(),
+		FinishReason: anthropicFinishReason(result.StopReason),
+		TokensUsed:   result.Usage.InputTokens + result.Usage.OutputTokens,
+		Usage:        result.Usage.toModel(),
+		ResponseTime: time.Since(start),
+		ProviderName: a.Name(),
+		ModelName:    a.modelFor(req),
+	}, nil
+}
+
+func (a *AnthropicProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	resp, err := a.do(ctx, req, true)
+	if err != nil {
+		return nil, err
+	}
+
+	chunkChan := make(chan models.StreamChunk, 10)
+
+	go func() {
+		defer close(chunkChan)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		// Input tokens arrive in message_start, output tokens and the stop
+		// reason in message_delta
+		var usage anthropicUsage
+		final := models.StreamChunk{Done: true, ProviderName: a.Name(), ModelName: a.modelFor(req)}
+
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				// Event names are repeated in the data, so "event:" lines
+				// and blank separators can be skipped
+				continue
+			}
+
+			var event anthropicEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+				sendChunk(ctx, chunkChan, models.StreamChunk{Error: fmt.Errorf("invalid anthropic stream event: %w", err), Done: true})
+				return
+			}
+
+			switch event.Type {
+			case "message_start":
+				usage.InputTokens = event.Message.Usage.InputTokens
+			case "message_delta":
+				usage.OutputTokens = event.Usage.OutputTokens
+				final.FinishReason = anthropicFinishReason(event.Delta.StopReason)
+			case "content_block_delta":
+				if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+					if !sendChunk(ctx, chunkChan, models.StreamChunk{Content: event.Delta.Text}) {
+						return
+					}
+				}
+			case "message_stop":
+				final.Usage = usage.toModel()
+				sendChunk(ctx, chunkChan, final)
+				return
+			case "error":
+				sendChunk(ctx, chunkChan, models.StreamChunk{
+					Error: newError(a.Name(), anthropicErrorClass(event.Error.Type, event.Error.Message),
+						"anthropic stream error (%s): %s", event.Error.Type, event.Error.Message),
+					Done: true,
+				})
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			sendChunk(ctx, chunkChan, models.StreamChunk{Error: classify(a.Name(), fmt.Errorf("anthropic stream error: %w", err)), Done: true})
+			return
+		}
+
+		sendChunk(ctx, chunkChan, models.StreamChunk{Error: newError(a.Name(), ClassUnavailable, "anthropic stream ended unexpectedly"), Done: true})
+	}()
+
+	return chunkChan, nil
+}
+
+// modelFor returns the model a request is sent to
+func (a *AnthropicProvider) modelFor(req models.ChatRequest) string {
+	if req.Model != "" {
+		return resolveModel(anthropicModels, req.Model)
+	}
+	return a.model
+}
+
+// do sends a Messages API request and returns the successful response
+func (a *AnthropicProvider) do(ctx context.Context, req models.ChatRequest, stream bool) (*http.Response, error) {
+	system, turns := splitSystem(req.Messages)
+	turns = mergeTurns(turns)
+
+	body := anthropicRequest{
+		Model:     a.modelFor(req),
+		System:    system,
+		Messages:  make([]anthropicMessage, len(turns)),
+		MaxTokens: req.MaxTokens,
+		Stream:    stream,
+	}
+	for i, msg := range turns {
+		body.Messages[i] = anthropicMessage{Role: string(msg.Role), Content: msg.Content}
+	}
+	if body.MaxTokens <= 0 {
+		body.MaxTokens = anthropicMaxTokens
+	}
+
+	// Sent even when zero, which is a valid setting rather than a default.
+	// The Messages API accepts temperatures from 0 to 1.
+	body.Temperature = min(temperature(req, a.temperature), 1.0)
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal anthropic request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(a.baseURL, "/")+"/v1/messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create anthropic request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, classify(a.Name(), fmt.Errorf("anthropic API error: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+		var apiErr anthropicError
+		if json.Unmarshal(raw, &apiErr) == nil && apiErr.Error.Message != "" {
+			err := fmt.Errorf("anthropic API error (%d %s): %s", resp.StatusCode, apiErr.Error.Type, apiErr.Error.Message)
+			return nil, classifyResponse(a.Name(), resp.StatusCode, resp.Header, apiErr.Error.Message, err)
+		}
+		err := fmt.Errorf("anthropic API error (%d): %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+		return nil, classifyResponse(a.Name(), resp.StatusCode, resp.Header, string(raw), err)
+	}
+
+	return resp, nil
+}
+
+// anthropicErrorClass maps the error type of an SSE error event, which
+// comes without a status code, to a class
+func anthropicErrorClass(errType, message string) ErrorClass {
+	switch errType {
+	case "overloaded_error", "api_error":
+		return ClassUnavailable
+	case "rate_limit_error":
+		return ClassRateLimited
+	case "authentication_error", "permission_error":
+		return ClassAuth
+	case "request_too_large":
+		return ClassContextLength
+	default:
+		return statusClass(http.StatusBadRequest, message)
+	}
+}
+
+// anthropicFinishReason maps a stop reason to the OpenAI-style finish
+// reasons used elsewhere
+func anthropicFinishReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	default:
+		return reason
+	}
+}
+
+func GetAnthropicMetadata() Metadata {
+	return Metadata{
+		Name:        "anthropic",
+		DisplayName: "Anthropic",
+		Description: "Claude models via the Messages API",
+		RequiresAPI: true,
+		DefaultURL:  "https://api.anthropic.com",
+		EnvVarKey:   "ANTHROPIC_API_KEY",
+		EnvVarModel: "ANTHROPIC_MODEL",
+		Icon:        "🪶",
+	}
+}
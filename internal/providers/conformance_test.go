@@ -0,0 +1,337 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// These tests check the message translation contract in messages.go
+// against fake servers speaking each provider's wire format.
+
+// conformanceRequest is a conversation with every role, content that must
+// not be trimmed, and consecutive user turns
+var conformanceRequest = models.ChatRequest{
+	Messages: []models.Message{
+		{Role: models.RoleSystem, Content: "You are terse."},
+		{Role: models.RoleUser, Content: "  What is Go?\n"},
+		{Role: models.RoleAssistant, Content: "A programming language."},
+		{Role: models.RoleUser, Content: "Who made it?"},
+		{Role: models.RoleUser, Content: "Answer in one line."},
+	},
+	Temperature: models.Temperature(0.5),
+	MaxTokens:   100,
+}
+
+// wireTurn is a message as it arrived at a fake server
+type wireTurn struct {
+	Role    string
+	Content string
+}
+
+// wireConversation is a conversation as it arrived at a fake server, with
+// the system prompt separate for APIs that have a system field
+type wireConversation struct {
+	System string
+	Turns  []wireTurn
+	Stream bool
+}
+
+// fakeServer records the conversations it receives
+type fakeServer struct {
+	mu       sync.Mutex
+	received []wireConversation
+}
+
+func (f *fakeServer) record(c wireConversation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.received = append(f.received, c)
+}
+
+// conversations returns what arrived for SendMessage and StreamMessage
+func (f *fakeServer) conversations(t *testing.T) (send, stream wireConversation) {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.received) != 2 {
+		t.Fatalf("server received %d requests, want 2", len(f.received))
+	}
+	return f.received[0], f.received[1]
+}
+
+// converse sends the conformance request with SendMessage, then with
+// StreamMessage, and returns both replies
+func converse(t *testing.T, p Provider) (string, string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := p.SendMessage(ctx, conformanceRequest)
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	stream, err := p.StreamMessage(ctx, conformanceRequest)
+	if err != nil {
+		t.Fatalf("StreamMessage: %v", err)
+	}
+	var sb strings.Builder
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("stream: %v", chunk.Error)
+		}
+		sb.WriteString(chunk.Content)
+	}
+	return resp.Content, sb.String()
+}
+
+// checkConversation asserts that both requests carried want, and that the
+// replies arrived whole
+func checkConversation(t *testing.T, f *fakeServer, want wireConversation, sent, streamed string) {
+	t.Helper()
+
+	send, stream := f.conversations(t)
+	if send.Stream || !stream.Stream {
+		t.Errorf("stream flags = %v and %v, want false then true", send.Stream, stream.Stream)
+	}
+	send.Stream, stream.Stream = false, false
+
+	if !reflect.DeepEqual(send, want) {
+		t.Errorf("SendMessage sent\n%+v\nwant\n%+v", send, want)
+	}
+	if !reflect.DeepEqual(stream, send) {
+		t.Errorf("StreamMessage sent\n%+v\nbut SendMessage sent\n%+v", stream, send)
+	}
+
+	if sent != "Go was made at Google." || streamed != sent {
+		t.Errorf("replies = %q and %q", sent, streamed)
+	}
+}
+
+// inPlace is the conformance request as sent by APIs with a system role
+var inPlace = wireConversation{Turns: []wireTurn{
+	{"system", "You are terse."},
+	{"user", "  What is Go?\n"},
+	{"assistant", "A programming language."},
+	{"user", "Who made it?"},
+	{"user", "Answer in one line."},
+}}
+
+func TestOpenAICompatConformance(t *testing.T) {
+	f := &fakeServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []struct{ Role, Content string }
+			Stream   bool
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		c := wireConversation{Stream: body.Stream}
+		for _, m := range body.Messages {
+			c.Turns = append(c.Turns, wireTurn{m.Role, m.Content})
+		}
+		f.record(c)
+
+		if !body.Stream {
+			fmt.Fprint(w, `{"id":"1","object":"chat.completion","model":"m","choices":[{"index":0,"message":{"role":"assistant","content":"Go was made at Google."},"finish_reason":"stop"}],"usage":{"prompt_tokens":20,"completion_tokens":6,"total_tokens":26}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, part := range []string{"Go was made", " at Google."} {
+			fmt.Fprintf(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", part)
+		}
+		fmt.Fprint(w, "data: {\"id\":\"1\",\"object\":\"chat.completion.chunk\",\"model\":\"m\",\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatProvider(OpenAICompatSpec{Name: "local", DefaultModel: "m"})
+	if err := p.Initialize(Config{BaseURL: srv.URL + "/v1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, streamed := converse(t, p)
+	checkConversation(t, f, inPlace, sent, streamed)
+}
+
+func TestOllamaConformance(t *testing.T) {
+	f := &fakeServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/tags" {
+			fmt.Fprint(w, `{"models":[]}`)
+			return
+		}
+
+		var body struct {
+			Messages []struct{ Role, Content string }
+			Stream   *bool
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		c := wireConversation{Stream: body.Stream == nil || *body.Stream}
+		for _, m := range body.Messages {
+			c.Turns = append(c.Turns, wireTurn{m.Role, m.Content})
+		}
+		f.record(c)
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		final := `{"model":"m","message":{"role":"assistant","content":%q},"done":true,"done_reason":"stop","prompt_eval_count":20,"eval_count":6}` + "\n"
+		if !c.Stream {
+			fmt.Fprintf(w, final, "Go was made at Google.")
+			return
+		}
+		fmt.Fprint(w, `{"model":"m","message":{"role":"assistant","content":"Go was made"},"done":false}`+"\n")
+		fmt.Fprintf(w, final, " at Google.")
+	}))
+	defer srv.Close()
+
+	p := NewOllamaProvider()
+	if err := p.Initialize(Config{BaseURL: srv.URL, Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	sent, streamed := converse(t, p)
+	checkConversation(t, f, inPlace, sent, streamed)
+}
+
+func TestGeminiConformance(t *testing.T) {
+	f := &fakeServer{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type content struct {
+			Role  string
+			Parts []struct{ Text string }
+		}
+		var body struct {
+			Contents          []content
+			SystemInstruction *content
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		c := wireConversation{Stream: strings.HasSuffix(r.URL.Path, ":streamGenerateContent")}
+		if body.SystemInstruction != nil {
+			for _, part := range body.SystemInstruction.Parts {
+				c.System += part.Text
+			}
+		}
+		for _, m := range body.Contents {
+			var text strings.Builder
+			for _, part := range m.Parts {
+				text.WriteString(part.Text)
+			}
+			c.Turns = append(c.Turns, wireTurn{m.Role, text.String()})
+		}
+		f.record(c)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !c.Stream {
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"Go was made"},{"text":" at Google."}]},"finishReason":"STOP"}],`)
+			fmt.Fprint(w, `"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":6,"totalTokenCount":26}}`)
+			return
+		}
+		fmt.Fprint(w, `[{"candidates":[{"content":{"role":"model","parts":[{"text":"Go was made"}]}}]},`+"\n")
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":" at Google."}]},"finishReason":"STOP"}],`)
+		fmt.Fprint(w, `"usageMetadata":{"promptTokenCount":20,"candidatesTokenCount":6,"totalTokenCount":26}}]`)
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider()
+	if err := p.Initialize(Config{APIKey: "test", BaseURL: srv.URL, Model: "m"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A separate system instruction, "model" for the assistant and
+	// consecutive user turns merged
+	want := wireConversation{
+		System: "You are terse.",
+		Turns: []wireTurn{
+			{"user", "  What is Go?\n"},
+			{"model", "A programming language."},
+			{"user", "Who made it?\n\nAnswer in one line."},
+		},
+	}
+
+	sent, streamed := converse(t, p)
+	checkConversation(t, f, want, sent, streamed)
+}
+
+func TestGeminiGenerationConfig(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		configs []map[string]any
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			GenerationConfig map[string]any
+			Contents         []json.RawMessage
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		configs = append(configs, body.GenerationConfig)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		if len(body.Contents) == 1 {
+			fmt.Fprint(w, `{"promptFeedback":{"blockReason":"SAFETY"}}`)
+			return
+		}
+		reply := `{"candidates":[{"content":{"role":"model","parts":[{"text":"Go"}]},"finishReason":"MAX_TOKENS"}]}`
+		if strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			reply = "[" + reply + "]"
+		}
+		fmt.Fprint(w, reply)
+	}))
+	defer srv.Close()
+
+	p := NewGeminiProvider()
+	if err := p.Initialize(Config{APIKey: "test", BaseURL: srv.URL, Model: "m", Temperature: 0.2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both calls send the request's temperature, zero included, or the
+	// configured one
+	for _, tt := range temperatureCases {
+		req := conformanceRequest
+		req.Temperature = tt.temperature
+		resp, err := p.SendMessage(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.FinishReason != "length" {
+			t.Errorf("finish reason = %q, want length", resp.FinishReason)
+		}
+		stream, err := p.StreamMessage(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range stream {
+		}
+
+		mu.Lock()
+		for _, config := range configs[len(configs)-2:] {
+			got, ok := config["temperature"].(float64)
+			if !ok || math.Abs(got-tt.want) > 1e-6 || config["maxOutputTokens"] != 100.0 {
+				t.Errorf("temperature %v sent with %v, want %v", tt.temperature, config, tt.want)
+			}
+		}
+		mu.Unlock()
+	}
+
+	// A blocked prompt is a content filter error
+	req := conformanceRequest
+	req.Messages = req.Messages[:2]
+	if _, err := p.SendMessage(context.Background(), req); ClassOf(err) != ClassContentFiltered {
+		t.Errorf("blocked prompt: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorClass says why a provider request failed, so that callers can
+// decide whether to retry, fall back or give up
+type ErrorClass string
+
+const (
+	ClassUnknown         ErrorClass = "unknown"
+	ClassAuth            ErrorClass = "auth"             // missing, invalid or unauthorized API key
+	ClassRateLimited     ErrorClass = "rate_limited"     // too many requests; retryable
+	ClassQuota           ErrorClass = "quota"            // credits or plan limits exhausted
+	ClassContextLength   ErrorClass = "context_length"   // prompt too long for the model
+	ClassContentFiltered ErrorClass = "content_filtered" // blocked by a safety filter
+	ClassUnavailable     ErrorClass = "unavailable"      // server down, overloaded or unreachable; retryable
+	ClassTimeout         ErrorClass = "timeout"          // no answer in time; retryable
+	ClassBadRequest      ErrorClass = "bad_request"      // rejected request, such as an unknown model
+)
+
+// Retryable reports whether a request that failed with the class may
+// succeed if repeated unchanged
+func (c ErrorClass) Retryable() bool {
+	switch c {
+	case ClassRateLimited, ClassUnavailable, ClassTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Error is a classified provider failure. Providers return it, possibly
+// wrapped, for every failure of a request.
+type Error struct {
+	Provider   string
+	Class      ErrorClass
+	StatusCode int           // HTTP status, if there was a response
+	RetryAfter time.Duration // wait requested by the server, if any
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request may succeed if repeated
+func (e *Error) Retryable() bool {
+	return e.Class.Retryable()
+}
+
+// ClassOf returns the class of err: that of the first Error in its chain,
+// or one inferred from timeouts and network failures, or ClassUnknown
+func ClassOf(err error) ErrorClass {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.Class
+	}
+	return networkClass(err)
+}
+
+// IsRetryable reports whether a request that failed with err may succeed
+// if repeated
+func IsRetryable(err error) bool {
+	return ClassOf(err).Retryable()
+}
+
+// newError returns a classified error for a provider
+func newError(provider string, class ErrorClass, format string, args ...any) *Error {
+	return &Error{Provider: provider, Class: class, Err: fmt.Errorf(format, args...)}
+}
+
+// classify wraps err, which came from a request without an HTTP response
+// we could inspect, as a classified Error. Errors already classified and
+// cancellations are returned as they are.
+func classify(provider string, err error) error {
+	var providerErr *Error
+	if err == nil || errors.As(err, &providerErr) || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &Error{Provider: provider, Class: networkClass(err), Err: err}
+}
+
+// classifyResponse wraps err, which came from a failed HTTP response, as a
+// classified Error. message is the error text of the response body, which
+// tells apart failures sharing a status code.
+func classifyResponse(provider string, status int, header http.Header, message string, err error) *Error {
+	return &Error{
+		Provider:   provider,
+		Class:      statusClass(status, message),
+		StatusCode: status,
+		RetryAfter: retryAfter(header),
+		Err:        err,
+	}
+}
+
+// networkClass infers the class of an error without an HTTP response
+func networkClass(err error) ErrorClass {
+	if err == nil {
+		return ClassUnknown
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ClassTimeout
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return ClassUnavailable
+	}
+
+	return ClassUnknown
+}
+
+// statusClass maps an HTTP status and error message to a class. The
+// status decides first; the message only tells apart the client errors
+// that share a status code.
+func statusClass(status int, message string) ErrorClass {
+	message = strings.ToLower(message)
+
+	switch status {
+	case http.StatusTooManyRequests:
+		// Rate limit messages often mention tokens too
+		if containsAny(message, quotaHints) {
+			return ClassQuota
+		}
+		return ClassRateLimited
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ClassAuth
+	case http.StatusPaymentRequired:
+		return ClassQuota
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ClassTimeout
+	case http.StatusRequestEntityTooLarge:
+		return ClassContextLength
+	}
+
+	switch {
+	case status >= 500:
+		// Including Anthropic's 529 "overloaded"
+		return ClassUnavailable
+	case status < 400:
+		return ClassUnknown
+	case containsAny(message, contextLengthHints):
+		return ClassContextLength
+	case containsAny(message, contentFilterHints):
+		return ClassContentFiltered
+	}
+	return ClassBadRequest
+}
+
+// Phrases by which providers report client errors that share a status
+// code with others
+var (
+	contextLengthHints = []string{
+		"context_length_exceeded",
+		"context length",
+		"context window",
+		"maximum context",
+		"prompt is too long",
+		"input is too long",
+		"too many tokens",
+		"reduce the length",
+	}
+	// Error codes rather than words, which any message may contain
+	contentFilterHints = []string{
+		"content_filter",               // OpenAI and Azure OpenAI
+		"content_policy_violation",     // OpenAI
+		"responsibleaipolicyviolation", // Azure OpenAI's inner error code
+		"content management policy",    // Azure OpenAI's message for it
+		"prohibited_content",           // Gemini
+	}
+	quotaHints = []string{
+		"insufficient_quota",
+		"exceeded your current quota",
+		"billing",
+		"credit",
+	}
+)
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    ErrorClass
+	}{
+		{"rate limited", 429, "Rate limit reached for tokens per minute", ClassRateLimited},
+		{"quota", 429, "You exceeded your current quota, please check your plan and billing details", ClassQuota},
+		{"payment required", 402, "", ClassQuota},
+		{"invalid key", 401, "Invalid API key", ClassAuth},
+		{"forbidden", 403, "", ClassAuth},
+		{"timeout", 504, "", ClassTimeout},
+		{"too large", 413, "", ClassContextLength},
+		{"context length", 400, "This model's maximum context length is 8192 tokens", ClassContextLength},
+		{"anthropic prompt too long", 400, "prompt is too long: 210000 tokens > 200000 maximum", ClassContextLength},
+		{"openai content filter", 400, "invalid_request_error content_filter", ClassContentFiltered},
+		{"azure content filter", 400, "The response was filtered due to the prompt triggering Azure OpenAI's content management policy", ClassContentFiltered},
+		{"azure inner code", 400, `{"innererror":{"code":"ResponsibleAIPolicyViolation"}}`, ClassContentFiltered},
+		{"gemini prohibited content", 400, "PROHIBITED_CONTENT", ClassContentFiltered},
+		{"unknown model", 404, "The model does not exist", ClassBadRequest},
+
+		// Words in a message do not override the status
+		{"safety in a bad request", 400, "invalid value for safety_settings", ClassBadRequest},
+		{"safety in a server error", 500, "safety system unavailable", ClassUnavailable},
+		{"content filter in an auth error", 401, "key not allowed to use content_filter", ClassAuth},
+		{"context in a server error", 503, "context length service overloaded", ClassUnavailable},
+		{"anthropic overloaded", 529, "Overloaded", ClassUnavailable},
+		{"no error", 200, "content_filter", ClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := statusClass(tt.status, tt.message); got != tt.want {
+			t.Errorf("%s: statusClass(%d, %q) = %s, want %s", tt.name, tt.status, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestAnthropicErrorClass(t *testing.T) {
+	tests := []struct {
+		errType, message string
+		want             ErrorClass
+	}{
+		{"overloaded_error", "Overloaded", ClassUnavailable},
+		{"rate_limit_error", "", ClassRateLimited},
+		{"permission_error", "", ClassAuth},
+		{"request_too_large", "", ClassContextLength},
+		{"invalid_request_error", "prompt is too long", ClassContextLength},
+		{"invalid_request_error", "safety check", ClassBadRequest},
+	}
+	for _, tt := range tests {
+		if got := anthropicErrorClass(tt.errType, tt.message); got != tt.want {
+			t.Errorf("anthropicErrorClass(%q, %q) = %s, want %s", tt.errType, tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyResponse(t *testing.T) {
+	header := http.Header{"Retry-After": {"7"}}
+	err := classifyResponse("groq", 429, header, "slow down", nil)
+	if err.Class != ClassRateLimited || err.StatusCode != 429 || err.RetryAfter.Seconds() != 7 || !err.Retryable() {
+		t.Errorf("classified as %+v", err)
+	}
+}
@@ -0,0 +1,293 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// These tests replay responses recorded from the Anthropic and OpenAI APIs,
+// in testdata, and check the requests sent for them.
+
+// fixtureServer serves the recorded JSON response to requests at path, or
+// the recorded SSE stream to those asking to stream, and keeps the request
+// bodies
+type fixtureServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	bodies []map[string]any
+}
+
+func newFixtureServer(t *testing.T, path, response, stream string) *fixtureServer {
+	t.Helper()
+
+	read := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	responseData, streamData := read(response), read(stream)
+
+	f := &fixtureServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+
+		data, _ := io.ReadAll(r.Body)
+		var body map[string]any
+		if err := json.Unmarshal(data, &body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.bodies = append(f.bodies, body)
+		f.mu.Unlock()
+
+		if body["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write(streamData)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(responseData)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// body returns the body of the i-th request
+func (f *fixtureServer) body(t *testing.T, i int) map[string]any {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i >= len(f.bodies) {
+		t.Fatalf("server received %d requests, want at least %d", len(f.bodies), i+1)
+	}
+	return f.bodies[i]
+}
+
+// roundTrip sends req with SendMessage and with StreamMessage, returning
+// the response and the final chunk with the streamed content
+func roundTrip(t *testing.T, p Provider, req models.ChatRequest) (*models.ChatResponse, models.StreamChunk) {
+	t.Helper()
+
+	resp, err := p.SendMessage(context.Background(), req)
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+
+	stream, err := p.StreamMessage(context.Background(), req)
+	if err != nil {
+		t.Fatalf("StreamMessage: %v", err)
+	}
+	var content strings.Builder
+	var final models.StreamChunk
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("stream: %v", chunk.Error)
+		}
+		content.WriteString(chunk.Content)
+		if chunk.Done {
+			final = chunk
+		}
+	}
+	final.Content = content.String()
+	return resp, final
+}
+
+// checkUsage compares reported usage with the recorded counts
+func checkUsage(t *testing.T, what string, usage *models.Usage) {
+	t.Helper()
+	if usage == nil || usage.PromptTokens != 24 || usage.CompletionTokens != 9 {
+		t.Errorf("%s usage = %+v, want 24 in and 9 out", what, usage)
+	}
+}
+
+func TestAnthropicFixtures(t *testing.T) {
+	srv := newFixtureServer(t, "/v1/messages", "anthropic_message.json", "anthropic_stream.sse")
+
+	p := NewAnthropicProvider()
+	if err := p.Initialize(Config{APIKey: "test", BaseURL: srv.URL, Model: "haiku"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, final := roundTrip(t, p, conformanceRequest)
+
+	if resp.Content != "Go was created at Google." || resp.FinishReason != "stop" {
+		t.Errorf("response = %q, %q", resp.Content, resp.FinishReason)
+	}
+	checkUsage(t, "response", resp.Usage)
+	if resp.ProviderName != "anthropic" || resp.ModelName != "claude-haiku-4-5" {
+		t.Errorf("response from %s/%s", resp.ProviderName, resp.ModelName)
+	}
+
+	if final.Content != "Go was created at Google." || final.FinishReason != "length" {
+		t.Errorf("stream = %q, %q", final.Content, final.FinishReason)
+	}
+	checkUsage(t, "stream", final.Usage)
+
+	// The system prompt is a separate field and consecutive user turns are
+	// merged
+	body := srv.body(t, 0)
+	if body["system"] != "You are terse." {
+		t.Errorf("system = %v", body["system"])
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("sent %d messages, want 3: %v", len(messages), messages)
+	}
+	if last := messages[2].(map[string]any); last["role"] != "user" || last["content"] != "Who made it?\n\nAnswer in one line." {
+		t.Errorf("last message = %v", last)
+	}
+	if body["model"] != "claude-haiku-4-5" || body["max_tokens"] != 100.0 || body["temperature"] != 0.5 {
+		t.Errorf("model, max_tokens, temperature = %v, %v, %v", body["model"], body["max_tokens"], body["temperature"])
+	}
+	if body["stream"] != nil || srv.body(t, 1)["stream"] != true {
+		t.Errorf("stream = %v then %v, want unset then true", body["stream"], srv.body(t, 1)["stream"])
+	}
+}
+
+// temperatureCase is a request temperature and what is sent for it by a
+// provider configured with 0.2
+type temperatureCase struct {
+	temperature *float64
+	want        float64
+}
+
+var temperatureCases = []temperatureCase{
+	{nil, 0.2},
+	{models.Temperature(0), 0},
+	{models.Temperature(0.7), 0.7},
+}
+
+func TestAnthropicTemperature(t *testing.T) {
+	srv := newFixtureServer(t, "/v1/messages", "anthropic_message.json", "anthropic_stream.sse")
+
+	p := NewAnthropicProvider()
+	if err := p.Initialize(Config{APIKey: "test", BaseURL: srv.URL, Temperature: 0.2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Zero is sent as a setting, and values above the API's maximum of 1
+	// are clamped
+	for i, tt := range append(temperatureCases, temperatureCase{models.Temperature(1.5), 1}) {
+		req := conformanceRequest
+		req.Temperature = tt.temperature
+		if _, err := p.SendMessage(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := srv.body(t, i)["temperature"]; !ok || got != tt.want {
+			t.Errorf("temperature %v sent as %v, want %v", tt.temperature, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAITemperature(t *testing.T) {
+	srv := newFixtureServer(t, "/v1/chat/completions", "openai_completion.json", "openai_stream.sse")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_MODEL", "")
+
+	p := NewOpenAIProvider()
+	if err := p.Initialize(Config{Temperature: 0.2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client leaves out zero, so it is sent as a value that rounds to
+	// it rather than letting the API apply its default
+	for i, tt := range temperatureCases {
+		req := conformanceRequest
+		req.Temperature = tt.temperature
+		if _, err := p.SendMessage(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		got, ok := srv.body(t, i)["temperature"].(float64)
+		if !ok || math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("temperature %v sent as %v, want %v", tt.temperature, srv.body(t, i)["temperature"], tt.want)
+		}
+	}
+}
+
+func TestOpenAIFixtures(t *testing.T) {
+	srv := newFixtureServer(t, "/v1/chat/completions", "openai_completion.json", "openai_stream.sse")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_MODEL", "")
+
+	p := NewOpenAIProvider()
+	resp, final := roundTrip(t, p, conformanceRequest)
+
+	if resp.Content != "Go was created at Google." || resp.FinishReason != "stop" {
+		t.Errorf("response = %q, %q", resp.Content, resp.FinishReason)
+	}
+	checkUsage(t, "response", resp.Usage)
+	if resp.ProviderName != "openai" || resp.ModelName != "gpt-4o-mini" {
+		t.Errorf("response from %s/%s", resp.ProviderName, resp.ModelName)
+	}
+
+	if final.Content != "Go was created at Google." || final.FinishReason != "length" {
+		t.Errorf("stream = %q, %q", final.Content, final.FinishReason)
+	}
+	checkUsage(t, "stream", final.Usage)
+
+	// The system prompt stays in place as a system message
+	body := srv.body(t, 0)
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 5 {
+		t.Fatalf("sent %d messages, want 5: %v", len(messages), messages)
+	}
+	if first := messages[0].(map[string]any); first["role"] != "system" || first["content"] != "You are terse." {
+		t.Errorf("first message = %v", first)
+	}
+	if body["max_completion_tokens"] != 100.0 || body["max_tokens"] != nil || body["temperature"] != 0.5 {
+		t.Errorf("max_completion_tokens, max_tokens, temperature = %v, %v, %v", body["max_completion_tokens"], body["max_tokens"], body["temperature"])
+	}
+
+	// Streams ask for the usage chunk
+	options, _ := srv.body(t, 1)["stream_options"].(map[string]any)
+	if options["include_usage"] != true {
+		t.Errorf("stream_options = %v", srv.body(t, 1)["stream_options"])
+	}
+}
+
+func TestOpenAIReasoningModels(t *testing.T) {
+	srv := newFixtureServer(t, "/v1/chat/completions", "openai_completion.json", "openai_stream.sse")
+	t.Setenv("OPENAI_BASE_URL", srv.URL+"/v1")
+	t.Setenv("OPENAI_API_KEY", "test")
+	t.Setenv("OPENAI_MODEL", "")
+
+	p := NewOpenAIProvider()
+	for i, tt := range []struct {
+		model           string
+		wantTemperature bool
+	}{
+		{"gpt-4o", true},
+		{"o4-mini", false},
+		{"o3", false},
+	} {
+		req := conformanceRequest
+		req.Model = tt.model
+		if _, err := p.SendMessage(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := srv.body(t, i)["temperature"]; ok != tt.wantTemperature {
+			t.Errorf("%s: temperature sent = %v, want %v", tt.model, ok, tt.wantTemperature)
+		}
+	}
+}
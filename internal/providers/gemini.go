@@ -2,12 +2,18 @@ package providers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	gl "cloud.google.com/go/ai/generativelanguage/apiv1beta"
+	pb "cloud.google.com/go/ai/generativelanguage/apiv1beta/generativelanguagepb"
 	"github.com/google/generative-ai-go/genai"
 	"github.com/soyomarvaldezg/llm-chat/internal/config"
 	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
@@ -20,10 +26,11 @@ var geminiModels = map[string]string{
 
 type GeminiProvider struct {
 	client      *genai.Client
-	model       *genai.GenerativeModel
+	generative  *gl.GenerativeClient // GenerateContent for whole conversations, which client only offers for one turn
+	apiKey      string
 	modelName   string
+	temperature float64
 	isAvailable bool
-	messages    []*genai.Content
 }
 
 func NewGeminiProvider() *GeminiProvider {
@@ -36,19 +43,14 @@ func NewGeminiProvider() *GeminiProvider {
 	}
 
 	provider := &GeminiProvider{
+		apiKey:      apiKey,
 		modelName:   modelName,
+		temperature: 0.7,
 		isAvailable: apiKey != "",
-		messages:    make([]*genai.Content, 0),
 	}
 
 	if provider.isAvailable {
-		ctx := context.Background()
-		client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-		if err == nil {
-			provider.client = client
-			provider.model = client.GenerativeModel(modelName)
-			provider.model.SetTemperature(0.7)
-		} else {
+		if err := provider.connect(option.WithAPIKey(apiKey)); err != nil {
 			provider.isAvailable = false
 		}
 	}
@@ -56,6 +58,22 @@ func NewGeminiProvider() *GeminiProvider {
 	return provider
 }
 
+// connect creates the API clients
+func (g *GeminiProvider) connect(opts ...option.ClientOption) error {
+	client, err := genai.NewClient(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+	generative, err := gl.NewGenerativeRESTClient(context.Background(), opts...)
+	if err != nil {
+		client.Close()
+		return err
+	}
+
+	g.client, g.generative = client, generative
+	return nil
+}
+
 func (g *GeminiProvider) Name() string {
 	return "gemini"
 }
@@ -79,12 +97,30 @@ func (g *GeminiProvider) Initialize(cfg Config) error {
 		} else {
 			g.modelName = cfg.Model
 		}
+	}
+
+	g.temperature = cfg.Temperature
+
+	// A custom key or endpoint needs a new client
+	if cfg.APIKey != "" || cfg.BaseURL != "" {
+		apiKey := g.apiKey
+		if cfg.APIKey != "" {
+			apiKey = cfg.APIKey
+		}
+
+		opts := []option.ClientOption{option.WithAPIKey(apiKey)}
+		if cfg.BaseURL != "" {
+			opts = append(opts, option.WithEndpoint(cfg.BaseURL))
+		}
 
-		if g.client != nil {
-			g.model = g.client.GenerativeModel(g.modelName)
-			g.model.SetTemperature(float32(cfg.Temperature))
+		if err := g.connect(opts...); err != nil {
+			return fmt.Errorf("failed to create gemini client: %w", err)
 		}
+
+		g.apiKey = apiKey
+		g.isAvailable = true
 	}
+
 	return nil
 }
 
@@ -92,88 +128,170 @@ func (g *GeminiProvider) IsAvailable() bool {
 	return g.isAvailable
 }
 
+// modelFor returns the model a request is sent to
+func (g *GeminiProvider) modelFor(req models.ChatRequest) string {
+	if req.Model != "" {
+		return resolveModel(geminiModels, req.Model)
+	}
+	return g.modelName
+}
+
+// startChat builds a chat session for the request. The model is created per
+// request so that no conversation state is shared between calls.
+func (g *GeminiProvider) startChat(req models.ChatRequest) (*genai.ChatSession, genai.Part, error) {
+	if g.client == nil {
+		return nil, nil, newError(g.Name(), ClassAuth, "gemini is not configured (set GEMINI_API_KEY)")
+	}
+
+	instruction, history, last, err := toGeminiContents(req.Messages)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	model := g.client.GenerativeModel(g.modelFor(req))
+	model.SystemInstruction = instruction
+
+	model.SetTemperature(float32(temperature(req, g.temperature)))
+
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
+
+	chat := model.StartChat()
+	chat.History = history
+
+	return chat, last, nil
+}
+
+// SendMessage sends the request to GenerateContent, which answers in one
+// response
 func (g *GeminiProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
-	// Convert messages to Gemini format
-	parts := make([]genai.Part, 0)
-	for _, msg := range req.Messages {
-		if msg.Role == models.RoleUser {
-			parts = append(parts, genai.Text(msg.Content))
-		}
+	if g.generative == nil {
+		return nil, newError(g.Name(), ClassAuth, "gemini is not configured (set GEMINI_API_KEY)")
+	}
+
+	instruction, history, last, err := toGeminiContents(req.Messages)
+	if err != nil {
+		return nil, err
+	}
+
+	model := g.modelFor(req)
+	if !strings.Contains(model, "/") {
+		model = "models/" + model
+	}
+
+	config := &pb.GenerationConfig{
+		CandidateCount: genai.Ptr[int32](1),
+		Temperature:    genai.Ptr(float32(temperature(req, g.temperature))),
+	}
+	if req.MaxTokens > 0 {
+		config.MaxOutputTokens = genai.Ptr(int32(req.MaxTokens))
+	}
+
+	contents := append(history, genai.NewUserContent(last))
+	request := &pb.GenerateContentRequest{
+		Model:            model,
+		Contents:         make([]*pb.Content, len(contents)),
+		GenerationConfig: config,
+	}
+	for i, content := range contents {
+		request.Contents[i] = geminiProto(content)
+	}
+	if instruction != nil {
+		request.SystemInstruction = geminiProto(instruction)
 	}
 
 	start := time.Now()
 
-	resp, err := g.model.GenerateContent(ctx, parts...)
+	resp, err := g.generative.GenerateContent(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("gemini API error: %w", err)
+		return nil, g.classify(fmt.Errorf("gemini API error: %w", err))
 	}
 
-	if len(resp.Candidates) == 0 || len(resp.Candidates[0].Content.Parts) == 0 {
+	if reason := resp.GetPromptFeedback().GetBlockReason(); reason != pb.GenerateContentResponse_PromptFeedback_BLOCK_REASON_UNSPECIFIED {
+		return nil, &Error{Provider: g.Name(), Class: ClassContentFiltered, Err: fmt.Errorf("gemini blocked the prompt: %s", reason)}
+	}
+	if len(resp.Candidates) == 0 {
 		return nil, fmt.Errorf("no response from gemini")
 	}
+	candidate := resp.Candidates[0]
 
-	content := fmt.Sprintf("%v", resp.Candidates[0].Content.Parts[0])
+	var content strings.Builder
+	for _, part := range candidate.GetContent().GetParts() {
+		content.WriteString(part.GetText())
+	}
+
+	var usage *models.Usage
+	if metadata := resp.GetUsageMetadata(); metadata != nil {
+		usage = &models.Usage{
+			PromptTokens:     int(metadata.PromptTokenCount),
+			CompletionTokens: int(metadata.CandidatesTokenCount),
+		}
+	}
+	tokensUsed := 0
+	if usage != nil {
+		tokensUsed = usage.Total()
+	}
 
 	return &models.ChatResponse{
-		Content:      content,
-		FinishReason: "stop",
+		Content:      content.String(),
+		FinishReason: geminiFinishReason(genai.FinishReason(candidate.GetFinishReason())),
+		TokensUsed:   tokensUsed,
+		Usage:        usage,
 		ResponseTime: time.Since(start),
 		ProviderName: g.Name(),
-		ModelName:    g.modelName,
+		ModelName:    g.modelFor(req),
 	}, nil
 }
 
-func (g *GeminiProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
-	// Build message history for context
-	g.messages = make([]*genai.Content, 0)
-	for _, msg := range req.Messages {
-		role := "user"
-		if msg.Role == models.RoleAssistant {
-			role = "model"
-		}
-		g.messages = append(g.messages, &genai.Content{
-			Role:  role,
-			Parts: []genai.Part{genai.Text(msg.Content)},
-		})
-	}
-
-	// Get the last user message
-	var lastMessage string
-	for i := len(req.Messages) - 1; i >= 0; i-- {
-		if req.Messages[i].Role == models.RoleUser {
-			lastMessage = req.Messages[i].Content
-			break
+// geminiProto converts text content for the API client
+func geminiProto(content *genai.Content) *pb.Content {
+	converted := &pb.Content{Role: content.Role}
+	for _, part := range content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			converted.Parts = append(converted.Parts, &pb.Part{Data: &pb.Part_Text{Text: string(text)}})
 		}
 	}
+	return converted
+}
 
-	chat := g.model.StartChat()
-	if len(g.messages) > 1 {
-		chat.History = g.messages[:len(g.messages)-1]
+func (g *GeminiProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	chat, last, err := g.startChat(req)
+	if err != nil {
+		return nil, err
 	}
 
-	iter := chat.SendMessageStream(ctx, genai.Text(lastMessage))
+	iter := chat.SendMessageStream(ctx, last)
 
 	chunkChan := make(chan models.StreamChunk, 10)
 
 	go func() {
 		defer close(chunkChan)
 
+		// Each response repeats the running usage; the last one is final
+		final := models.StreamChunk{Done: true, ProviderName: g.Name(), ModelName: g.modelFor(req)}
+
 		for {
-			resp, err := iter.Next()
+			resp, err := geminiNext(iter)
 			if err == iterator.Done {
-				chunkChan <- models.StreamChunk{Done: true}
+				sendChunk(ctx, chunkChan, final)
 				return
 			}
 			if err != nil {
-				chunkChan <- models.StreamChunk{Error: err, Done: true}
+				sendChunk(ctx, chunkChan, models.StreamChunk{Error: g.classify(err), Done: true})
 				return
 			}
 
-			for _, part := range resp.Candidates[0].Content.Parts {
-				content := fmt.Sprintf("%v", part)
-				chunkChan <- models.StreamChunk{
-					Content: content,
-					Done:    false,
+			if usage := geminiUsage(resp); usage != nil {
+				final.Usage = usage
+			}
+			if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason != genai.FinishReasonUnspecified {
+				final.FinishReason = geminiFinishReason(resp.Candidates[0].FinishReason)
+			}
+
+			if content := geminiText(resp); content != "" {
+				if !sendChunk(ctx, chunkChan, models.StreamChunk{Content: content}) {
+					return
 				}
 			}
 		}
@@ -182,6 +300,64 @@ func (g *GeminiProvider) StreamMessage(ctx context.Context, req models.ChatReque
 	return chunkChan, nil
 }
 
+// geminiNext reads the next response of a stream. With encoding/json's v2
+// implementation, the client's stream reader fails on the bracket closing
+// the array of responses; that error after a response with a finish reason
+// ends the stream like iterator.Done.
+func geminiNext(iter *genai.GenerateContentResponseIterator) (*genai.GenerateContentResponse, error) {
+	resp, err := iter.Next()
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		merged := iter.MergedResponse()
+		if merged != nil && len(merged.Candidates) > 0 && merged.Candidates[0].FinishReason != genai.FinishReasonUnspecified {
+			return nil, iterator.Done
+		}
+	}
+	return resp, err
+}
+
+// classify converts an API client error to a classified Error
+func (g *GeminiProvider) classify(err error) error {
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		return &Error{Provider: g.Name(), Class: ClassContentFiltered, Err: err}
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return classifyResponse(g.Name(), apiErr.Code, apiErr.Header, apiErr.Message, err)
+	}
+
+	return classify(g.Name(), err)
+}
+
+// geminiUsage reads the token counts of a response, if it has any
+func geminiUsage(resp *genai.GenerateContentResponse) *models.Usage {
+	if resp.UsageMetadata == nil {
+		return nil
+	}
+	return &models.Usage{
+		PromptTokens:     int(resp.UsageMetadata.PromptTokenCount),
+		CompletionTokens: int(resp.UsageMetadata.CandidatesTokenCount),
+	}
+}
+
+// geminiFinishReason maps a finish reason to the OpenAI-style finish
+// reasons used elsewhere
+func geminiFinishReason(reason genai.FinishReason) string {
+	switch reason {
+	case genai.FinishReasonMaxTokens:
+		return "length"
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation:
+		return "content_filter"
+	case genai.FinishReasonOther:
+		return "other"
+	default:
+		return "stop"
+	}
+}
+
 func GetGeminiMetadata() Metadata {
 	return Metadata{
 		Name:        "gemini",
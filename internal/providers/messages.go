@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"github.com/ollama/ollama/api"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// Message translation contract
+//
+// ChatRequest.Messages is the complete conversation, oldest first, and is
+// the only conversation state: providers must not remember messages between
+// calls. Every provider translates it the same way:
+//
+//   - System messages are sent as the provider's system prompt. APIs with a
+//     system role (OpenAI-compatible, Ollama) receive them in place; APIs
+//     with a separate system field (Gemini, Anthropic) receive them joined
+//     by blank lines.
+//   - User and assistant messages are sent in order with their roles intact.
+//     Assistant maps to "model" for Gemini.
+//   - Message content is never altered, trimmed or dropped, except that APIs
+//     requiring alternating turns (Gemini, Anthropic) get consecutive
+//     messages of the same role merged, separated by blank lines.
+//   - SendMessage and StreamMessage send exactly the same conversation.
+
+// splitSystem separates system messages from the conversation turns and
+// returns the system prompt they form
+func splitSystem(messages []models.Message) (string, []models.Message) {
+	system := make([]string, 0)
+	turns := make([]models.Message, 0, len(messages))
+
+	for _, msg := range messages {
+		if msg.Role == models.RoleSystem {
+			system = append(system, msg.Content)
+		} else {
+			turns = append(turns, msg)
+		}
+	}
+
+	return strings.Join(system, "\n\n"), turns
+}
+
+// mergeTurns joins consecutive messages that have the same role
+func mergeTurns(messages []models.Message) []models.Message {
+	merged := make([]models.Message, 0, len(messages))
+
+	for _, msg := range messages {
+		if n := len(merged); n > 0 && merged[n-1].Role == msg.Role {
+			merged[n-1].Content += "\n\n" + msg.Content
+			continue
+		}
+		merged = append(merged, msg)
+	}
+
+	return merged
+}
+
+// toOpenAIMessages translates a conversation for OpenAI-compatible APIs
+func toOpenAIMessages(messages []models.Message) []openai.ChatCompletionMessage {
+	result := make([]openai.ChatCompletionMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = openai.ChatCompletionMessage{
+			Role:    string(msg.Role),
+			Content: msg.Content,
+		}
+	}
+	return result
+}
+
+// toOllamaMessages translates a conversation for the Ollama chat API
+func toOllamaMessages(messages []models.Message) []api.Message {
+	result := make([]api.Message, len(messages))
+	for i, msg := range messages {
+		result[i] = api.Message{
+			Role:    string(msg.Role),
+			Content: msg.Content,
+		}
+	}
+	return result
+}
+
+// toGeminiContents translates a conversation for Gemini. It returns the
+// system instruction (nil if there is none), the earlier turns to use as
+// chat history, and the final user turn to send.
+func toGeminiContents(messages []models.Message) (*genai.Content, []*genai.Content, genai.Part, error) {
+	system, turns := splitSystem(messages)
+	turns = mergeTurns(turns)
+
+	if len(turns) == 0 || turns[len(turns)-1].Role != models.RoleUser {
+		return nil, nil, nil, fmt.Errorf("conversation must end with a user message")
+	}
+
+	var instruction *genai.Content
+	if system != "" {
+		instruction = &genai.Content{Parts: []genai.Part{genai.Text(system)}}
+	}
+
+	history := make([]*genai.Content, 0, len(turns)-1)
+	for _, msg := range turns[:len(turns)-1] {
+		role := "user"
+		if msg.Role == models.RoleAssistant {
+			role = "model"
+		}
+		history = append(history, &genai.Content{
+			Role:  role,
+			Parts: []genai.Part{genai.Text(msg.Content)},
+		})
+	}
+
+	return instruction, history, genai.Text(turns[len(turns)-1].Content), nil
+}
+
+// geminiText concatenates the text parts of a Gemini response
+func geminiText(resp *genai.GenerateContentResponse) string {
+	var sb strings.Builder
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			sb.WriteString(string(text))
+		}
+	}
+	return sb.String()
+}
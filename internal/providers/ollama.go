@@ -2,7 +2,11 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/ollama/ollama/api"
@@ -19,34 +23,54 @@ type OllamaProvider struct {
 	isAvailable bool
 }
 
-// NewOllamaProvider creates a new Ollama provider instance
+// NewOllamaProvider creates a new Ollama provider instance. The server
+// address comes from OLLAMA_URL, then OLLAMA_HOST, then the default.
 func NewOllamaProvider() *OllamaProvider {
-	baseURL := config.GetEnv("OLLAMA_URL", "http://localhost:11434")
+	baseURL := config.GetEnv("OLLAMA_URL", config.GetEnv("OLLAMA_HOST", "http://localhost:11434"))
 	model := config.GetEnv("OLLAMA_MODEL", "llama3:8b-instruct-q4_K_M")
 
-	client, err := api.ClientFromEnvironment()
-	if err != nil {
-		// Try creating client with default URL
-		client = api.NewClient(nil, nil)
-	}
-
 	provider := &OllamaProvider{
-		client:  client,
 		baseURL: baseURL,
 		model:   model,
 	}
 
+	client, err := newOllamaClient(baseURL)
+	if err != nil {
+		return provider
+	}
+	provider.client = client
+
 	// Check availability by attempting to list models
 	provider.checkAvailability()
 
 	return provider
 }
 
+// newOllamaClient creates a client for the server at rawURL. A bare
+// host:port is treated as http.
+func newOllamaClient(rawURL string) (*api.Client, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ollama URL %q: %w", rawURL, err)
+	}
+
+	return api.NewClient(base, http.DefaultClient), nil
+}
+
 // checkAvailability checks if Ollama is running and accessible
 func (p *OllamaProvider) checkAvailability() {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
+	if p.client == nil {
+		p.isAvailable = false
+		return
+	}
+
 	// Try to list models to verify connection
 	_, err := p.client.List(ctx)
 	p.isAvailable = (err == nil)
@@ -59,6 +83,10 @@ func (p *OllamaProvider) Name() string {
 
 // Models returns the list of available models
 func (p *OllamaProvider) Models() []string {
+	if p.client == nil {
+		return []string{p.model}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -89,15 +117,19 @@ func (p *OllamaProvider) Initialize(cfg Config) error {
 	}
 
 	if cfg.BaseURL != "" {
+		client, err := newOllamaClient(cfg.BaseURL)
+		if err != nil {
+			return err
+		}
 		p.baseURL = cfg.BaseURL
-		p.client = api.NewClient(nil, nil)
+		p.client = client
 	}
 
 	// Re-check availability after initialization
 	p.checkAvailability()
 
 	if !p.isAvailable {
-		return fmt.Errorf("ollama is not available at %s", p.baseURL)
+		return newError(p.Name(), ClassUnavailable, "ollama is not available at %s", p.baseURL)
 	}
 
 	return nil
@@ -112,56 +144,31 @@ func (p *OllamaProvider) IsAvailable() bool {
 func (p *OllamaProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
 	start := time.Now()
 
-	// Convert our message format to Ollama format
-	ollamaMessages := make([]api.Message, len(req.Messages))
-	for i, msg := range req.Messages {
-		ollamaMessages[i] = api.Message{
-			Role:    string(msg.Role),
-			Content: msg.Content,
-		}
-	}
-
-	// Prepare the request
-	chatReq := &api.ChatRequest{
-		Model:    p.model,
-		Messages: ollamaMessages,
-		Stream:   &[]bool{false}[0], // Disable streaming for this method
-	}
-
-	// Set temperature if specified
-	if req.Temperature > 0 {
-		chatReq.Options = map[string]interface{}{
-			"temperature": req.Temperature,
-		}
-	}
-
-	// Set max tokens if specified
-	if req.MaxTokens > 0 {
-		if chatReq.Options == nil {
-			chatReq.Options = make(map[string]interface{})
-		}
-		chatReq.Options["num_predict"] = req.MaxTokens
-	}
+	chatReq := p.newChatRequest(req, false)
 
 	// Execute the chat request
-	var fullResponse string
+	var final api.ChatResponse
 	err := p.client.Chat(ctx, chatReq, func(resp api.ChatResponse) error {
-		fullResponse = resp.Message.Content
+		final = resp
 		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("ollama chat error: %w", err)
+		return nil, p.classify(fmt.Errorf("ollama chat error: %w", err))
 	}
 
 	responseTime := time.Since(start)
 
+	usage := ollamaUsage(final)
+
 	return &models.ChatResponse{
-		Content:      fullResponse,
-		FinishReason: "stop",
+		Content:      final.Message.Content,
+		FinishReason: ollamaFinishReason(final.DoneReason),
+		TokensUsed:   usage.Total(),
+		Usage:        usage,
 		ResponseTime: responseTime,
 		ProviderName: p.Name(),
-		ModelName:    p.model,
+		ModelName:    p.modelFor(req),
 	}, nil
 }
 
@@ -169,72 +176,93 @@ func (p *OllamaProvider) SendMessage(ctx context.Context, req models.ChatRequest
 func (p *OllamaProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
 	chunkChan := make(chan models.StreamChunk, 10)
 
-	// Convert our message format to Ollama format
-	ollamaMessages := make([]api.Message, len(req.Messages))
-	for i, msg := range req.Messages {
-		ollamaMessages[i] = api.Message{
-			Role:    string(msg.Role),
-			Content: msg.Content,
-		}
-	}
-
-	// Prepare the request
-	chatReq := &api.ChatRequest{
-		Model:    p.model,
-		Messages: ollamaMessages,
-		Stream:   &[]bool{true}[0], // Enable streaming
-	}
-
-	// Set temperature if specified
-	if req.Temperature > 0 {
-		chatReq.Options = map[string]interface{}{
-			"temperature": req.Temperature,
-		}
-	}
-
-	// Set max tokens if specified
-	if req.MaxTokens > 0 {
-		if chatReq.Options == nil {
-			chatReq.Options = make(map[string]interface{})
-		}
-		chatReq.Options["num_predict"] = req.MaxTokens
-	}
+	chatReq := p.newChatRequest(req, true)
 
 	// Start streaming in a goroutine
 	go func() {
 		defer close(chunkChan)
 
 		err := p.client.Chat(ctx, chatReq, func(resp api.ChatResponse) error {
-			// Send each chunk through the channel
-			select {
-			case chunkChan <- models.StreamChunk{
-				Content: resp.Message.Content,
-				Done:    resp.Done,
-				Error:   nil,
-			}:
-			case <-ctx.Done():
+			// Send each chunk through the channel; the last one carries
+			// the token counts
+			chunk := models.StreamChunk{Content: resp.Message.Content, Done: resp.Done}
+			if resp.Done {
+				chunk.Usage = ollamaUsage(resp)
+				chunk.ProviderName = p.Name()
+				chunk.ModelName = p.modelFor(req)
+				chunk.FinishReason = ollamaFinishReason(resp.DoneReason)
+			}
+			if !sendChunk(ctx, chunkChan, chunk) {
 				return ctx.Err()
 			}
-
 			return nil
 		})
 
 		// If there was an error, send it as the final chunk
 		if err != nil {
-			select {
-			case chunkChan <- models.StreamChunk{
-				Content: "",
-				Done:    true,
-				Error:   fmt.Errorf("ollama streaming error: %w", err),
-			}:
-			case <-ctx.Done():
-			}
+			sendChunk(ctx, chunkChan, models.StreamChunk{
+				Done:  true,
+				Error: p.classify(fmt.Errorf("ollama streaming error: %w", err)),
+			})
 		}
 	}()
 
 	return chunkChan, nil
 }
 
+// classify converts an API client error to a classified Error
+func (p *OllamaProvider) classify(err error) error {
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) {
+		return classifyResponse(p.Name(), statusErr.StatusCode, nil, statusErr.ErrorMessage, err)
+	}
+	return classify(p.Name(), err)
+}
+
+// modelFor returns the model a request is sent to
+func (p *OllamaProvider) modelFor(req models.ChatRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return p.model
+}
+
+// newChatRequest translates a request for the Ollama chat API
+func (p *OllamaProvider) newChatRequest(req models.ChatRequest, stream bool) *api.ChatRequest {
+	options := map[string]interface{}{
+		"temperature": temperature(req, p.config.Temperature),
+	}
+
+	// Set max tokens if specified
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+
+	return &api.ChatRequest{
+		Model:    p.modelFor(req),
+		Messages: toOllamaMessages(req.Messages),
+		Stream:   &stream,
+		Options:  options,
+	}
+}
+
+// ollamaUsage reads the token counts of a final response
+func ollamaUsage(resp api.ChatResponse) *models.Usage {
+	return &models.Usage{
+		PromptTokens:     resp.PromptEvalCount,
+		CompletionTokens: resp.EvalCount,
+	}
+}
+
+// ollamaFinishReason maps a done reason to the OpenAI-style finish reasons
+// used elsewhere
+func ollamaFinishReason(reason string) string {
+	if reason == "" {
+		return "stop"
+	}
+	return reason
+}
+
 // GetMetadata returns the provider's metadata
 func GetOllamaMetadata() Metadata {
 	return Metadata{
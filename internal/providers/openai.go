@@ -0,0 +1,37 @@
+package providers
+
+// OpenAISpec describes the OpenAI API
+var OpenAISpec = OpenAICompatSpec{
+	Name:                "openai",
+	DisplayName:         "OpenAI",
+	Description:         "GPT models from OpenAI",
+	Icon:                "🧠",
+	BaseURL:             "https://api.openai.com/v1",
+	BaseURLEnv:          "OPENAI_BASE_URL",
+	APIKeyEnv:           "OPENAI_API_KEY",
+	RequiresAPI:         true,
+	ModelEnv:            "OPENAI_MODEL",
+	DefaultModel:        "gpt-4o-mini",
+	MaxCompletionTokens: true,
+	ReasoningModels:     []string{"o1", "o3", "o4"},
+	Models: map[string]string{
+		"gpt-4o":       "gpt-4o",
+		"gpt-4o-mini":  "gpt-4o-mini",
+		"gpt-4.1":      "gpt-4.1",
+		"gpt-4.1-mini": "gpt-4.1-mini",
+		"o4-mini":      "o4-mini",
+	},
+}
+
+// OpenAIProvider implements the Provider interface for the OpenAI API
+type OpenAIProvider struct {
+	*OpenAICompatProvider
+}
+
+func NewOpenAIProvider() *OpenAIProvider {
+	return &OpenAIProvider{NewOpenAICompatProvider(OpenAISpec)}
+}
+
+func GetOpenAIMetadata() Metadata {
+	return OpenAISpec.Metadata()
+}
@@ -0,0 +1,392 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/soyomarvaldezg/llm-chat/internal/config"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// OpenAICompatSpec describes an endpoint that speaks the OpenAI chat
+// completions API. Groq, Together AI and SambaNova are built-in specs;
+// users can add more in the config file.
+type OpenAICompatSpec struct {
+	Name        string
+	DisplayName string
+	Description string
+	Icon        string
+
+	// BaseURL is the API root, including the version path (e.g. ".../v1").
+	// BaseURLEnv optionally names an environment variable overriding it.
+	BaseURL    string
+	BaseURLEnv string
+
+	// APIKeyEnv names the environment variable holding the API key. APIKey
+	// is used when the variable is unset.
+	APIKeyEnv string
+	APIKey    string
+
+	// RequiresAPI marks endpoints that are unusable without a key. Local
+	// servers such as vLLM or llama.cpp usually need none.
+	RequiresAPI bool
+
+	// ModelEnv names the environment variable selecting the default model
+	ModelEnv     string
+	DefaultModel string
+
+	// Models maps short aliases to full model IDs
+	Models map[string]string
+
+	// Headers are added to every request
+	Headers map[string]string
+
+	// MaxCompletionTokens sends the token limit as max_completion_tokens
+	// instead of the deprecated max_tokens, as the OpenAI API requires for
+	// newer models
+	MaxCompletionTokens bool
+
+	// ReasoningModels lists prefixes of model IDs that reject a
+	// temperature, such as OpenAI's o-series; requests to them are sent
+	// without one
+	ReasoningModels []string
+}
+
+// Metadata returns the registry metadata for the endpoint
+func (s OpenAICompatSpec) Metadata() Metadata {
+	displayName := s.DisplayName
+	if displayName == "" {
+		displayName = s.Name
+	}
+
+	description := s.Description
+	if description == "" {
+		description = "OpenAI-compatible endpoint at " + s.BaseURL
+	}
+
+	icon := s.Icon
+	if icon == "" {
+		icon = "🔌"
+	}
+
+	return Metadata{
+		Name:        s.Name,
+		DisplayName: displayName,
+		Description: description,
+		RequiresAPI: s.RequiresAPI,
+		DefaultURL:  s.BaseURL,
+		EnvVarKey:   s.APIKeyEnv,
+		EnvVarModel: s.ModelEnv,
+		Icon:        icon,
+	}
+}
+
+// OpenAICompatProvider implements the Provider interface for any
+// OpenAI-compatible endpoint
+type OpenAICompatProvider struct {
+	spec        OpenAICompatSpec
+	client      *openai.Client
+	apiKey      string
+	baseURL     string
+	model       string
+	temperature float64
+	isAvailable bool
+}
+
+// NewOpenAICompatProvider creates a provider for the given endpoint
+func NewOpenAICompatProvider(spec OpenAICompatSpec) *OpenAICompatProvider {
+	apiKey := spec.APIKey
+	if spec.APIKeyEnv != "" {
+		apiKey = config.GetEnv(spec.APIKeyEnv, apiKey)
+	}
+
+	model := spec.DefaultModel
+	if spec.ModelEnv != "" {
+		model = config.GetEnv(spec.ModelEnv, model)
+	}
+
+	baseURL := spec.BaseURL
+	if spec.BaseURLEnv != "" {
+		baseURL = config.GetEnv(spec.BaseURLEnv, baseURL)
+	}
+
+	provider := &OpenAICompatProvider{
+		spec:        spec,
+		apiKey:      apiKey,
+		baseURL:     baseURL,
+		model:       resolveModel(spec.Models, model),
+		isAvailable: apiKey != "" || !spec.RequiresAPI,
+	}
+
+	if provider.isAvailable {
+		provider.client = provider.newClient()
+	}
+
+	return provider
+}
+
+// resolveModel expands a model alias to its full ID
+func resolveModel(aliases map[string]string, model string) string {
+	if fullModel, ok := aliases[model]; ok {
+		return fullModel
+	}
+	return model
+}
+
+// temperature returns the temperature of a request, or fallback when it
+// sets none
+func temperature(req models.ChatRequest, fallback float64) float64 {
+	if req.Temperature != nil {
+		return *req.Temperature
+	}
+	return fallback
+}
+
+// newClient creates an API client for the current key and base URL
+func (p *OpenAICompatProvider) newClient() *openai.Client {
+	clientConfig := openai.DefaultConfig(p.apiKey)
+	clientConfig.BaseURL = p.baseURL
+	clientConfig.HTTPClient = &http.Client{
+		Transport: &headerTransport{base: http.DefaultTransport, headers: p.spec.Headers},
+	}
+
+	return openai.NewClientWithConfig(clientConfig)
+}
+
+func (p *OpenAICompatProvider) Name() string {
+	return p.spec.Name
+}
+
+func (p *OpenAICompatProvider) Models() []string {
+	if len(p.spec.Models) == 0 {
+		return []string{p.model}
+	}
+
+	models := make([]string, 0, len(p.spec.Models))
+	for key := range p.spec.Models {
+		models = append(models, key)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (p *OpenAICompatProvider) DefaultModel() string {
+	return p.model
+}
+
+func (p *OpenAICompatProvider) Initialize(cfg Config) error {
+	if cfg.Model != "" {
+		p.model = resolveModel(p.spec.Models, cfg.Model)
+	}
+	p.temperature = cfg.Temperature
+
+	if cfg.APIKey != "" || cfg.BaseURL != "" {
+		if cfg.APIKey != "" {
+			p.apiKey = cfg.APIKey
+		}
+		if cfg.BaseURL != "" {
+			p.baseURL = cfg.BaseURL
+		}
+		p.isAvailable = p.apiKey != "" || !p.spec.RequiresAPI
+		p.client = p.newClient()
+	}
+
+	if !p.isAvailable {
+		if p.spec.APIKeyEnv == "" {
+			return newError(p.spec.Name, ClassAuth, "%s has no API key configured", p.spec.Name)
+		}
+		return newError(p.spec.Name, ClassAuth, "%s is not configured (set %s)", p.spec.Name, p.spec.APIKeyEnv)
+	}
+
+	return nil
+}
+
+func (p *OpenAICompatProvider) IsAvailable() bool {
+	return p.isAvailable
+}
+
+func (p *OpenAICompatProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	start := time.Now()
+
+	ctx, failed := withFailedHeader(ctx)
+	resp, err := p.client.CreateChatCompletion(ctx, p.newRequest(req, false))
+	if err != nil {
+		return nil, p.classify(fmt.Errorf("%s API error: %w", p.spec.Name, err), *failed)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from %s", p.spec.Name)
+	}
+
+	return &models.ChatResponse{
+		Content:      resp.Choices[0].Message.Content,
+		FinishReason: string(resp.Choices[0].FinishReason),
+		TokensUsed:   resp.Usage.TotalTokens,
+		Usage:        openAIUsage(&resp.Usage),
+		ResponseTime: time.Since(start),
+		ProviderName: p.Name(),
+		ModelName:    p.modelFor(req),
+	}, nil
+}
+
+func (p *OpenAICompatProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	streamCtx, failed := withFailedHeader(ctx)
+	stream, err := p.client.CreateChatCompletionStream(streamCtx, p.newRequest(req, true))
+	if err != nil {
+		return nil, p.classify(fmt.Errorf("%s stream error: %w", p.spec.Name, err), *failed)
+	}
+
+	chunkChan := make(chan models.StreamChunk, 10)
+
+	go func() {
+		defer close(chunkChan)
+		defer stream.Close()
+
+		// Usage arrives in a final chunk without choices, after the one
+		// carrying the finish reason
+		final := models.StreamChunk{Done: true, ProviderName: p.Name(), ModelName: p.modelFor(req)}
+
+		for {
+			response, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				sendChunk(ctx, chunkChan, final)
+				return
+			}
+			if err != nil {
+				sendChunk(ctx, chunkChan, models.StreamChunk{Error: p.classify(err, nil), Done: true})
+				return
+			}
+
+			if response.Usage != nil {
+				final.Usage = openAIUsage(response.Usage)
+			}
+
+			if len(response.Choices) > 0 {
+				if reason := response.Choices[0].FinishReason; reason != "" {
+					final.FinishReason = string(reason)
+				}
+				content := response.Choices[0].Delta.Content
+				if content == "" {
+					continue
+				}
+				if !sendChunk(ctx, chunkChan, models.StreamChunk{Content: content}) {
+					return
+				}
+			}
+		}
+	}()
+
+	return chunkChan, nil
+}
+
+// modelFor returns the model a request is sent to
+func (p *OpenAICompatProvider) modelFor(req models.ChatRequest) string {
+	if req.Model != "" {
+		return resolveModel(p.spec.Models, req.Model)
+	}
+	return p.model
+}
+
+// classify converts an API client error to a classified Error. header
+// holds the headers of the failed response, which the client drops.
+func (p *OpenAICompatProvider) classify(err error, header http.Header) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode > 0 {
+		message := fmt.Sprintf("%s %s %v", apiErr.Type, apiErr.Message, apiErr.Code)
+		return classifyResponse(p.spec.Name, apiErr.HTTPStatusCode, header, message, err)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) && reqErr.HTTPStatusCode > 0 {
+		return classifyResponse(p.spec.Name, reqErr.HTTPStatusCode, header, string(reqErr.Body), err)
+	}
+
+	return classify(p.spec.Name, err)
+}
+
+// newRequest translates a request for the chat completions API
+func (p *OpenAICompatProvider) newRequest(req models.ChatRequest, stream bool) openai.ChatCompletionRequest {
+	model := p.modelFor(req)
+	request := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: toOpenAIMessages(req.Messages),
+		Stream:   stream,
+	}
+
+	if !slices.ContainsFunc(p.spec.ReasoningModels, func(prefix string) bool { return strings.HasPrefix(model, prefix) }) {
+		// The client omits a zero temperature, which the API would take as
+		// its default of 1, so zero is sent as the smallest value above it
+		request.Temperature = float32(temperature(req, p.temperature))
+		if request.Temperature == 0 {
+			request.Temperature = math.SmallestNonzeroFloat32
+		}
+	}
+
+	if stream {
+		request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	if p.spec.MaxCompletionTokens {
+		request.MaxCompletionTokens = req.MaxTokens
+	} else {
+		request.MaxTokens = req.MaxTokens
+	}
+
+	return request
+}
+
+// openAIUsage converts reported usage, returning nil when none was reported
+func openAIUsage(usage *openai.Usage) *models.Usage {
+	if usage == nil || usage.TotalTokens == 0 {
+		return nil
+	}
+	return &models.Usage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+}
+
+// failedHeaderKey is the context key under which a request made with
+// withFailedHeader keeps the headers of a failed response
+type failedHeaderKey struct{}
+
+// withFailedHeader returns a context for a request and where the headers
+// of its response will be stored if it fails, so that Retry-After can be
+// read from errors of an API client that drops them
+func withFailedHeader(ctx context.Context) (context.Context, *http.Header) {
+	header := new(http.Header)
+	return context.WithValue(ctx, failedHeaderKey{}, header), header
+}
+
+// headerTransport adds fixed headers to every request and stores the
+// headers of failed responses for withFailedHeader
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) > 0 {
+		req = req.Clone(req.Context())
+		for key, value := range t.headers {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil && resp.StatusCode >= http.StatusBadRequest {
+		if header, ok := req.Context().Value(failedHeaderKey{}).(*http.Header); ok {
+			*header = resp.Header
+		}
+	}
+	return resp, err
+}
@@ -6,7 +6,10 @@ import (
 	"github.com/soyomarvaldezg/llm-chat/pkg/models"
 )
 
-// Provider defines the interface that all LLM providers must implement
+// Provider defines the interface that all LLM providers must implement.
+// Requests carry the whole conversation and are translated according to the
+// message translation contract in messages.go; providers keep no
+// conversation state between calls.
 type Provider interface {
 	// Name returns the provider's name (e.g., "ollama", "openai")
 	Name() string
@@ -0,0 +1,154 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// RetryPolicy controls how requests failing with a retryable error class
+// are repeated
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per request, including the first
+	BaseDelay   time.Duration // wait before the first retry, doubled for each further one
+	MaxDelay    time.Duration // longest wait, including one asked for by Retry-After
+
+	// OnRetry, if set, is called before waiting delay for attempt
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// retryProvider repeats the requests of a provider that fail with a
+// retryable error class
+type retryProvider struct {
+	Provider
+	policy RetryPolicy
+}
+
+// WithRetry wraps a provider so that requests failing with a retryable
+// error class are repeated according to policy. A stream is only repeated
+// if it failed before any content was received, so that no output is
+// duplicated. A policy allowing one attempt returns the provider as it is.
+func WithRetry(p Provider, policy RetryPolicy) Provider {
+	if policy.MaxAttempts <= 1 {
+		return p
+	}
+	return &retryProvider{Provider: p, policy: policy}
+}
+
+// Unwrap returns the provider wrapped by WithRetry, or p if it is not
+// wrapped
+func Unwrap(p Provider) Provider {
+	if r, ok := p.(*retryProvider); ok {
+		return r.Provider
+	}
+	return p
+}
+
+func (r *retryProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := r.Provider.SendMessage(ctx, req)
+		if err == nil || !r.wait(ctx, attempt, err) {
+			return resp, err
+		}
+	}
+}
+
+func (r *retryProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	attempt := 1
+	stream, err := r.Provider.StreamMessage(ctx, req)
+	for err != nil {
+		if !r.wait(ctx, attempt, err) {
+			return nil, err
+		}
+		attempt++
+		stream, err = r.Provider.StreamMessage(ctx, req)
+	}
+
+	chunkChan := make(chan models.StreamChunk, 10)
+
+	go func() {
+		defer close(chunkChan)
+
+		emitted := false
+		for {
+			chunk, ok := <-stream
+			if !ok {
+				return
+			}
+
+			// Providers close a stream after its error chunk, so the
+			// failed stream can be left for a new one
+			if chunk.Error != nil && !emitted && r.wait(ctx, attempt, chunk.Error) {
+				attempt++
+				stream = r.reopen(ctx, req)
+				continue
+			}
+
+			emitted = emitted || chunk.Content != ""
+			if !sendChunk(ctx, chunkChan, chunk) {
+				return
+			}
+		}
+	}()
+
+	return chunkChan, nil
+}
+
+// reopen starts the stream again, returning a failure to start it as a
+// stream of its error
+func (r *retryProvider) reopen(ctx context.Context, req models.ChatRequest) <-chan models.StreamChunk {
+	stream, err := r.Provider.StreamMessage(ctx, req)
+	if err == nil {
+		return stream
+	}
+
+	failed := make(chan models.StreamChunk, 1)
+	failed <- models.StreamChunk{Error: err, Done: true}
+	close(failed)
+	return failed
+}
+
+// wait sleeps before retrying a request whose attempt failed with err. It
+// reports false, without waiting, if the request should not be retried.
+func (r *retryProvider) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt >= r.policy.MaxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+		return false
+	}
+
+	delay := r.policy.delay(attempt, err)
+	if r.policy.OnRetry != nil {
+		r.policy.OnRetry(attempt+1, delay, err)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// delay returns the wait after a failed attempt: the server's Retry-After
+// if it sent one, otherwise exponential backoff with jitter
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	var providerErr *Error
+	if errors.As(err, &providerErr) && providerErr.RetryAfter > 0 {
+		return min(providerErr.RetryAfter, p.MaxDelay)
+	}
+
+	backoff := p.BaseDelay
+	for i := 1; i < attempt && backoff < p.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxDelay)
+
+	// Half fixed and half random, so that clients failing together do not
+	// retry together
+	return backoff/2 + rand.N(backoff/2+1)
+}
@@ -0,0 +1,240 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// flakyServer is an OpenAI-compatible server whose first failures
+// requests are answered with status, and the rest succeed
+type flakyServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newFlakyServer(t *testing.T, failures int, status int, retryAfter string) *flakyServer {
+	t.Helper()
+
+	s := &flakyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.requests.Add(1)
+		if int(n) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":{"message":"scripted failure %d","type":"server_error"}}`, n)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// newFlakyProvider returns a provider for the server retrying with policy
+func newFlakyProvider(s *flakyServer, policy RetryPolicy) Provider {
+	spec := OpenAICompatSpec{Name: "flaky", BaseURL: s.URL + "/v1", DefaultModel: "test-model"}
+	return WithRetry(NewOpenAICompatProvider(spec), policy)
+}
+
+var testPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+var testRequest = models.ChatRequest{
+	Messages: []models.Message{{Role: models.RoleUser, Content: "Hi"}},
+}
+
+func TestRetrySendMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		status   int
+		wantErr  ErrorClass
+		requests int32
+	}{
+		{"succeeds first time", 0, 0, "", 1},
+		{"retries unavailable", 2, http.StatusServiceUnavailable, "", 3},
+		{"retries rate limit", 1, http.StatusTooManyRequests, "", 2},
+		{"gives up after max attempts", 5, http.StatusBadGateway, ClassUnavailable, 3},
+		{"does not retry auth", 5, http.StatusUnauthorized, ClassAuth, 1},
+		{"does not retry bad request", 5, http.StatusBadRequest, ClassBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFlakyServer(t, tt.failures, tt.status, "")
+			provider := newFlakyProvider(server, testPolicy)
+
+			resp, err := provider.SendMessage(context.Background(), testRequest)
+			if got := server.requests.Load(); got != tt.requests {
+				t.Errorf("requests = %d, want %d", got, tt.requests)
+			}
+
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("expected a %s error", tt.wantErr)
+				}
+				if class := ClassOf(err); class != tt.wantErr {
+					t.Errorf("class = %s, want %s (%v)", class, tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.Content != "Hello" {
+				t.Errorf("content = %q, want %q", resp.Content, "Hello")
+			}
+		})
+	}
+}
+
+func TestRetryStreamMessage(t *testing.T) {
+	server := newFlakyServer(t, 2, http.StatusServiceUnavailable, "")
+	provider := newFlakyProvider(server, testPolicy)
+
+	stream, err := provider.StreamMessage(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var content strings.Builder
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected stream error: %v", chunk.Error)
+		}
+		content.WriteString(chunk.Content)
+	}
+
+	if content.String() != "Hello" {
+		t.Errorf("content = %q, want %q", content.String(), "Hello")
+	}
+	if got := server.requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	server := newFlakyServer(t, 1, http.StatusTooManyRequests, "1")
+
+	var delays []time.Duration
+	policy := testPolicy
+	policy.MaxDelay = 5 * time.Second
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		delays = append(delays, delay)
+	}
+
+	if _, err := newFlakyProvider(server, policy).SendMessage(context.Background(), testRequest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(delays) != 1 || delays[0] != time.Second {
+		t.Errorf("delays = %v, want [1s] from Retry-After", delays)
+	}
+}
+
+func TestRetryAfterCappedByMaxDelay(t *testing.T) {
+	server := newFlakyServer(t, 1, http.StatusTooManyRequests, "120")
+
+	var delays []time.Duration
+	policy := testPolicy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		delays = append(delays, delay)
+	}
+
+	if _, err := newFlakyProvider(server, policy).SendMessage(context.Background(), testRequest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(delays) != 1 || delays[0] != policy.MaxDelay {
+		t.Errorf("delays = %v, want [%s]", delays, policy.MaxDelay)
+	}
+}
+
+// scriptedStream is a provider whose streams send the given chunks
+type scriptedStream struct {
+	Provider
+	streams atomic.Int32
+	chunks  []models.StreamChunk
+}
+
+func (s *scriptedStream) Name() string { return "scripted" }
+
+func (s *scriptedStream) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	s.streams.Add(1)
+	ch := make(chan models.StreamChunk, len(s.chunks))
+	for _, chunk := range s.chunks {
+		ch <- chunk
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestRetryStreamNotRepeatedAfterContent(t *testing.T) {
+	failure := &Error{Provider: "scripted", Class: ClassUnavailable, Err: fmt.Errorf("connection reset")}
+	inner := &scriptedStream{chunks: []models.StreamChunk{
+		{Content: "Hel"},
+		{Error: failure, Done: true},
+	}}
+
+	stream, err := WithRetry(inner, testPolicy).StreamMessage(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var content strings.Builder
+	var streamErr error
+	for chunk := range stream {
+		content.WriteString(chunk.Content)
+		if chunk.Error != nil {
+			streamErr = chunk.Error
+		}
+	}
+
+	if content.String() != "Hel" {
+		t.Errorf("content = %q, want %q", content.String(), "Hel")
+	}
+	if ClassOf(streamErr) != ClassUnavailable {
+		t.Errorf("stream error = %v, want the unavailable failure", streamErr)
+	}
+	if got := inner.streams.Load(); got != 1 {
+		t.Errorf("streams = %d, want 1", got)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	failure := &Error{Class: ClassUnavailable, Err: fmt.Errorf("unavailable")}
+
+	for attempt, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for range 20 {
+			delay := policy.delay(attempt+1, failure)
+			if delay < want/2 || delay > want {
+				t.Fatalf("attempt %d: delay %s outside [%s, %s]", attempt+1, delay, want/2, want)
+			}
+		}
+	}
+}
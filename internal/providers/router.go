@@ -0,0 +1,325 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/soyomarvaldezg/llm-chat/internal/contextwindow"
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// RouterName is the name under which the router is registered
+const RouterName = "router"
+
+// Request metadata read by the router's rules
+const (
+	MetadataMode = "mode" // "shell" or "interactive"
+	MetadataTags = "tags" // the conversation's tags, comma-separated
+)
+
+// Route is a backend of the router: a registered provider and the model
+// to ask, empty for the provider's default
+type Route struct {
+	Provider string
+	Model    string
+}
+
+// ParseRoute parses a backend written as "provider" or "provider:model"
+func ParseRoute(s string) Route {
+	provider, model, _ := strings.Cut(strings.TrimSpace(s), ":")
+	return Route{Provider: provider, Model: model}
+}
+
+// ParseRoutes parses a list of backends
+func ParseRoutes(list []string) []Route {
+	routes := make([]Route, len(list))
+	for i, s := range list {
+		routes[i] = ParseRoute(s)
+	}
+	return routes
+}
+
+func (r Route) String() string {
+	if r.Model == "" {
+		return r.Provider
+	}
+	return r.Provider + ":" + r.Model
+}
+
+// RouterRule sends requests matching all of its set conditions to its own
+// chain
+type RouterRule struct {
+	Mode      string // "shell" or "interactive"
+	Tag       string
+	MinTokens int // estimated prompt tokens
+	MaxTokens int // 0 for no limit
+	Chain     []Route
+}
+
+// matches reports whether a request of the given size satisfies the rule
+func (r RouterRule) matches(req models.ChatRequest, tokens int) bool {
+	if r.Mode != "" && r.Mode != req.Metadata[MetadataMode] {
+		return false
+	}
+	if r.Tag != "" && !slices.Contains(strings.Split(req.Metadata[MetadataTags], ","), r.Tag) {
+		return false
+	}
+	if tokens < r.MinTokens {
+		return false
+	}
+	return r.MaxTokens == 0 || tokens <= r.MaxTokens
+}
+
+// Router is a provider that sends each request down a chain of other
+// providers until one answers, so that a provider that is down or rate
+// limited falls back to the next. Only retryable failures fall back; a
+// rejected request or key fails at once. Backends other than the last are
+// asked without retries, so a fallback happens without waiting out their
+// backoff. Rules can choose another chain by mode, tag or prompt size.
+// Replies name the backend that actually answered.
+type Router struct {
+	chain  []Route
+	rules  []RouterRule
+	lookup func(name string) (Provider, error)
+
+	// OnFallback, if set, is called when a backend fails and the next one
+	// is tried
+	OnFallback func(failed Route, err error, next Route)
+}
+
+// NewRouter creates a router over the providers found by lookup
+func NewRouter(chain []Route, rules []RouterRule, lookup func(name string) (Provider, error)) *Router {
+	return &Router{chain: chain, rules: rules, lookup: lookup}
+}
+
+func (r *Router) Name() string {
+	return RouterName
+}
+
+// Models returns the backends of the default chain
+func (r *Router) Models() []string {
+	models := make([]string, len(r.chain))
+	for i, route := range r.chain {
+		models[i] = route.String()
+	}
+	return models
+}
+
+// DefaultModel returns "auto", since the model depends on the route
+func (r *Router) DefaultModel() string {
+	return "auto"
+}
+
+// Initialize checks that every backend is a registered provider. Models
+// are chosen per backend, so a model cannot be set.
+func (r *Router) Initialize(cfg Config) error {
+	if cfg.Model != "" && cfg.Model != r.DefaultModel() {
+		return fmt.Errorf("the router picks the model of each backend; set them in its chain as provider:model")
+	}
+
+	for _, route := range r.allRoutes() {
+		if route.Provider == RouterName {
+			return fmt.Errorf("the router cannot route to itself")
+		}
+		if _, err := r.lookup(route.Provider); err != nil {
+			return fmt.Errorf("router: %w", err)
+		}
+	}
+
+	if !r.IsAvailable() {
+		return newError(RouterName, ClassUnavailable, "no backend of the router is available")
+	}
+	return nil
+}
+
+// IsAvailable reports whether any backend is available
+func (r *Router) IsAvailable() bool {
+	for _, route := range r.allRoutes() {
+		if backend, err := r.lookup(route.Provider); err == nil && backend.IsAvailable() {
+			return true
+		}
+	}
+	return false
+}
+
+// allRoutes returns the backends of every chain
+func (r *Router) allRoutes() []Route {
+	routes := slices.Clone(r.chain)
+	for _, rule := range r.rules {
+		routes = append(routes, rule.Chain...)
+	}
+	return routes
+}
+
+// routes returns the chain for a request: that of the first matching rule,
+// or the default one
+func (r *Router) routes(req models.ChatRequest) []Route {
+	tokens := 0
+	for _, msg := range req.Messages {
+		tokens += contextwindow.MessageTokens(msg)
+	}
+
+	for _, rule := range r.rules {
+		if rule.matches(req, tokens) {
+			return rule.Chain
+		}
+	}
+	return r.chain
+}
+
+// backend returns the provider of a route and the request to send it.
+// Only the last backend of a chain retries, having none to fall back to.
+func (r *Router) backend(route Route, req models.ChatRequest, last bool) (Provider, models.ChatRequest, error) {
+	provider, err := r.lookup(route.Provider)
+	if err != nil {
+		return nil, req, err
+	}
+	if !last {
+		provider = Unwrap(provider)
+	}
+	if !provider.IsAvailable() {
+		return nil, req, newError(route.Provider, ClassUnavailable, "%s is not available", route.Provider)
+	}
+
+	req.Model = route.Model
+	return provider, req, nil
+}
+
+func (r *Router) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	routes := r.routes(req)
+
+	var errs []error
+	for i, route := range routes {
+		provider, backendReq, err := r.backend(route, req, i == len(routes)-1)
+		if err == nil {
+			var resp *models.ChatResponse
+			resp, err = provider.SendMessage(ctx, backendReq)
+			if err == nil {
+				return resp, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !IsRetryable(err) {
+			return nil, r.stopped(route, err)
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", route, err))
+		r.fallback(routes, i, err)
+	}
+
+	return nil, r.failed(errs)
+}
+
+func (r *Router) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	routes := r.routes(req)
+
+	// Backends are tried in turn until one starts a stream
+	var errs []error
+	next := 0
+	open := func() (<-chan models.StreamChunk, error) {
+		for next < len(routes) {
+			route := routes[next]
+			next++
+
+			provider, backendReq, err := r.backend(route, req, next == len(routes))
+			if err == nil {
+				var stream <-chan models.StreamChunk
+				stream, err = provider.StreamMessage(ctx, backendReq)
+				if err == nil {
+					return stream, nil
+				}
+			}
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			if !IsRetryable(err) {
+				return nil, r.stopped(route, err)
+			}
+
+			errs = append(errs, fmt.Errorf("%s: %w", route, err))
+			r.fallback(routes, next-1, err)
+		}
+		return nil, r.failed(errs)
+	}
+
+	stream, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	chunkChan := make(chan models.StreamChunk, 10)
+
+	go func() {
+		defer close(chunkChan)
+
+		// A backend failing before sending any content falls back to the
+		// next; after that its error is passed on
+		emitted := false
+		for {
+			chunk, ok := <-stream
+			if !ok {
+				return
+			}
+
+			if chunk.Error != nil && !emitted && ctx.Err() == nil && IsRetryable(chunk.Error) {
+				errs = append(errs, fmt.Errorf("%s: %w", routes[next-1], chunk.Error))
+				r.fallback(routes, next-1, chunk.Error)
+
+				if stream, err = open(); err != nil {
+					sendChunk(ctx, chunkChan, models.StreamChunk{Error: err, Done: true})
+					return
+				}
+				continue
+			}
+
+			emitted = emitted || chunk.Content != ""
+			if !sendChunk(ctx, chunkChan, chunk) {
+				return
+			}
+		}
+	}()
+
+	return chunkChan, nil
+}
+
+// fallback reports that the backend at index i failed, if another follows
+func (r *Router) fallback(routes []Route, i int, err error) {
+	if r.OnFallback != nil && i+1 < len(routes) {
+		r.OnFallback(routes[i], err, routes[i+1])
+	}
+}
+
+// failed returns the error once every backend has failed, classified as
+// the last failure
+func (r *Router) failed(errs []error) error {
+	return &Error{
+		Provider: RouterName,
+		Class:    ClassOf(errs[len(errs)-1]),
+		Err:      fmt.Errorf("every backend of the router failed: %w", errors.Join(errs...)),
+	}
+}
+
+// stopped returns the error of a backend whose failure does not fall back
+func (r *Router) stopped(route Route, err error) error {
+	return &Error{
+		Provider: RouterName,
+		Class:    ClassOf(err),
+		Err:      fmt.Errorf("%s: %w", route, err),
+	}
+}
+
+// RouterMetadata returns the registry metadata of the router
+func RouterMetadata() Metadata {
+	return Metadata{
+		Name:        RouterName,
+		DisplayName: "Router",
+		Description: "Fallback chain and routing rules over the other providers",
+		RequiresAPI: false,
+		Icon:        "🔀",
+	}
+}
@@ -0,0 +1,266 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// stubProvider answers with its name and the requested model, or fails
+// with err
+type stubProvider struct {
+	Provider
+	name     string
+	err      error
+	requests []models.ChatRequest
+}
+
+func (s *stubProvider) Name() string         { return s.name }
+func (s *stubProvider) IsAvailable() bool    { return true }
+func (s *stubProvider) DefaultModel() string { return s.name + "-default" }
+
+func (s *stubProvider) model(req models.ChatRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return s.DefaultModel()
+}
+
+func (s *stubProvider) SendMessage(ctx context.Context, req models.ChatRequest) (*models.ChatResponse, error) {
+	s.requests = append(s.requests, req)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &models.ChatResponse{Content: "from " + s.name, ProviderName: s.name, ModelName: s.model(req)}, nil
+}
+
+func (s *stubProvider) StreamMessage(ctx context.Context, req models.ChatRequest) (<-chan models.StreamChunk, error) {
+	s.requests = append(s.requests, req)
+	ch := make(chan models.StreamChunk, 2)
+	if s.err != nil {
+		ch <- models.StreamChunk{Error: s.err, Done: true}
+	} else {
+		ch <- models.StreamChunk{Content: "from " + s.name}
+		ch <- models.StreamChunk{Done: true, ProviderName: s.name, ModelName: s.model(req)}
+	}
+	close(ch)
+	return ch, nil
+}
+
+// newTestRouter returns a router over stub providers, failing the named ones
+func newTestRouter(chain string, rules []RouterRule, failing ...string) (*Router, map[string]*stubProvider) {
+	stubs := make(map[string]*stubProvider)
+	for _, name := range []string{"groq", "together", "ollama", "gemini"} {
+		stubs[name] = &stubProvider{name: name}
+	}
+	for _, name := range failing {
+		stubs[name].err = &Error{Provider: name, Class: ClassRateLimited, Err: fmt.Errorf("%s is rate limited", name)}
+	}
+
+	lookup := func(name string) (Provider, error) {
+		if stub, ok := stubs[name]; ok {
+			return stub, nil
+		}
+		return nil, fmt.Errorf("provider %s not found", name)
+	}
+	return NewRouter(ParseRoutes(strings.Split(chain, ",")), rules, lookup), stubs
+}
+
+func TestRouterFallback(t *testing.T) {
+	router, stubs := newTestRouter("groq:llama-70b,together,ollama", nil, "groq")
+
+	var fallbacks []string
+	router.OnFallback = func(failed Route, err error, next Route) {
+		fallbacks = append(fallbacks, failed.String()+" -> "+next.String())
+	}
+
+	resp, err := router.SendMessage(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.ProviderName != "together" || resp.ModelName != "together-default" {
+		t.Errorf("answered by %s/%s, want together/together-default", resp.ProviderName, resp.ModelName)
+	}
+	if got := stubs["groq"].requests[0].Model; got != "llama-70b" {
+		t.Errorf("groq was asked for model %q, want llama-70b", got)
+	}
+	if len(stubs["ollama"].requests) != 0 {
+		t.Errorf("ollama was asked after together answered")
+	}
+	if len(fallbacks) != 1 || fallbacks[0] != "groq:llama-70b -> together" {
+		t.Errorf("fallbacks = %v", fallbacks)
+	}
+}
+
+func TestRouterAllFail(t *testing.T) {
+	router, _ := newTestRouter("groq,together", nil, "groq", "together")
+
+	_, err := router.SendMessage(context.Background(), testRequest)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if ClassOf(err) != ClassRateLimited {
+		t.Errorf("class = %s, want rate_limited", ClassOf(err))
+	}
+	for _, name := range []string{"groq", "together"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestRouterRules(t *testing.T) {
+	rules := []RouterRule{
+		{Mode: "shell", Chain: ParseRoutes([]string{"ollama"})},
+		{Tag: "code", Chain: ParseRoutes([]string{"together"})},
+		{MinTokens: 1000, Chain: ParseRoutes([]string{"gemini:pro"})},
+	}
+	router, _ := newTestRouter("groq", rules)
+
+	long := strings.Repeat("word ", 2000)
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		content  string
+		want     string
+	}{
+		{"default chain", nil, "Hi", "groq"},
+		{"shell mode", map[string]string{MetadataMode: "shell"}, "Hi", "ollama"},
+		{"interactive mode", map[string]string{MetadataMode: "interactive"}, "Hi", "groq"},
+		{"tag", map[string]string{MetadataTags: "work,code"}, "Hi", "together"},
+		{"prompt size", nil, long, "gemini"},
+		{"first rule wins", map[string]string{MetadataMode: "shell"}, long, "ollama"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := models.ChatRequest{
+				Messages: []models.Message{{Role: models.RoleUser, Content: tt.content}},
+				Metadata: tt.metadata,
+			}
+			resp, err := router.SendMessage(context.Background(), req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.ProviderName != tt.want {
+				t.Errorf("answered by %s, want %s", resp.ProviderName, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterNoFallback(t *testing.T) {
+	// Failures that another backend would repeat, or that need the user to
+	// act, are returned without trying the rest of the chain
+	for _, class := range []ErrorClass{ClassBadRequest, ClassAuth, ClassContextLength, ClassContentFiltered} {
+		t.Run(string(class), func(t *testing.T) {
+			router, stubs := newTestRouter("groq,together", nil)
+			stubs["groq"].err = &Error{Provider: "groq", Class: class, Err: fmt.Errorf("groq says no")}
+			router.OnFallback = func(failed Route, err error, next Route) {
+				t.Errorf("fell back from %s to %s", failed, next)
+			}
+
+			_, err := router.SendMessage(context.Background(), testRequest)
+			if ClassOf(err) != class || !strings.Contains(err.Error(), "groq") {
+				t.Errorf("SendMessage error = %v, want %s from groq", err, class)
+			}
+
+			stream, err := router.StreamMessage(context.Background(), testRequest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var streamErr error
+			for chunk := range stream {
+				if chunk.Error != nil {
+					streamErr = chunk.Error
+				}
+			}
+			if ClassOf(streamErr) != class {
+				t.Errorf("stream error = %v, want %s", streamErr, class)
+			}
+
+			if n := len(stubs["together"].requests); n != 0 {
+				t.Errorf("together was asked %d times", n)
+			}
+		})
+	}
+}
+
+func TestRouterRetries(t *testing.T) {
+	_, stubs := newTestRouter("groq,together", nil, "groq", "together")
+
+	var retries []string
+	policy := testPolicy
+	policy.OnRetry = func(attempt int, delay time.Duration, err error) {
+		retries = append(retries, err.Error())
+	}
+	lookup := func(name string) (Provider, error) {
+		return WithRetry(stubs[name], policy), nil
+	}
+	router := NewRouter(ParseRoutes([]string{"groq", "together"}), nil, lookup)
+
+	// A backend with another to fall back to is asked once, and only the
+	// last one retries
+	if _, err := router.SendMessage(context.Background(), testRequest); ClassOf(err) != ClassRateLimited {
+		t.Fatalf("error = %v", err)
+	}
+	if n := len(stubs["groq"].requests); n != 1 {
+		t.Errorf("groq was asked %d times, want once", n)
+	}
+	if n := len(stubs["together"].requests); n != testPolicy.MaxAttempts {
+		t.Errorf("together was asked %d times, want %d", n, testPolicy.MaxAttempts)
+	}
+	for _, retry := range retries {
+		if !strings.Contains(retry, "together") {
+			t.Errorf("retried %s", retry)
+		}
+	}
+}
+
+func TestRouterStreamFallback(t *testing.T) {
+	router, _ := newTestRouter("groq,together:mixtral", nil, "groq")
+
+	stream, err := router.StreamMessage(context.Background(), testRequest)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var content strings.Builder
+	var final models.StreamChunk
+	for chunk := range stream {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected stream error: %v", chunk.Error)
+		}
+		content.WriteString(chunk.Content)
+		if chunk.Done {
+			final = chunk
+		}
+	}
+
+	if content.String() != "from together" {
+		t.Errorf("content = %q, want %q", content.String(), "from together")
+	}
+	if final.ProviderName != "together" || final.ModelName != "mixtral" {
+		t.Errorf("final chunk names %s/%s, want together/mixtral", final.ProviderName, final.ModelName)
+	}
+}
+
+func TestRouterInitialize(t *testing.T) {
+	router, _ := newTestRouter("groq,missing", nil)
+	if err := router.Initialize(Config{}); err == nil {
+		t.Error("expected an error for an unregistered backend")
+	}
+
+	router, _ = newTestRouter("groq", nil)
+	if err := router.Initialize(Config{Model: "llama-70b"}); err == nil {
+		t.Error("expected an error when a model is set")
+	}
+	if err := router.Initialize(Config{Model: router.DefaultModel()}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
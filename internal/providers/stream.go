@@ -0,0 +1,20 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
+)
+
+// sendChunk delivers a chunk to a stream consumer. It gives up when ctx is
+// cancelled, since the consumer may have stopped reading, and reports
+// whether the chunk was delivered. Stream goroutines must return once it
+// reports false so that they never block forever.
+func sendChunk(ctx context.Context, ch chan<- models.StreamChunk, chunk models.StreamChunk) bool {
+	select {
+	case ch <- chunk:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
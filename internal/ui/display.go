@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/fatih/color"
+
+	"github.com/soyomarvaldezg/llm-chat/pkg/models"
 )
 
 var (
@@ -17,6 +19,7 @@ var (
 	SuccessColor   = color.New(color.FgHiGreen)
 	InfoColor      = color.New(color.FgHiBlue)
 	MutedColor     = color.New(color.FgHiBlack)
+	HighlightColor = color.New(color.FgHiYellow, color.Bold)
 )
 
 const (
@@ -27,6 +30,7 @@ const (
 	SuccessEmoji   = "✅"
 	ThinkingEmoji  = "💭"
 	TimeEmoji      = "⏱️"
+	WarningEmoji   = "⚠️"
 )
 
 // PrintWelcome displays the welcome banner
@@ -66,6 +70,11 @@ func PrintError(message string) {
 	ErrorColor.Printf("\n%s Error: %s\n", ErrorEmoji, message)
 }
 
+// PrintWarning displays a warning message
+func PrintWarning(message string) {
+	SystemColor.Printf("\n%s Warning: %s\n", WarningEmoji, message)
+}
+
 // PrintSuccess displays a success message
 func PrintSuccess(message string) {
 	SuccessColor.Printf("%s %s\n", SuccessEmoji, message)
@@ -81,17 +90,32 @@ func PrintThinking() {
 	MutedColor.Printf("%s ", ThinkingEmoji)
 }
 
-// PrintMetrics displays response metrics
-func PrintMetrics(responseTime time.Duration, tokenCount int) {
+// PrintMetrics displays response metrics. Usage is nil when the provider
+// did not report token counts; a zero cost is not shown.
+func PrintMetrics(responseTime time.Duration, usage *models.Usage, cost float64) {
 	fmt.Println() // Newline after response
 	MutedColor.Printf("\n%s Response time: %.2fs", TimeEmoji, responseTime.Seconds())
-	if tokenCount > 0 {
-		tokensPerSec := float64(tokenCount) / responseTime.Seconds()
-		MutedColor.Printf(" | Tokens: %d (%.1f tok/s)", tokenCount, tokensPerSec)
+	if usage != nil {
+		tokensPerSec := float64(usage.CompletionTokens) / responseTime.Seconds()
+		MutedColor.Printf(" | Tokens: %d in, %d out (%.1f tok/s)", usage.PromptTokens, usage.CompletionTokens, tokensPerSec)
+	}
+	if cost > 0 {
+		MutedColor.Printf(" | Cost: %s", FormatCost(cost))
 	}
 	fmt.Println()
 }
 
+// FormatCost formats an amount in US dollars, keeping small amounts readable
+func FormatCost(amount float64) string {
+	if amount > 0 && amount < 0.0001 {
+		return "<$0.0001"
+	}
+	if amount > 0 && amount < 0.01 {
+		return fmt.Sprintf("$%.4f", amount)
+	}
+	return fmt.Sprintf("$%.2f", amount)
+}
+
 // PrintHelp displays the help message
 func PrintHelp() {
 	helpText := `
@@ -102,19 +126,38 @@ Available Commands:
   /models       - List models for current provider
   /switch       - Switch to a different model
   /history      - Show current conversation history
+  /retry [model] [temp] - Regenerate the last reply, keeping the old one on a branch
+  /edit [n]     - Rewrite one of your messages in $EDITOR and continue from it
+  /undo         - Remove the last exchange for good (it cannot be undone)
+  /branch [n] [name] - Fork the conversation at message n (default: the last one)
+  /branches     - List the branches of the conversation
+  /checkout <branch> - Switch to another branch
+  /compare <provider:model,...> <prompt> - Ask several models at once and compare (--columns: side by side)
+  /file <path|glob> - Attach files to your next message; @path in a message does the same
+  /context      - Show what the next request sends and its token count
+  /pin [n]      - Always send message n (default: the last one); /unpin [n] undoes it
   /saved        - Show recent saved conversations
-  /search       - Search through saved conversations
+  /search [query] - Search saved conversations
+  /tag [names]  - Tag this conversation (-name removes a tag)
+  /resume <id>  - Continue a saved conversation
+  /system [text] - Show or replace the system prompt (/system clear removes it)
+  /persona [name] - List personas or switch to one (/persona save <name>)
   /export       - Export current conversation
-  /stats        - Show conversation statistics
+  /stats        - Show conversation statistics and spend
   /reset        - Reset the conversation
   /assess       - Toggle prompt assessment on/off
   /guide        - Show prompt engineering best practices
   /improve <prompt> - Analyze and improve a prompt
   /exit, /quit  - Exit the chat
 
+Search syntax:
+  words match anywhere, "exact phrase", a OR b, -word / NOT word
+  filters: provider:groq model:llama role:user tag:work
+           after:2025-01-01 before:2025-02-01
+
 Tips:
   • Press Enter twice (on empty lines) to submit multi-line input
-  • Use Ctrl+C to interrupt generation
+  • Ctrl+C stops a reply in progress; press it twice at the prompt to exit
   • Type naturally - the AI understands context
   • Use /assess to get feedback on your prompts
   • Use /improve to get AI help with better prompts
@@ -124,6 +167,22 @@ Tips:
 	InfoColor.Println(helpText)
 }
 
+// Highlight renders text with the given byte ranges emphasized
+func Highlight(text string, ranges [][2]int) string {
+	var sb strings.Builder
+	last := 0
+	for _, r := range ranges {
+		if r[0] < last || r[1] > len(text) {
+			continue
+		}
+		sb.WriteString(text[last:r[0]])
+		sb.WriteString(HighlightColor.Sprint(text[r[0]:r[1]]))
+		last = r[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
 // ClearScreen clears the terminal screen
 func ClearScreen() {
 	fmt.Print("\033[H\033[2J")
@@ -13,33 +13,113 @@ const (
 
 // Message represents a single chat message
 type Message struct {
+	// ID identifies the message within its conversation, and ParentID the
+	// message it follows; together they link a conversation's branches
+	ID       string `json:"id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+
 	Role      Role      `json:"role"`
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Interrupted marks an assistant reply cut short by the user
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	// Pinned messages are always sent, however long the conversation gets
+	Pinned bool `json:"pinned,omitempty"`
+
+	// Model names the model that wrote an assistant reply
+	Model string `json:"model,omitempty"`
+
+	// Provider names the provider that wrote an assistant reply when it
+	// differs from the conversation's, as when the router picked a backend,
+	// and on every reply of a comparison
+	Provider string `json:"provider,omitempty"`
+
+	// Usage and FinishReason are reported by the provider for assistant replies
+	Usage        *Usage `json:"usage,omitempty"`
+	FinishReason string `json:"finish_reason,omitempty"`
+
+	// Cost is the price of the reply in US dollars, when known
+	Cost float64 `json:"cost,omitempty"`
+
+	// DurationMS is how long an assistant reply took to arrive
+	DurationMS int64 `json:"duration_ms,omitempty"`
+}
+
+// Usage holds the token counts reported for a reply
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Total returns the prompt and completion tokens combined
+func (u Usage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Add returns the sum of two usage records
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+	}
 }
 
-// ChatRequest represents a request to send a message
+// TotalUsage sums the usage reported for the messages, returning nil when
+// none was reported
+func TotalUsage(messages []Message) *Usage {
+	var total *Usage
+	for _, msg := range messages {
+		if msg.Usage == nil {
+			continue
+		}
+		if total == nil {
+			total = &Usage{}
+		}
+		*total = total.Add(*msg.Usage)
+	}
+	return total
+}
+
+// ChatRequest represents a request to send a message. Model, when set,
+// replaces the provider's default model for this request only, as does
+// Temperature for the provider's configured temperature.
 type ChatRequest struct {
 	Messages    []Message         `json:"messages"`
-	Temperature float64           `json:"temperature,omitempty"`
+	Model       string            `json:"model,omitempty"`
+	Temperature *float64          `json:"temperature,omitempty"`
 	MaxTokens   int               `json:"max_tokens,omitempty"`
 	Stream      bool              `json:"stream"`
 	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
+// Temperature returns t as the temperature of a ChatRequest, where zero is
+// a setting of its own rather than the provider's default
+func Temperature(t float64) *float64 {
+	return &t
+}
+
 // ChatResponse represents a response from the LLM
 type ChatResponse struct {
 	Content      string        `json:"content"`
 	FinishReason string        `json:"finish_reason,omitempty"`
 	TokensUsed   int           `json:"tokens_used,omitempty"`
+	Usage        *Usage        `json:"usage,omitempty"`
 	ResponseTime time.Duration `json:"response_time"`
 	ProviderName string        `json:"provider_name"`
 	ModelName    string        `json:"model_name"`
 }
 
-// StreamChunk represents a chunk of streamed response
+// StreamChunk represents a chunk of streamed response. The final chunk
+// (Done set, no Error) carries the usage and finish reason when the
+// provider reports them, and names the provider and model that answered.
 type StreamChunk struct {
-	Content string
-	Done    bool
-	Error   error
+	Content      string
+	Done         bool
+	Error        error
+	Usage        *Usage
+	FinishReason string
+	ProviderName string
+	ModelName    string
 }